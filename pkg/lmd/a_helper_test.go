@@ -408,6 +408,73 @@ func PauseTestPeers(peer *Peer) {
 	}
 }
 
+// StartTestHTTPPeer starts paused test peers like StartTestPeerExtra and
+// returns a client for the http api of the mock lmd.
+func StartTestHTTPPeer(t *testing.T, numPeers, numHosts, numServices int, extraConfig string) (peer *Peer, cleanup func() error, mocklmd *Daemon, client *TestHTTPClient) {
+	t.Helper()
+	peer, cleanup, mocklmd = StartTestPeerExtra(numPeers, numHosts, numServices, extraConfig)
+	PauseTestPeers(peer)
+
+	return peer, cleanup, mocklmd, NewTestHTTPClient(t, mocklmd)
+}
+
+// TestHTTPClient sends requests directly to the http handler of a lmd instance.
+type TestHTTPClient struct {
+	t       *testing.T
+	handler http.Handler
+}
+
+// NewTestHTTPClient creates a client for the http api of given lmd instance.
+func NewTestHTTPClient(t *testing.T, lmd *Daemon) *TestHTTPClient {
+	t.Helper()
+
+	return &TestHTTPClient{t: t, handler: initializeHTTPRouter(lmd)}
+}
+
+// NewTestHTTPServer starts a http server for the http api of given lmd instance, used for streaming endpoints.
+// The server is closed when the test finishes.
+func NewTestHTTPServer(t *testing.T, lmd *Daemon) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(initializeHTTPRouter(lmd))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// Do sends the request and returns the recorded response.
+func (c *TestHTTPClient) Do(request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	c.handler.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+// Send sends a request with optional headers in "Name: value" form and returns the recorded response.
+func (c *TestHTTPClient) Send(method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	c.t.Helper()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		require.Truef(c.t, ok, "invalid header: %s", header)
+		request.Header.Set(name, strings.TrimSpace(value))
+	}
+
+	return c.Do(request)
+}
+
+// SendJSON sends a request like Send and decodes the json response into result.
+// Decoding errors are only fatal for successful requests, error responses might use a different format.
+func (c *TestHTTPClient) SendJSON(method, path, body string, result interface{}, headers ...string) *httptest.ResponseRecorder {
+	c.t.Helper()
+	recorder := c.Send(method, path, body, headers...)
+	err := json.Unmarshal(recorder.Body.Bytes(), result)
+	if recorder.Code == http.StatusOK {
+		require.NoError(c.t, err)
+	}
+
+	return recorder
+}
+
 func CheckOpenFilesLimit(b *testing.B, minimum uint64) {
 	b.Helper()
 	var rLimit syscall.Rlimit
@@ -0,0 +1,211 @@
+package lmd
+
+import (
+	"fmt"
+	"path"
+	"slices"
+)
+
+// RequestACL contains the combined rules of all ACLs matching the user of a request.
+type RequestACL struct {
+	name        string   // name of the acl if selected by name, ex.: by an api token
+	backends    []string // allowed backend id, name or section patterns
+	tables      []string // allowed table names
+	denyColumns []string // denied column patterns
+	commands    []string // allowed command name patterns
+	allBackends bool     // flag wether all backends are allowed
+	allTables   bool     // flag wether all tables are allowed
+	allCommands bool     // flag wether all object commands are allowed
+}
+
+// embeddedColumns lists the columns embedded into the elements of list columns, ex.: services_with_info.
+// Those list columns are denied if any of the embedded columns is denied.
+var embeddedColumns = map[TableName]map[string][]string{
+	TableHosts: {
+		"services_with_info":  {"description", "state", "has_been_checked", "plugin_output"},
+		"services_with_state": {"description", "state", "has_been_checked"},
+		"comments_with_info":  {"id", "author", "comment", "entry_time", "entry_type", "expires", "expire_time"},
+		"downtimes_with_info": {"id", "author", "comment", "entry_time", "start_time", "end_time", "fixed", "duration", "triggered_by"},
+	},
+	TableServices: {
+		"comments_with_info":  {"id", "author", "comment", "entry_time", "entry_type", "expires", "expire_time"},
+		"downtimes_with_info": {"id", "author", "comment", "entry_time", "start_time", "end_time", "fixed", "duration", "triggered_by"},
+	},
+	TableHostgroups: {
+		"members_with_state": {"name", "state", "has_been_checked"},
+	},
+	TableServicegroups: {
+		"members_with_state": {"host_name", "description", "state", "has_been_checked"},
+	},
+}
+
+// NewRequestACL returns the combined rules of all ACLs matching given user or nil if no ACL applies.
+// Requests without AuthUser are matched by an empty user name, ex.: users = ["*"].
+func NewRequestACL(lmd *Daemon, authUser string) *RequestACL {
+	if lmd == nil || len(lmd.Config.ACL) == 0 {
+		return nil
+	}
+
+	var groups map[string]bool
+	var acl *RequestACL
+	for i := range lmd.Config.ACL {
+		rule := &lmd.Config.ACL[i]
+		if !matchAnyPattern(rule.Users, authUser) {
+			if authUser == "" || len(rule.Groups) == 0 {
+				continue
+			}
+			if groups == nil {
+				groups = lmd.getContactGroups(authUser)
+			}
+			if !slices.ContainsFunc(rule.Groups, func(group string) bool { return groups[group] }) {
+				continue
+			}
+		}
+		if acl == nil {
+			acl = &RequestACL{}
+		}
+		acl.add(rule)
+	}
+
+	return acl
+}
+
+// NewRequestACLByName returns the rules of the ACL with given name or nil if there is none.
+func NewRequestACLByName(lmd *Daemon, name string) *RequestACL {
+	for i := range lmd.Config.ACL {
+		rule := &lmd.Config.ACL[i]
+		if rule.Name == name {
+			acl := &RequestACL{name: name}
+			acl.add(rule)
+
+			return acl
+		}
+	}
+
+	return nil
+}
+
+// add merges the rule into this ACL. Allowed backends and tables are combined, as well as denied columns.
+func (acl *RequestACL) add(rule *ACL) {
+	if len(rule.Backends) == 0 {
+		acl.allBackends = true
+	}
+	if len(rule.Tables) == 0 {
+		acl.allTables = true
+	}
+	if len(rule.Commands) == 0 {
+		acl.allCommands = true
+	}
+	acl.backends = append(acl.backends, rule.Backends...)
+	acl.tables = append(acl.tables, rule.Tables...)
+	acl.denyColumns = append(acl.denyColumns, rule.DenyColumns...)
+	acl.commands = append(acl.commands, rule.Commands...)
+}
+
+// AllowBackend returns true if the backend may be queried.
+func (acl *RequestACL) AllowBackend(peer *Peer) bool {
+	if acl == nil || acl.allBackends {
+		return true
+	}
+
+	return matchAnyPattern(acl.backends, peer.ID) || matchAnyPattern(acl.backends, peer.Name) ||
+		(peer.Section != "" && matchAnyPattern(acl.backends, peer.Section))
+}
+
+// AllowTable returns true if the table may be queried.
+func (acl *RequestACL) AllowTable(name TableName) bool {
+	if acl == nil || acl.allTables {
+		return true
+	}
+
+	return slices.Contains(acl.tables, name.String())
+}
+
+// DenyColumn returns true if the column must not be used. Reference columns, like host_address, are
+// denied by the name of the referenced column as well and list columns, like services_with_info,
+// if any of the embedded columns is denied.
+func (acl *RequestACL) DenyColumn(col *Column) bool {
+	if acl.DenyColumnName(col.Name) {
+		return true
+	}
+	for col.RefCol != nil {
+		col = col.RefCol
+		if acl.DenyColumnName(col.Name) {
+			return true
+		}
+	}
+	for _, name := range embeddedColumns[col.Table.Name][col.Name] {
+		if acl.DenyColumnName(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DenyColumnName returns true if the column name matches any denied column pattern.
+func (acl *RequestACL) DenyColumnName(name string) bool {
+	if acl == nil {
+		return false
+	}
+
+	return matchAnyPattern(acl.denyColumns, name)
+}
+
+// AllowCommand returns true if the command may be sent. Global commands, which do not apply to a
+// single object, must always be listed explicitly.
+func (acl *RequestACL) AllowCommand(name string, global bool) bool {
+	if acl == nil {
+		return !global
+	}
+	if acl.allCommands && !global {
+		return true
+	}
+
+	return matchAnyPattern(acl.commands, name)
+}
+
+// checkFilter returns an error if any filter uses a denied column.
+func (acl *RequestACL) checkFilter(filter []*Filter) error {
+	for _, fil := range filter {
+		if fil.Column != nil && acl.DenyColumn(fil.Column) {
+			return fmt.Errorf("bad request: column %s not allowed", fil.Column.Name)
+		}
+		if err := acl.checkFilter(fil.Filter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getContactGroups returns the contact groups of given user from all backends.
+func (lmd *Daemon) getContactGroups(authUser string) map[string]bool {
+	groups := make(map[string]bool)
+	lmd.PeerMapLock.RLock()
+	defer lmd.PeerMapLock.RUnlock()
+	for _, peer := range lmd.PeerMap {
+		data, err := peer.GetDataStoreSet()
+		if err != nil {
+			continue
+		}
+		data.lock.RLock()
+		for group := range data.getContactGroups(authUser) {
+			groups[group] = true
+		}
+		data.lock.RUnlock()
+	}
+
+	return groups
+}
+
+// matchAnyPattern returns true if the value matches any of the given glob patterns.
+func matchAnyPattern(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,175 @@
+package lmd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const aclTestConfig = `
+Listen = ["test.sock"]
+
+[[ACL]]
+name = "restricted"
+users = ["auth*"]
+backends = ["mockid0"]
+tables = ["hosts", "services", "status"]
+deny_columns = ["*custom_variable*", "address"]
+
+[[ACL]]
+name = "group"
+groups = ["example"]
+tables = ["hostgroups"]
+`
+
+/**
+ * Tests that backends, tables and columns are restricted by ACLs.
+ */
+func TestACLRestrictions(t *testing.T) {
+	peer, cleanup, _ := StartTestPeerExtra(2, 2, 2, aclTestConfig)
+	PauseTestPeers(peer)
+
+	// without acl the user sees hosts from both backends
+	res, _, err := peer.QueryString("GET hosts\nColumns: name address\nAuthUser: nobody\n\n")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	res, _, err = peer.QueryString("GET hosts\nColumns: name address\n\n")
+	require.NoError(t, err)
+	assert.Len(t, res, 4)
+	assert.NotEmpty(t, res[0][1])
+
+	// only first backend is allowed and address is replaced by an empty value
+	res, _, err = peer.QueryString("GET hosts\nColumns: name address peer_key\nAuthUser: authuser\n\n")
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Empty(t, res[0][1])
+	assert.Equal(t, "mockid0", res[0][2])
+
+	// explicitly requesting a denied backend
+	_, _, err = peer.QueryString("GET hosts\nColumns: name\nBackends: mockid1\nAuthUser: authuser\n\n")
+	require.ErrorContains(t, err, "backend mockid1 not allowed")
+
+	// default columns skip denied columns
+	res, meta, err := peer.QueryString("GET hosts\nAuthUser: authuser\nColumnHeaders: on\nOutputFormat: wrapped_json\n\n")
+	require.NoError(t, err)
+	require.NotEmpty(t, res)
+	assert.NotContains(t, meta.Columns, "address")
+	assert.NotContains(t, meta.Columns, "custom_variables")
+	assert.Contains(t, meta.Columns, "name")
+
+	// denied tables, filter and sort columns
+	_, _, err = peer.QueryString("GET contacts\nColumns: name\nAuthUser: authuser\n\n")
+	require.ErrorContains(t, err, "table contacts not allowed")
+
+	_, _, err = peer.QueryString("GET hosts\nColumns: name\nFilter: address = 127.0.0.1\nAuthUser: authuser\n\n")
+	require.ErrorContains(t, err, "column address not allowed")
+
+	_, _, err = peer.QueryString("GET hosts\nColumns: name\nSort: custom_variable_names asc\nAuthUser: authuser\n\n")
+	require.ErrorContains(t, err, "not allowed")
+
+	// group acl only allows hostgroups
+	res, _, err = peer.QueryString("GET hostgroups\nColumns: name\nAuthUser: groupuser\n\n")
+	require.NoError(t, err)
+	assert.NotEmpty(t, res)
+
+	_, _, err = peer.QueryString("GET hosts\nColumns: name\nAuthUser: groupuser\n\n")
+	require.ErrorContains(t, err, "table hosts not allowed")
+
+	err = cleanup()
+	require.NoError(t, err)
+}
+
+/**
+ * Tests that list columns embedding denied columns are denied as well, also for requests without AuthUser.
+ */
+func TestACLEmbeddedColumns(t *testing.T) {
+	peer, cleanup, _ := StartTestPeerExtra(1, 2, 2, `
+Listen = ["test.sock"]
+
+[[ACL]]
+name = "anonymous"
+users = ["*"]
+deny_columns = ["plugin_output"]
+`)
+	PauseTestPeers(peer)
+
+	res, _, err := peer.QueryString("GET hosts\nColumns: name plugin_output services_with_info services_with_state\n\n")
+	require.NoError(t, err)
+	require.NotEmpty(t, res)
+	assert.Empty(t, res[0][1])
+	assert.Empty(t, res[0][2])
+	assert.NotEmpty(t, res[0][3])
+
+	// reference columns are denied by the name of the referenced column
+	res, _, err = peer.QueryString("GET services\nColumns: description host_plugin_output host_services_with_info\n\n")
+	require.NoError(t, err)
+	require.NotEmpty(t, res)
+	assert.Empty(t, res[0][1])
+	assert.Empty(t, res[0][2])
+
+	_, _, err = peer.QueryString("GET hosts\nColumns: name\nFilter: services_with_info >= test\n\n")
+	require.ErrorContains(t, err, "column services_with_info not allowed")
+
+	_, _, err = peer.QueryString("GET services\nColumns: description\nSort: host_plugin_output asc\n\n")
+	require.ErrorContains(t, err, "not allowed")
+
+	err = cleanup()
+	require.NoError(t, err)
+}
+
+/**
+ * Tests that the AuthUser is forwarded to other cluster nodes.
+ */
+func TestACLDistributedRequest(t *testing.T) {
+	lmd := createTestLMDInstance()
+	req := &Request{lmd: lmd, Table: TableHosts, Columns: []string{"name"}, AuthUser: "authuser"}
+	// send through json like the node accessor does
+	encoded, err := json.Marshal(req.buildDistributedRequestData([]string{"mockid0"}))
+	require.NoError(t, err)
+	requestData := make(map[string]interface{})
+	require.NoError(t, json.Unmarshal(encoded, &requestData))
+	assert.Equal(t, "authuser", requestData["authuser"])
+
+	parsed, err := parseRequestDataToRequest(requestData)
+	require.NoError(t, err)
+	assert.Equal(t, "authuser", parsed.AuthUser)
+
+	lmd.Config.ACL = []ACL{{Name: "test", Users: []string{"authuser"}, DenyColumns: []string{"name"}}}
+	parsed.lmd = lmd
+	require.NoError(t, parsed.SetRequestColumns())
+	require.Len(t, parsed.RequestColumns, 1)
+	assert.Equal(t, "name", parsed.RequestColumns[0].Name)
+	assert.Equal(t, VirtualStore, parsed.RequestColumns[0].StorageType)
+
+	require.NoError(t, parsed.ExpandRequestedBackends())
+	_, _, err = NewResponse(context.TODO(), parsed, nil)
+	require.NoError(t, err)
+
+	// acls selected by an api token are forwarded by name
+	req = &Request{lmd: lmd, Table: TableHosts, Columns: []string{"name"}}
+	req.SetACL(NewRequestACLByName(lmd, "test"))
+	encoded, err = json.Marshal(req.buildDistributedRequestData([]string{"mockid0"}))
+	require.NoError(t, err)
+	requestData = make(map[string]interface{})
+	require.NoError(t, json.Unmarshal(encoded, &requestData))
+	assert.Equal(t, "test", requestData["acl"])
+
+	parsed, err = parseRequestDataToRequest(requestData)
+	require.NoError(t, err)
+	parsed.lmd = lmd
+	require.NoError(t, applyForwardedACL(context.TODO(), lmd, parsed, requestData))
+	require.NoError(t, parsed.SetRequestColumns())
+	require.Len(t, parsed.RequestColumns, 1)
+	assert.Equal(t, VirtualStore, parsed.RequestColumns[0].StorageType)
+
+	// restricted clients cannot select another acl
+	ctx := context.WithValue(context.TODO(), CtxAPIToken, &APIToken{Name: "viewer", AuthUser: "authuser"})
+	require.ErrorContains(t, applyForwardedACL(ctx, lmd, parsed, requestData), "acl cannot be selected")
+
+	requestData["acl"] = "unknown"
+	require.ErrorContains(t, applyForwardedACL(context.TODO(), lmd, parsed, requestData), "unknown acl")
+}
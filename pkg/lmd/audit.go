@@ -0,0 +1,138 @@
+package lmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+// available audit actions.
+const (
+	AuditActionCommand = "command"
+	AuditActionReload  = "reload"
+	AuditActionPeer    = "peer"
+)
+
+// AuditEntry is a single structured record of the audit log.
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	Client   string    `json:"client,omitempty"`
+	AuthUser string    `json:"authuser,omitempty"`
+	Peers    []string  `json:"peers,omitempty"`
+	Command  string    `json:"command,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	Code     int       `json:"code"`
+	Duration float64   `json:"duration"` // seconds
+
+	Results map[string]*CommandPeerResult `json:"results,omitempty"` // command result for each backend
+}
+
+// AuditLog writes audit entries as json lines to a file or syslog.
+type AuditLog struct {
+	lock   *deadlock.Mutex
+	writer io.WriteCloser
+	target string
+}
+
+// NewAuditLog opens the audit log. The target is either a file name, "syslog" for the local syslog
+// or "syslog:<network>:<address>" for a remote syslog, ex.: "syslog:udp:10.0.0.1:514".
+func NewAuditLog(target string) (audit *AuditLog, err error) {
+	audit = &AuditLog{
+		lock:   new(deadlock.Mutex),
+		target: target,
+	}
+	switch {
+	case target == "syslog":
+		audit.writer, err = syslog.New(syslog.LOG_INFO|syslog.LOG_AUTHPRIV, NAME)
+	case strings.HasPrefix(target, "syslog:"):
+		network, address, ok := strings.Cut(strings.TrimPrefix(target, "syslog:"), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid syslog target %s, expected syslog:<network>:<address>", target)
+		}
+		audit.writer, err = syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_AUTHPRIV, NAME)
+	default:
+		audit.writer, err = os.OpenFile(target, os.O_APPEND|os.O_CREATE|os.O_WRONLY, DefaultFilePerm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("audit log %s: %w", target, err)
+	}
+
+	return audit, nil
+}
+
+// Write adds the entry to the audit log.
+func (a *AuditLog) Write(entry *AuditEntry) {
+	if a == nil {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("failed to encode audit entry: %s", err.Error())
+
+		return
+	}
+	line = append(line, '\n')
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if _, err := a.writer.Write(line); err != nil {
+		log.Errorf("failed to write audit log %s: %s", a.target, err.Error())
+	}
+}
+
+// Close closes the audit log.
+func (a *AuditLog) Close() {
+	if a == nil {
+		return
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	LogErrors(a.writer.Close())
+}
+
+// initAuditLog (re)opens the audit log from the current configuration.
+func (lmd *Daemon) initAuditLog() {
+	lmd.auditLock.Lock()
+	defer lmd.auditLock.Unlock()
+	lmd.auditLog.Close()
+	lmd.auditLog = nil
+	if lmd.Config.AuditLog == "" {
+		return
+	}
+	audit, err := NewAuditLog(lmd.Config.AuditLog)
+	if err != nil {
+		log.Errorf("failed to open audit log: %s", err.Error())
+
+		return
+	}
+	lmd.auditLog = audit
+}
+
+// setCommandResults sets the results of the backends of this entry. Code and message
+// are aggregated from those backends only.
+func (entry *AuditEntry) setCommandResults(results map[string]*CommandPeerResult) {
+	entry.Results = make(map[string]*CommandPeerResult, len(entry.Peers))
+	for _, peerKey := range entry.Peers {
+		if result, ok := results[peerKey]; ok {
+			entry.Results[peerKey] = result
+		}
+	}
+	entry.Code, entry.Message = aggregateCommandResults(entry.Results)
+}
+
+// audit writes the entry to the audit log if enabled.
+func (lmd *Daemon) audit(entry *AuditEntry) {
+	lmd.auditLock.RLock()
+	defer lmd.auditLock.RUnlock()
+	lmd.auditLog.Write(entry)
+}
@@ -0,0 +1,134 @@
+package lmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAuditLog(t *testing.T, file string) (entries []AuditEntry) {
+	t.Helper()
+	fh, err := os.Open(file)
+	require.NoError(t, err)
+	defer fh.Close()
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		var entry AuditEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func TestAuditLog(t *testing.T) {
+	_, err := NewAuditLog("syslog:invalid")
+	require.Error(t, err)
+
+	file := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := NewAuditLog(file)
+	require.NoError(t, err)
+	audit.Write(&AuditEntry{Action: AuditActionReload, Code: ReturnCodeOK})
+	audit.Close()
+
+	entries := readAuditLog(t, file)
+	require.Len(t, entries, 1)
+	assert.Equal(t, AuditActionReload, entries[0].Action)
+	assert.False(t, entries[0].Time.IsZero())
+}
+
+func TestAuditLogCommands(t *testing.T) {
+	peer, cleanup, mocklmd := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	file := filepath.Join(t.TempDir(), "audit.log")
+	mocklmd.Config.AuditLog = file
+	mocklmd.initAuditLog()
+
+	_, _, err := peer.QueryString("COMMAND [0] test_ok\n\n")
+	require.NoError(t, err)
+	_, _, err = peer.QueryString("COMMAND [0] test_broken\n\n")
+	require.Error(t, err)
+
+	mocklmd.Config.ListenerCommands = map[string][]string{"test.sock": {"SCHEDULE_*"}}
+	_, _, err = peer.QueryString("COMMAND [0] test_ok\n\n")
+	require.Error(t, err)
+
+	// queued commands are still sent if a later command is rejected
+	mocklmd.Config.ListenerCommands = map[string][]string{"test.sock": {"TEST_OK"}}
+	conn, err := net.DialTimeout("unix", "test.sock", 10*time.Second)
+	require.NoError(t, err)
+	_, err = fmt.Fprintf(conn, "COMMAND [0] test_ok\n\nCOMMAND [0] DISABLE_NOTIFICATIONS\n\n")
+	require.NoError(t, err)
+	require.NoError(t, conn.(*net.UnixConn).CloseWrite())
+	res, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Contains(t, string(res), "403: command DISABLE_NOTIFICATIONS not allowed on this listener")
+	conn.Close()
+	mocklmd.Config.ListenerCommands = nil
+
+	mocklmd.Config.AuditLog = ""
+	mocklmd.initAuditLog()
+
+	entries := readAuditLog(t, file)
+	require.Len(t, entries, 5)
+	assert.Equal(t, AuditActionCommand, entries[0].Action)
+	assert.Equal(t, "COMMAND [0] test_ok", entries[0].Command)
+	assert.Equal(t, []string{"mockid0"}, entries[0].Peers)
+	assert.Equal(t, ReturnCodeOK, entries[0].Code)
+	assert.NotEmpty(t, entries[0].Client)
+	assert.Equal(t, ReturnCodeBadRequest, entries[1].Code)
+	assert.Equal(t, ReturnCodeForbidden, entries[2].Code)
+	assert.Equal(t, "COMMAND [0] test_ok", entries[3].Command)
+	assert.Equal(t, ReturnCodeOK, entries[3].Code)
+	assert.Equal(t, "COMMAND [0] DISABLE_NOTIFICATIONS", entries[4].Command)
+	assert.Equal(t, ReturnCodeForbidden, entries[4].Code)
+
+	err = cleanup()
+	require.NoError(t, err)
+}
+
+func TestAuditLogCommandResults(t *testing.T) {
+	peer, cleanup, mocklmd := StartTestPeer(2, 10, 10)
+	PauseTestPeers(peer)
+
+	file := filepath.Join(t.TempDir(), "audit.log")
+	mocklmd.Config.AuditLog = file
+	mocklmd.initAuditLog()
+
+	// commands queued on one connection are sent together, but each entry has the results of its own backends
+	conn, err := net.DialTimeout("unix", "test.sock", 10*time.Second)
+	require.NoError(t, err)
+	_, err = fmt.Fprintf(conn, "COMMAND [0] test_ok\nBackends: mockid0\n\nCOMMAND [0] test_broken\nBackends: mockid1\n\n")
+	require.NoError(t, err)
+	require.NoError(t, conn.(*net.UnixConn).CloseWrite())
+	_, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	conn.Close()
+
+	mocklmd.Config.AuditLog = ""
+	mocklmd.initAuditLog()
+
+	entries := readAuditLog(t, file)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "COMMAND [0] test_ok", entries[0].Command)
+	assert.Equal(t, ReturnCodeOK, entries[0].Code)
+	require.Len(t, entries[0].Results, 1)
+	assert.Equal(t, ReturnCodeOK, entries[0].Results["mockid0"].Code)
+	assert.Equal(t, "COMMAND [0] test_broken", entries[1].Command)
+	assert.Equal(t, ReturnCodeBadRequest, entries[1].Code)
+	require.Len(t, entries[1].Results, 1)
+	assert.Equal(t, ReturnCodeBadRequest, entries[1].Results["mockid1"].Code)
+
+	err = cleanup()
+	require.NoError(t, err)
+}
@@ -0,0 +1,108 @@
+package lmd
+
+import "slices"
+
+// AuthIndex contains the precomputed visible rows of a single AuthUser.
+type AuthIndex struct {
+	rows    map[TableName][]*DataRow        // visible rows in the same order as the store data
+	visible map[TableName]map[*DataRow]bool // lookup map of the visible rows
+}
+
+// isAuthIndexed returns true if rows of this store can be looked up in the authorization index.
+// Virtual stores are created for each query and the log table changes constantly, so they are not indexed.
+func (d *DataStore) isAuthIndexed() bool {
+	switch d.Table.Name {
+	case TableHosts, TableServices, TableHostgroups, TableServicegroups, TableComments, TableDowntimes,
+		TableContacts, TableContactgroups, TableCommands:
+	default:
+		return false
+	}
+	if d.DataSet == nil {
+		return false
+	}
+
+	return d.DataSet.tables[d.Table.Name] == d
+}
+
+// getAuthRows returns all rows of this store the user is allowed to see.
+// The index is built once for each existing contact and table and updated when rows are added or removed.
+// ds.lock must be held.
+func (ds *DataStoreSet) getAuthRows(store *DataStore, authUser string) (rows []*DataRow, visible map[*DataRow]bool) {
+	name := store.Table.Name
+	ds.authLock.RLock()
+	index, ok := ds.authIndex.get(authUser)
+	if ok {
+		if rows, ok := index.rows[name]; ok {
+			ds.authLock.RUnlock()
+
+			return rows, index.visible[name]
+		}
+	}
+	ds.authLock.RUnlock()
+
+	rows = make([]*DataRow, 0)
+	visible = make(map[*DataRow]bool)
+	for _, row := range store.Data {
+		if row.checkAuth(authUser) {
+			rows = append(rows, row)
+			visible[row] = true
+		}
+	}
+	if !ds.isContact(authUser) {
+		// do not cache unknown users, the index would grow with every name sent by clients
+		return rows, visible
+	}
+
+	ds.authLock.Lock()
+	defer ds.authLock.Unlock()
+	index, ok = ds.authIndex.get(authUser)
+	if !ok {
+		index = &AuthIndex{
+			rows:    make(map[TableName][]*DataRow),
+			visible: make(map[TableName]map[*DataRow]bool),
+		}
+		ds.authIndex.add(authUser, index)
+	}
+	if existing, ok := index.rows[name]; ok {
+		// built by another query meanwhile
+		return existing, index.visible[name]
+	}
+	index.rows[name] = rows
+	index.visible[name] = visible
+
+	return rows, visible
+}
+
+// updateAuthIndex adds or removes the row in the indexed rows of all users who can see it.
+// Changed contacts or contact groups affect all tables, so the whole index is dropped then.
+// ds.lock must be held.
+func (ds *DataStoreSet) updateAuthIndex(store *DataStore, row *DataRow, removed bool) {
+	if !store.isAuthIndexed() {
+		return
+	}
+	name := store.Table.Name
+	if name == TableContacts || name == TableContactgroups {
+		ds.resetAuthCache()
+
+		return
+	}
+
+	ds.authLock.Lock()
+	defer ds.authLock.Unlock()
+	ds.authIndex.each(func(authUser string, index *AuthIndex) {
+		rows, ok := index.rows[name]
+		if !ok {
+			return
+		}
+		visible := index.visible[name]
+		switch {
+		case removed && visible[row]:
+			index.rows[name] = slices.DeleteFunc(rows, func(r *DataRow) bool { return r == row })
+			delete(visible, row)
+		case !removed && row.checkAuth(authUser):
+			// new rows are appended to the store data, so the order is kept
+			index.rows[name] = append(rows, row)
+			visible[row] = true
+		}
+	})
+}
@@ -202,3 +202,215 @@ func TestAuthuserServicesbyhostgroup(t *testing.T) {
 	err = cleanup()
 	require.NoError(t, err)
 }
+
+/**
+ * Tests that contact group members can see hosts and services of their groups.
+ */
+func TestAuthuserContactGroups(t *testing.T) {
+	peer, cleanup, _ := StartTestPeer(1, 2, 2)
+	PauseTestPeers(peer)
+
+	// groupuser is no direct contact, but member of the example contact group
+	res, _, err := peer.QueryString("GET hosts\nColumns: name state contacts\nAuthUser: groupuser\n\n")
+	require.NoError(t, err)
+	assert.Len(t, res, 1)
+
+	// same services as the direct contacts of that group
+	res, _, err = peer.QueryString("GET services\nColumns: host_name description state\nAuthUser: groupuser\n\n")
+	require.NoError(t, err)
+	expect, _, err := peer.QueryString("GET services\nColumns: host_name description state\nAuthUser: example\n\n")
+	require.NoError(t, err)
+	assert.NotEmpty(t, res)
+	assert.Equal(t, expect, res)
+
+	res, _, err = peer.QueryString("GET hosts\nColumns: name state contacts\nAuthUser: nobody\n\n")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	// log entries of group hosts and services are visible as well
+	hosts, _, err := peer.QueryString("GET hosts\nColumns: name\nAuthUser: groupuser\n\n")
+	require.NoError(t, err)
+	require.NotEmpty(t, hosts)
+	host := interface2stringNoDedup(hosts[0][0])
+	services, _, err := peer.QueryString("GET services\nColumns: host_name description\nAuthUser: groupuser\n\n")
+	require.NoError(t, err)
+	require.NotEmpty(t, services)
+	ds := peer.data
+	ds.lock.RLock()
+	assert.True(t, ds.isAuthorizedForLogEntry("groupuser", host, "", []string{}, []string{}, AuthLoose))
+	assert.True(t, ds.isAuthorizedForLogEntry("groupuser", interface2stringNoDedup(services[0][0]), interface2stringNoDedup(services[0][1]), []string{}, []string{}, AuthStrict))
+	assert.False(t, ds.isAuthorizedForLogEntry("nobody", host, "", []string{}, []string{}, AuthLoose))
+	ds.lock.RUnlock()
+
+	// only existing contacts are cached and the cache is reset with the contact groups
+	ds.lock.RLock()
+	assert.NotEmpty(t, ds.getContactGroups("groupuser"))
+	assert.Empty(t, ds.getContactGroups("nobody"))
+	ds.lock.RUnlock()
+	ds.authLock.RLock()
+	_, cached := ds.authGroups.get("groupuser")
+	assert.True(t, cached)
+	_, cached = ds.authGroups.get("nobody")
+	assert.False(t, cached)
+	ds.authLock.RUnlock()
+
+	ds.Set(TableContactgroups, ds.Get(TableContactgroups))
+	ds.authLock.RLock()
+	assert.Equal(t, 0, ds.authGroups.count())
+	ds.authLock.RUnlock()
+
+	err = cleanup()
+	require.NoError(t, err)
+}
+
+/**
+ * Tests AuthUser rules for contacts, contactgroups and commands.
+ */
+func TestAuthuserContacts(t *testing.T) {
+	peer, cleanup, _ := StartTestPeer(1, 2, 2)
+	PauseTestPeers(peer)
+
+	// not restricted by default, like naemon
+	res, _, err := peer.QueryString("GET contacts\nColumns: name email\nAuthUser: authuser\n\n")
+	require.NoError(t, err)
+	assert.Greater(t, len(res), 1)
+
+	res, _, err = peer.QueryString("GET commands\nColumns: name line\nAuthUser: authuser\n\n")
+	require.NoError(t, err)
+	assert.NotEmpty(t, res)
+
+	err = cleanup()
+	require.NoError(t, err)
+}
+
+/**
+ * Tests AuthUser rules for contacts, contactgroups and commands with StrictObjectAuthorization.
+ */
+func TestAuthuserContactsStrict(t *testing.T) {
+	peer, cleanup, _ := StartTestPeerExtra(1, 2, 2, "StrictObjectAuthorization = true\n")
+	PauseTestPeers(peer)
+
+	res, _, err := peer.QueryString("GET contacts\nColumns: name email\nAuthUser: authuser\n\n")
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, "authuser", res[0][0])
+
+	res, _, err = peer.QueryString("GET contactgroups\nColumns: name\nAuthUser: authuser\n\n")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	res, _, err = peer.QueryString("GET contactgroups\nColumns: name\nAuthUser: groupuser\n\n")
+	require.NoError(t, err)
+	assert.Len(t, res, 1)
+
+	res, _, err = peer.QueryString("GET commands\nColumns: name line\nAuthUser: authuser\n\n")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	res, _, err = peer.QueryString("GET timeperiods\nColumns: name\nAuthUser: authuser\n\n")
+	require.NoError(t, err)
+	assert.NotEmpty(t, res)
+
+	err = cleanup()
+	require.NoError(t, err)
+}
+
+/**
+ * Tests local AuthUser filtering of log entries.
+ */
+func TestAuthuserLogFilter(t *testing.T) {
+	lmd := createTestLMDInstance()
+	peer := NewPeer(lmd, &Connection{Name: "Test", ID: "test", Source: []string{"test.sock"}})
+	peer.SetFlag(Icinga2)
+	require.False(t, peer.supportsLogAuthUser())
+
+	limit := 2
+	req := &Request{Table: TableLog, Columns: []string{"time", "message"}, AuthUser: "authuser", Limit: &limit}
+	authReq := localAuthRequest(req)
+	assert.Empty(t, authReq.AuthUser)
+	assert.Nil(t, authReq.Limit)
+	assert.Len(t, authReq.Columns, len(req.Columns)+len(logAuthColumns))
+
+	result := ResultSet{
+		{1, "program start", "", "", []interface{}{}, []interface{}{}},
+		{2, "host alert", "host1", "", []interface{}{"example"}, []interface{}{}},
+		{3, "service alert", "host1", "svc1", []interface{}{"authuser"}, []interface{}{"example"}},
+		{4, "service alert", "host1", "svc2", []interface{}{"example"}, []interface{}{"authuser"}},
+	}
+	filtered := peer.filterLogAuth(result, req)
+	require.Len(t, filtered, 2)
+	assert.Equal(t, []interface{}{1, "program start"}, filtered[0])
+	assert.Equal(t, []interface{}{3, "service alert"}, filtered[1])
+
+	// strict service authorization requires a service contact
+	lmd.Config.ServiceAuthorization = AuthStrict
+	req.Limit = nil
+	filtered = peer.filterLogAuth(result, req)
+	require.Len(t, filtered, 2)
+	assert.Equal(t, []interface{}{4, "service alert"}, filtered[1])
+}
+
+/**
+ * Tests the precomputed authorization index.
+ */
+func TestAuthuserIndex(t *testing.T) {
+	peer, cleanup, mocklmd := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	res, _, err := peer.QueryString("GET services\nColumns: host_name description\nAuthUser: authuser\n\n")
+	require.NoError(t, err)
+	expect := len(res)
+
+	mocklmd.PeerMapLock.RLock()
+	mockPeer := mocklmd.PeerMap[mocklmd.PeerMapOrder[0]]
+	mocklmd.PeerMapLock.RUnlock()
+
+	ds := mockPeer.data
+	store := ds.Get(TableServices)
+	comments := ds.Get(TableComments)
+	ds.lock.Lock()
+	rows, visible := ds.getAuthRows(store, "authuser")
+	require.Len(t, rows, expect)
+	for _, row := range store.Data {
+		assert.Equal(t, row.checkAuth("authuser"), visible[row])
+	}
+
+	ds.authLock.RLock()
+	index, cached := ds.authIndex.get("authuser")
+	ds.authLock.RUnlock()
+	require.True(t, cached)
+
+	// index is updated when rows are removed or added
+	rows, _ = ds.getAuthRows(comments, "authuser")
+	require.NotEmpty(t, rows)
+	numComments := len(rows)
+	comment := rows[0]
+	comments.RemoveItem(comment)
+	rows, visible = ds.getAuthRows(comments, "authuser")
+	assert.Len(t, rows, numComments-1)
+	assert.False(t, visible[comment])
+	comments.AddItem(comment)
+	rows, visible = ds.getAuthRows(comments, "authuser")
+	assert.Len(t, rows, numComments)
+	assert.True(t, visible[comment])
+	assert.Len(t, index.rows[TableServices], expect)
+
+	// reloading the config drops the index
+	ds.resetAuthCache()
+	ds.authLock.RLock()
+	_, cached = ds.authIndex.get("authuser")
+	ds.authLock.RUnlock()
+	assert.False(t, cached)
+
+	// unknown users are not indexed
+	rows, _ = ds.getAuthRows(store, "nobody")
+	assert.Empty(t, rows)
+	ds.authLock.RLock()
+	_, cached = ds.authIndex.get("nobody")
+	ds.authLock.RUnlock()
+	assert.False(t, cached)
+	ds.lock.Unlock()
+
+	err = cleanup()
+	require.NoError(t, err)
+}
@@ -130,7 +130,7 @@ func BenchmarkPeerUpdateServiceInsert(b *testing.B) {
 
 	b.StartTimer()
 	for range b.N {
-		res := peer.data.insertDeltaDataResult(2, res, meta, table)
+		res := peer.data.insertDeltaDataResult(context.TODO(), 2, res, meta, table)
 		if res != nil {
 			panic("Update failed")
 		}
@@ -0,0 +1,406 @@
+package lmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// ChangeStreamHeartbeatInterval sets the interval for keepalive messages on idle change streams.
+	ChangeStreamHeartbeatInterval = 10 * time.Second
+
+	// ChangeStreamTimeout sets the time after which a change stream without any message is considered broken.
+	ChangeStreamTimeout = 3 * ChangeStreamHeartbeatInterval
+
+	// ChangeStreamBufferSize sets the number of events buffered per subscriber before it gets dropped.
+	ChangeStreamBufferSize = 10000
+
+	// ChangeStreamMaxLineSize sets the maximum size of a single change event.
+	ChangeStreamMaxLineSize = 64 * 1024 * 1024
+)
+
+// ChangeEvent contains the changed values of a single data row.
+// Events without table are heartbeats.
+type ChangeEvent struct {
+	Data  map[string]interface{} `json:"data,omitempty"`
+	Peer  string                 `json:"peer,omitempty"`
+	Table string                 `json:"table,omitempty"`
+	Key   []string               `json:"key,omitempty"`
+	Time  float64                `json:"time"`
+}
+
+// ChangeStream distributes row changes to all subscribers.
+type ChangeStream struct {
+	broker *eventBroker[*ChangeEvent, *changeFilter]
+}
+
+// ChangeSubscriber is a single consumer of the change stream.
+type ChangeSubscriber = eventSubscriber[*ChangeEvent, *changeFilter]
+
+// changeFilter contains the backends and tables of a change stream subscriber, empty maps match everything.
+type changeFilter struct {
+	backends map[string]bool
+	tables   map[TableName]bool
+}
+
+// NewChangeStream creates a new change stream.
+func NewChangeStream() *ChangeStream {
+	return &ChangeStream{
+		broker: newEventBroker[*ChangeEvent, *changeFilter](),
+	}
+}
+
+// Subscribe adds a new subscriber for the given backends and tables, empty lists match everything.
+func (cs *ChangeStream) Subscribe(backends []string, tables []TableName) *ChangeSubscriber {
+	filter := &changeFilter{
+		backends: make(map[string]bool),
+		tables:   make(map[TableName]bool),
+	}
+	for _, b := range backends {
+		filter.backends[b] = true
+	}
+	for _, t := range tables {
+		filter.tables[t] = true
+	}
+
+	return cs.broker.subscribe(filter, ChangeStreamBufferSize)
+}
+
+// Unsubscribe removes the subscriber.
+func (cs *ChangeStream) Unsubscribe(sub *ChangeSubscriber) {
+	cs.broker.unsubscribe(sub)
+}
+
+// Wants returns true if any subscriber is interested in changes of this backend and table.
+func (cs *ChangeStream) Wants(peerKey string, table TableName) bool {
+	return cs.broker.wants(func(filter *changeFilter) bool {
+		return filter.matches(peerKey, table)
+	})
+}
+
+// Publish sends the event to all matching subscribers.
+// Subscribers which cannot keep up will be dropped.
+func (cs *ChangeStream) Publish(event *ChangeEvent, table TableName) {
+	cs.broker.publish(event, func(filter *changeFilter) bool {
+		return filter.matches(event.Peer, table)
+	})
+}
+
+func (f *changeFilter) matches(peerKey string, table TableName) bool {
+	if len(f.backends) > 0 && !f.backends[peerKey] {
+		return false
+	}
+	if len(f.tables) > 0 && !f.tables[table] {
+		return false
+	}
+
+	return true
+}
+
+// publishChange sends the updated columns of this row to the change stream.
+func (d *DataRow) publishChange(columns ColumnList, timestamp float64) {
+	store := d.DataStore
+	if store == nil || store.Peer == nil || store.Peer.lmd == nil || store.Peer.lmd.changeStream == nil {
+		return
+	}
+	if len(store.Table.PrimaryKey) == 0 {
+		return
+	}
+	changeStream := store.Peer.lmd.changeStream
+	if !changeStream.Wants(store.PeerKey, store.Table.Name) {
+		return
+	}
+
+	event := &ChangeEvent{
+		Peer:  store.PeerKey,
+		Table: store.Table.Name.String(),
+		Key:   make([]string, 0, len(store.Table.PrimaryKey)),
+		Data:  make(map[string]interface{}, len(columns)),
+		Time:  timestamp,
+	}
+	for _, key := range store.Table.PrimaryKey {
+		event.Key = append(event.Key, d.GetStringByName(key))
+	}
+	for _, col := range columns {
+		if col.StorageType != LocalStore {
+			continue
+		}
+		event.Data[col.Name] = d.GetValueByColumn(col)
+	}
+	changeStream.Publish(event, store.Table.Name)
+}
+
+// redact returns a copy of the event with all redaction rules applied.
+func (event *ChangeEvent) redact(redaction *RequestRedaction) *ChangeEvent {
+	tableName, err := NewTableName(event.Table)
+	if err != nil {
+		return event
+	}
+	table, ok := Objects.Tables[tableName]
+	if !ok {
+		return event
+	}
+	redacted := *event
+	redacted.Data = redaction.redactChangeData(table, event.Data)
+
+	return &redacted
+}
+
+// ApplyChangeEvent updates the referenced row with the values from the change event.
+// The event is applied as generation, like regular delta updates, so state events are published as well.
+// Unknown tables, rows and columns are skipped, they will be synced by the next regular update.
+func (ds *DataStoreSet) ApplyChangeEvent(event *ChangeEvent) error {
+	tableName, err := NewTableName(event.Table)
+	if err != nil {
+		log.Debugf("skipping change event for unknown table %s", event.Table)
+
+		return nil
+	}
+	store := ds.Get(tableName)
+	if store == nil {
+		return nil
+	}
+
+	columns := make(ColumnList, 0, len(store.DynamicColumnCache))
+	values := make([]interface{}, 0, len(store.DynamicColumnCache))
+	for _, col := range store.DynamicColumnCache {
+		if val, ok := event.Data[col.Name]; ok {
+			columns = append(columns, col)
+			values = append(values, val)
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	ds.lock.RLock()
+	var row *DataRow
+	switch len(event.Key) {
+	case 1:
+		row = store.Index[event.Key[0]]
+	case 2:
+		row = store.Index2[event.Key[0]][event.Key[1]]
+	}
+	ds.lock.RUnlock()
+	if row == nil {
+		return nil
+	}
+
+	return ds.commitGeneration(&dataGeneration{updates: []*pendingUpdate{{
+		store:     store,
+		updateSet: []*ResultPrepared{{DataRow: row, ResultRow: values, FullUpdate: true}},
+		columns:   columns,
+		timestamp: event.Time,
+	}}})
+}
+
+// stream streams row changes as json lines till the client disconnects.
+// The stream contains all rows of all backends, so it is not available for api tokens or
+// client certificates restricted to an AuthUser or ACL, nor if an ACL applies to requests without AuthUser.
+// Redaction rules apply as for requests without AuthUser.
+func (c *HTTPServerController) stream(wrt http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	if isRestrictedHTTPAuth(request.Context()) || NewRequestACL(c.lmd, "") != nil {
+		log.Warnf("change stream request from %s rejected: restricted to authuser or acl", request.RemoteAddr)
+		httpErrorOutput(fmt.Errorf("forbidden: change stream requires unrestricted access"), wrt, http.StatusForbidden)
+
+		return
+	}
+	redaction := NewRequestRedaction(c.lmd, "")
+
+	var backends []string
+	if val := request.URL.Query().Get("backends"); val != "" {
+		backends = strings.Split(val, ",")
+	}
+	var tables []TableName
+	if val := request.URL.Query().Get("tables"); val != "" {
+		for _, name := range strings.Split(val, ",") {
+			table, err := NewTableName(name)
+			if err != nil {
+				c.errorOutput(err, wrt)
+
+				return
+			}
+			tables = append(tables, table)
+		}
+	}
+
+	sub := c.lmd.changeStream.Subscribe(backends, tables)
+	defer c.lmd.changeStream.Unsubscribe(sub)
+	log.Debugf("change stream subscriber connected from %s", request.RemoteAddr)
+
+	encoder := json.NewEncoder(wrt)
+	stream := &eventStream[*ChangeEvent]{
+		name:      "change stream",
+		heartbeat: ChangeStreamHeartbeatInterval,
+		keepalive: func() error {
+			return encoder.Encode(&ChangeEvent{Time: currentUnixTime()})
+		},
+		write: func(event *ChangeEvent) error {
+			if redaction != nil {
+				event = event.redact(redaction)
+			}
+
+			return encoder.Encode(event)
+		},
+	}
+	wrt.Header().Set("Content-Type", "application/x-ndjson")
+	ctrl := stream.start(wrt)
+	stream.run(request, ctrl, sub.events, sub.dropped)
+}
+
+// startChangeStream starts consuming the change stream of the remote lmd unless it is already running.
+func (p *Peer) startChangeStream(ctx context.Context) {
+	p.lock.Lock()
+	if p.stream.running {
+		p.lock.Unlock()
+
+		return
+	}
+	p.stream.running = true
+	p.lock.Unlock()
+
+	go func() {
+		// make sure we log panics properly
+		defer logPanicExitPeer(p)
+		p.runChangeStream(ctx)
+	}()
+}
+
+// runChangeStream consumes the change stream and reconnects after errors till the context is done.
+// Sub peers use regular delta updates while the stream is not connected.
+func (p *Peer) runChangeStream(ctx context.Context) {
+	defer func() {
+		p.lock.Lock()
+		p.stream.running = false
+		p.stream.connected = false
+		p.lock.Unlock()
+	}()
+
+	for {
+		err := p.consumeChangeStream(ctx)
+		p.lock.Lock()
+		p.stream.connected = false
+		p.lock.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		logWith(p).Infof("change stream from %s broken, falling back to delta updates: %s", p.Config.StreamSource, err.Error())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(p.lmd.Config.UpdateInterval) * time.Second):
+		}
+	}
+}
+
+// consumeChangeStream connects to the change stream and applies all received changes to the sub peers.
+// It returns when the stream breaks.
+func (p *Peer) consumeChangeStream(ctx context.Context) (err error) {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// only hosts and services are taken from the stream, all other tables use regular updates
+	streamURL := strings.TrimSuffix(p.Config.StreamSource, "/") + "/stream?tables=hosts,services"
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, streamURL, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("http request: %w", err)
+	}
+	if p.Config.Auth != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Config.Auth)
+	}
+
+	tlsConfig, err := p.getTLSClientConfig()
+	if err != nil {
+		return err
+	}
+	client := NewLMDHTTPClient(tlsConfig, p.Config.Proxy)
+	client.Timeout = 0 // streams never end, stalled streams are detected by the missing heartbeat
+
+	response, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("http error: %s", err.Error())
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return &PeerError{msg: fmt.Sprintf("http request failed: %s", response.Status), kind: ResponseError}
+	}
+
+	watchdog := time.AfterFunc(ChangeStreamTimeout, cancel)
+	defer watchdog.Stop()
+
+	p.lock.Lock()
+	p.stream.connected = true
+	p.stream.since = currentUnixTime()
+	p.lock.Unlock()
+	logWith(p).Infof("receiving changes from %s", streamURL)
+
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), ChangeStreamMaxLineSize)
+	for scanner.Scan() {
+		watchdog.Reset(ChangeStreamTimeout)
+		event := &ChangeEvent{}
+		err = json.Unmarshal(scanner.Bytes(), event)
+		if err != nil {
+			return fmt.Errorf("json error: %s", err.Error())
+		}
+		if event.Table == "" {
+			continue
+		}
+		err = p.applyChangeEvent(event)
+		if err != nil {
+			return err
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("io error: %s", err.Error())
+	}
+
+	return fmt.Errorf("stream closed by remote site")
+}
+
+// applyChangeEvent passes the change event to the sub peer it belongs to.
+func (p *Peer) applyChangeEvent(event *ChangeEvent) error {
+	p.lmd.PeerMapLock.RLock()
+	subPeer, ok := p.lmd.PeerMap[event.Peer]
+	p.lmd.PeerMapLock.RUnlock()
+	if !ok || subPeer.ParentID != p.ID {
+		return nil
+	}
+
+	data, err := subPeer.GetDataStoreSet()
+	if err != nil {
+		// sub peer is not ready yet, it will be synced by regular updates
+		return nil //nolint:nilerr // not an error of the stream
+	}
+
+	return data.ApplyChangeEvent(event)
+}
+
+// isStreamingChanges returns true if hosts and services of this sub peer are updated by the change
+// stream of its parent. The last delta update must have happened after the stream got connected,
+// otherwise changes in between would be missed.
+func (p *Peer) isStreamingChanges(lastUpdate float64) bool {
+	if p.ParentID == "" || !p.HasFlag(LMDSub) || lastUpdate <= 0 {
+		return false
+	}
+
+	p.lmd.PeerMapLock.RLock()
+	parent, ok := p.lmd.PeerMap[p.ParentID]
+	p.lmd.PeerMapLock.RUnlock()
+	if !ok {
+		return false
+	}
+
+	parent.lock.RLock()
+	defer parent.lock.RUnlock()
+
+	return parent.stream.connected && parent.stream.since <= lastUpdate-float64(p.lmd.Config.UpdateOffset)
+}
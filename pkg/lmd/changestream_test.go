@@ -0,0 +1,123 @@
+package lmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeStreamSubscribe(t *testing.T) {
+	changeStream := NewChangeStream()
+	assert.Falsef(t, changeStream.Wants("id1", TableHosts), "no subscribers")
+
+	sub := changeStream.Subscribe([]string{"id1"}, []TableName{TableServices})
+	assert.Falsef(t, changeStream.Wants("id1", TableHosts), "table does not match")
+	assert.Falsef(t, changeStream.Wants("id2", TableServices), "backend does not match")
+	assert.Truef(t, changeStream.Wants("id1", TableServices), "subscriber matches")
+
+	changeStream.Publish(&ChangeEvent{Peer: "id1", Table: "services"}, TableServices)
+	assert.Lenf(t, sub.events, 1, "got event")
+
+	changeStream.Unsubscribe(sub)
+	assert.Falsef(t, changeStream.Wants("id1", TableServices), "subscriber removed")
+}
+
+func TestChangeStreamHTTP(t *testing.T) {
+	peer, cleanup, _ := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	server := NewTestHTTPServer(t, peer.lmd)
+
+	req, err := http.NewRequestWithContext(context.TODO(), http.MethodGet, server.URL+"/stream?tables=hosts", http.NoBody)
+	require.NoError(t, err)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// update first host with its current values
+	store := peer.data.Get(TableHosts)
+	row := store.Data[0]
+	values := make([]interface{}, 0, len(store.DynamicColumnCache))
+	for _, col := range store.DynamicColumnCache {
+		values = append(values, row.GetValueByColumn(col))
+	}
+	peer.data.lock.Lock()
+	err = row.UpdateValues(0, values, store.DynamicColumnCache, currentUnixTime())
+	peer.data.lock.Unlock()
+	require.NoError(t, err)
+
+	event := &ChangeEvent{}
+	scanner := bufio.NewScanner(res.Body)
+	for event.Table == "" && scanner.Scan() {
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), event))
+	}
+	assert.Equal(t, peer.ID, event.Peer)
+	assert.Equal(t, "hosts", event.Table)
+	assert.Equal(t, []string{row.GetStringByName("name")}, event.Key)
+
+	// apply changed event back to the store
+	event.Data["plugin_output"] = "changed by stream"
+	err = peer.data.ApplyChangeEvent(event)
+	require.NoError(t, err)
+	assert.Equal(t, "changed by stream", row.GetStringByName("plugin_output"))
+
+	// partial events update the given columns and publish state events
+	sub, _, _ := peer.lmd.stateEvents.Subscribe(0, false)
+	defer peer.lmd.stateEvents.Unsubscribe(sub)
+	state := row.GetInt64ByName("state")
+	err = peer.data.ApplyChangeEvent(&ChangeEvent{Peer: peer.ID, Table: "hosts", Key: event.Key, Time: event.Time, Data: map[string]interface{}{
+		"state":   state + 1,
+		"unknown": "value",
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, state+1, row.GetInt64ByName("state"))
+	assert.Equal(t, "changed by stream", row.GetStringByName("plugin_output"))
+	select {
+	case stateEvent := <-sub.events:
+		assert.Equal(t, state+1, stateEvent.State)
+	default:
+		assert.Fail(t, "no state event published")
+	}
+
+	// unknown tables are skipped
+	err = peer.data.ApplyChangeEvent(&ChangeEvent{Peer: peer.ID, Table: "unknown", Key: event.Key})
+	require.NoError(t, err)
+
+	err = cleanup()
+	require.NoError(t, err)
+}
+
+func TestChangeStreamAuth(t *testing.T) {
+	peer, cleanup, mocklmd, client := StartTestHTTPPeer(t, 1, 2, 9, redactTestConfig)
+
+	mocklmd.Config.APITokens = []APIToken{
+		{Name: "admin", Token: "admintoken"},
+		{Name: "user", Token: "usertoken", AuthUser: "authuser"},
+	}
+
+	// restricted tokens would see all rows
+	recorder := client.Send(http.MethodGet, "/stream", "", "Authorization: Bearer usertoken")
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	// events are redacted like requests without authuser
+	event := &ChangeEvent{Peer: peer.ID, Table: "hosts", Data: map[string]interface{}{
+		"name":                   "testhost_1",
+		"plugin_output":          "secret",
+		"custom_variable_names":  []string{"TEST", "OTHER"},
+		"custom_variable_values": []string{"1", "2"},
+	}}
+	redacted := event.redact(NewRequestRedaction(mocklmd, ""))
+	assert.Equal(t, "testhost_1", redacted.Data["name"])
+	assert.Equal(t, DefaultRedactReplacement, redacted.Data["plugin_output"])
+	assert.Equal(t, []string{"hidden", "2"}, redacted.Data["custom_variable_values"])
+	assert.Equal(t, "secret", event.Data["plugin_output"])
+
+	err := cleanup()
+	require.NoError(t, err)
+}
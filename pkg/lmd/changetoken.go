@@ -0,0 +1,106 @@
+package lmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+// ChangeToken returns a token which changes whenever the result of this request might have changed.
+// It is built from the LastUpdate of all involved backends, the request itself and the AuthUser.
+// An empty token is returned if changes cannot be tracked, ex.: for passthrough tables or in cluster
+// mode, where backends of other nodes are not updated locally.
+func (req *Request) ChangeToken() string {
+	if req.Command != "" || req.lmd == nil {
+		return ""
+	}
+	if table, ok := Objects.Tables[req.Table]; !ok || table.PassthroughOnly {
+		return ""
+	}
+	if req.lmd.nodeAccessor != nil && req.lmd.nodeAccessor.IsClustered() {
+		return ""
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%v\x00", req.String(), req.AuthUser, req.ACL())
+
+	peerKeys := make([]string, 0, len(req.BackendsMap))
+	for peerKey := range req.BackendsMap {
+		peerKeys = append(peerKeys, peerKey)
+	}
+	sort.Strings(peerKeys)
+	req.lmd.PeerMapLock.RLock()
+	for _, peerKey := range peerKeys {
+		peer, ok := req.lmd.PeerMap[peerKey]
+		if !ok {
+			fmt.Fprintf(hash, "%s:-\x00", peerKey)
+
+			continue
+		}
+		peer.lock.RLock()
+		fmt.Fprintf(hash, "%s:%f:%d\x00", peerKey, peer.LastUpdate, peer.PeerState)
+		peer.lock.RUnlock()
+	}
+	req.lmd.PeerMapLock.RUnlock()
+
+	return fmt.Sprintf("%x", hash.Sum(nil))[0:32]
+}
+
+// notModified returns true and remembers the current change token if the request has not changed
+// since the token the client sent.
+func (req *Request) notModified(clientToken string) bool {
+	req.changeToken = req.ChangeToken()
+
+	return req.changeToken != "" && req.changeToken == clientToken
+}
+
+// NewNotModifiedResponse returns the empty response for requests which did not change since the IfChangedSince token.
+func NewNotModifiedResponse(req *Request) *Response {
+	return &Response{
+		Code:    ReturnCodeNotModified,
+		Request: req,
+		Result:  make(ResultSet, 0),
+		Lock:    new(deadlock.RWMutex),
+	}
+}
+
+// httpETag returns the change token as quoted entity tag.
+func httpETag(token string) string {
+	if token == "" {
+		return ""
+	}
+
+	return `"` + token + `"`
+}
+
+// httpNotModified sets the ETag header and sends the not modified status if the result did not change.
+func httpNotModified(wrt http.ResponseWriter, etag string, status int) bool {
+	if etag != "" {
+		wrt.Header().Set("ETag", etag)
+	}
+	if status != http.StatusNotModified {
+		return false
+	}
+	wrt.WriteHeader(status)
+
+	return true
+}
+
+// httpETagMatch returns true if the If-None-Match header contains the entity tag.
+func httpETagMatch(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
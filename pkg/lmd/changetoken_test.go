@@ -0,0 +1,99 @@
+package lmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeTokenHTTP(t *testing.T) {
+	_, cleanup, mocklmd, client := StartTestHTTPPeer(t, 2, 10, 10, "")
+
+	// table query
+	body := `{"columns":["name","state"],"filter":["name = testhost_1"]}`
+	recorder := client.Send(http.MethodPost, "/table/hosts", body)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	etag := recorder.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	recorder = client.Send(http.MethodPost, "/table/hosts", body, "If-None-Match: "+etag)
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+	assert.Empty(t, recorder.Body.String())
+	assert.Equal(t, etag, recorder.Header().Get("ETag"))
+
+	recorder = client.Send(http.MethodPost, "/table/hosts", body, `If-None-Match: W/"other", `+etag)
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+
+	// different requests and users get different tags
+	recorder = client.Send(http.MethodPost, "/table/hosts", `{"columns":["name"],"filter":["name = testhost_1"]}`, "If-None-Match: "+etag)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = client.Send(http.MethodPost, "/table/hosts", `{"columns":["name","state"],"filter":["name = testhost_1"],"authuser":"authuser"}`, "If-None-Match: "+etag)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotEqual(t, etag, recorder.Header().Get("ETag"))
+
+	// updated backends change the tag
+	mocklmd.PeerMapLock.RLock()
+	updated := mocklmd.PeerMap["mockid1"]
+	mocklmd.PeerMapLock.RUnlock()
+	updated.statusSetLocked(LastUpdate, interface2float64(updated.statusGetLocked(LastUpdate))+1)
+	recorder = client.Send(http.MethodPost, "/table/hosts", body, "If-None-Match: "+etag)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotEqual(t, etag, recorder.Header().Get("ETag"))
+
+	// but not if the backend is not part of the request
+	body = `{"columns":["name"],"backends":["mockid0"]}`
+	etag = client.Send(http.MethodPost, "/table/hosts", body).Header().Get("ETag")
+	updated.statusSetLocked(LastUpdate, interface2float64(updated.statusGetLocked(LastUpdate))+1)
+	recorder = client.Send(http.MethodPost, "/table/hosts", body, "If-None-Match: "+etag)
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+
+	// rest endpoints
+	recorder = client.Send(http.MethodGet, "/hosts?columns=name", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	etag = recorder.Header().Get("ETag")
+	recorder = client.Send(http.MethodGet, "/hosts?columns=name", "", "If-None-Match: "+etag)
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+	recorder = client.Send(http.MethodGet, "/hosts/testhost_1?columns=name", "", "If-None-Match: *")
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+
+	// passthrough tables cannot be tracked
+	recorder = client.Send(http.MethodPost, "/table/log", `{"columns":["time"],"limit":1}`, "If-None-Match: *")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("ETag"))
+
+	err := cleanup()
+	require.NoError(t, err)
+}
+
+func TestChangeTokenLivestatus(t *testing.T) {
+	_, cleanup, _, client := StartTestHTTPPeer(t, 1, 10, 10, "")
+	query := func(body string) string {
+		return client.Send(http.MethodPost, "/livestatus", body).Body.String()
+	}
+
+	// the change token is part of the wrapped_json result
+	request := "GET hosts\nColumns: name\nOutputFormat: wrapped_json\nResponseHeader: fixed16\n"
+	answer := query(request + "\n")
+	require.True(t, strings.HasPrefix(answer, "200 "))
+	res := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(answer[16:]), &res))
+	token, _ := res["change_token"].(string)
+	require.NotEmpty(t, token)
+
+	// and can be sent back to get an empty result if nothing changed
+	answer = query(request + "IfChangedSince: " + token + "\n\n")
+	require.True(t, strings.HasPrefix(answer, "304 "))
+	res = map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(answer[16:]), &res))
+	assert.Empty(t, res["data"])
+	assert.Equal(t, token, res["change_token"])
+
+	assert.Contains(t, query("GET hosts\nColumns: name\nIfChangedSince: invalid\nResponseHeader: fixed16\n\n"), "200 ")
+
+	err := cleanup()
+	require.NoError(t, err)
+}
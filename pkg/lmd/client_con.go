@@ -2,19 +2,28 @@ package lmd
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/sasha-s/go-deadlock"
 )
 
 const (
 	ReturnCodeOK              = 200
 	ReturnCodeCommandDelayed  = 202
+	ReturnCodeNotModified     = 304
 	ReturnCodeBadRequest      = 400
+	ReturnCodeForbidden       = 403
+	ReturnCodeNotFound        = 404
+	ReturnCodeConflict        = 409
+	ReturnCodeTooManyRequests = 429
 	ReturnCodeInternalError   = 500
 	ReturnCodeConnectionError = 502
 )
@@ -29,6 +38,8 @@ type ClientConnection struct {
 	curRequest            *Request
 	localAddr             string
 	remoteAddr            string
+	authUser              string // AuthUser from the tls client certificate
+	listen                string // connection string of the listener which accepted this connection
 	listenTimeout         int
 	logSlowQueryThreshold int
 	logHugeQueryThreshold int
@@ -36,10 +47,11 @@ type ClientConnection struct {
 }
 
 // NewClientConnection creates a new client connection object.
-func NewClientConnection(lmd *Daemon, c net.Conn, listenTimeout, logSlowThreshold, logHugeThreshold int, qStat *QueryStats) *ClientConnection {
+func NewClientConnection(lmd *Daemon, c net.Conn, listen string, listenTimeout, logSlowThreshold, logHugeThreshold int, qStat *QueryStats) *ClientConnection {
 	clCon := &ClientConnection{
 		lmd:                   lmd,
 		connection:            c,
+		listen:                listen,
 		localAddr:             c.LocalAddr().String(),
 		remoteAddr:            c.RemoteAddr().String(),
 		keepAlive:             false,
@@ -91,6 +103,10 @@ func (cl *ClientConnection) Handle() {
 // answer handles a single client connection.
 // It returns any error encountered.
 func (cl *ClientConnection) answer(ctx context.Context) error {
+	ctx, err := cl.authenticate(ctx)
+	if err != nil {
+		return cl.sendErrorResponse(err)
+	}
 	for {
 		if !cl.keepAlive {
 			promFrontendConnections.WithLabelValues(cl.localAddr).Inc()
@@ -131,6 +147,28 @@ func (cl *ClientConnection) answer(ctx context.Context) error {
 	}
 }
 
+// authenticate sets the AuthUser from the client certificate of tls connections if TLSClientAuthUser is enabled.
+func (cl *ClientConnection) authenticate(ctx context.Context) (context.Context, error) {
+	source := cl.lmd.Config.TLSClientAuthUser
+	tlsConn, ok := cl.connection.(*tls.Conn)
+	if source == "" || !ok {
+		return ctx, nil
+	}
+	LogErrors(cl.connection.SetDeadline(time.Now().Add(RequestReadTimeout)))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return ctx, fmt.Errorf("tls handshake: %w", err)
+	}
+	state := tlsConn.ConnectionState()
+	authUser, err := tlsClientAuthUser(&state, source)
+	if err != nil {
+		return ctx, err
+	}
+	cl.authUser = authUser
+	logWith(cl).Debugf("client certificate authenticated as %s", authUser)
+
+	return context.WithValue(ctx, CtxAuthUser, authUser), nil
+}
+
 // sendErrorResponse creates response for all given requests.
 func (cl *ClientConnection) sendErrorResponse(err error) error {
 	var netErr net.Error
@@ -160,29 +198,117 @@ func (cl *ClientConnection) processRequests(ctx context.Context, reqs []*Request
 		cl.curRequest = nil
 	}()
 	commandsByPeer := make(map[string][]string)
+	auditEntries := make([]*AuditEntry, 0)
+	// queued commands hold their request slots until they are sent
+	var commandsRelease []func()
+	releaseCommands := func() {
+		for _, release := range commandsRelease {
+			release()
+		}
+		commandsRelease = nil
+	}
+	defer releaseCommands()
+	sendCommands := func(ctx context.Context) error {
+		defer releaseCommands()
+
+		return cl.sendRemainingCommands(ctx, &commandsByPeer, &auditEntries)
+	}
 	for _, req := range reqs {
 		cl.keepAlive = req.KeepAlive
 		cl.curRequest = req
 		reqctx := context.WithValue(ctx, CtxRequest, req.ID())
 		time1 := time.Now()
 		if req.Command != "" {
-			for _, pID := range req.BackendsMap {
+			if adminReq, aErr := parseRequestPeerAdmin(req); adminReq != nil || aErr != nil {
+				if err = sendCommands(reqctx); err != nil {
+					return err
+				}
+				ok, pErr := cl.processPeerAdmin(reqctx, req, adminReq, aErr, &commandsByPeer, &auditEntries)
+				if !ok {
+					return pErr
+				}
+
+				continue
+			}
+			release, cErr := cl.lmd.admitRequest(cl.remoteAddr, req.AuthUser, cl.listen)
+			if cErr != nil && len(commandsRelease) > 0 {
+				// the queued commands may hold the last free slots, so send them and try again
+				if err = sendCommands(reqctx); err != nil {
+					return err
+				}
+				release, cErr = cl.lmd.admitRequest(cl.remoteAddr, req.AuthUser, cl.listen)
+			}
+			var backends []string
+			if cErr == nil {
+				commandsRelease = append(commandsRelease, release)
+				backends, cErr = cl.lmd.authorizeCommand(req, cl.listen)
+			}
+			if cErr != nil {
+				var commandErr *CommandError
+				var limitErr *LimitError
+				code := ReturnCodeInternalError
+				switch {
+				case errors.As(cErr, &commandErr):
+					code = commandErr.code
+				case errors.As(cErr, &limitErr):
+					code = ReturnCodeTooManyRequests
+				}
+				logWith(reqctx).Warnf("rejected command from %s: %s", cl.remoteAddr, cErr.Error())
+				// commands queued so far are authorized already and still sent
+				err = sendCommands(reqctx)
+				if err != nil {
+					return err
+				}
+				cl.lmd.audit(&AuditEntry{
+					Action:   AuditActionCommand,
+					Client:   cl.remoteAddr,
+					AuthUser: req.AuthUser,
+					Command:  strings.TrimSpace(req.Command),
+					Message:  cErr.Error(),
+					Code:     code,
+				})
+				_, err = fmt.Fprintf(cl.connection, "%d: %s\n", code, cErr.Error())
+
+				return err
+			}
+			for _, pID := range backends {
 				commandsByPeer[pID] = append(commandsByPeer[pID], strings.TrimSpace(req.Command))
 			}
+			auditEntries = append(auditEntries, &AuditEntry{
+				Time:     time1,
+				Action:   AuditActionCommand,
+				Client:   cl.remoteAddr,
+				AuthUser: req.AuthUser,
+				Peers:    backends,
+				Command:  strings.TrimSpace(req.Command),
+			})
 
 			continue
 		}
 
 		// send all pending commands so far
-		err = cl.sendRemainingCommands(reqctx, &commandsByPeer)
+		err = sendCommands(reqctx)
 		if err != nil {
 			return err
 		}
 
+		release, lErr := cl.lmd.admitRequest(cl.remoteAddr, req.AuthUser, cl.listen)
+		if lErr != nil {
+			// only this request is rejected, keepalive connections stay open for further requests
+			logWith(reqctx).Warnf("rejected request from %s: %s", cl.remoteAddr, lErr.Error())
+			LogErrors((&Response{Code: ReturnCodeTooManyRequests, Request: req, Error: lErr}).Send(cl))
+			if !req.KeepAlive {
+				return nil
+			}
+
+			continue
+		}
+
 		LogErrors(cl.connection.SetDeadline(time.Now().Add(time.Duration(cl.listenTimeout) * time.Second)))
 
 		var size int64
 		size, err = cl.processRequest(ctx, req)
+		release()
 
 		duration := time.Since(time1)
 		logWith(reqctx).Infof("%s client request finished in %s, response size: %s", req.Table.String(), duration.String(), byteCountBinary(size))
@@ -204,7 +330,7 @@ func (cl *ClientConnection) processRequests(ctx context.Context, reqs []*Request
 	}
 
 	// send all remaining commands
-	err = cl.sendRemainingCommands(ctx, &commandsByPeer)
+	err = sendCommands(ctx)
 	if err != nil {
 		return err
 	}
@@ -217,6 +343,13 @@ func (cl *ClientConnection) processRequest(ctx context.Context, req *Request) (s
 	defer func() {
 		cl.curRequest = nil
 	}()
+	if req.IfChangedSince != "" || req.OutputFormat == OutputFormatWrappedJSON {
+		if req.notModified(req.IfChangedSince) {
+			logWith(ctx, req).Debugf("result not modified since %s", req.IfChangedSince)
+
+			return NewNotModifiedResponse(req).Send(cl)
+		}
+	}
 	size, err = req.BuildResponseSend(ctx, cl)
 	if err != nil {
 		var netErr net.Error
@@ -240,15 +373,45 @@ func (cl *ClientConnection) processRequest(ctx context.Context, req *Request) (s
 	return
 }
 
-// sendRemainingCommands sends all queued commands.
-func (cl *ClientConnection) sendRemainingCommands(ctx context.Context, commandsByPeer *map[string][]string) (err error) {
+// sendRemainingCommands sends all queued commands and writes their result to the audit log.
+func (cl *ClientConnection) sendRemainingCommands(ctx context.Context, commandsByPeer *map[string][]string, auditEntries *[]*AuditEntry) (err error) {
 	if len(*commandsByPeer) == 0 {
+		// commands without any selected backend
+		for _, entry := range *auditEntries {
+			entry.Code = ReturnCodeOK
+			entry.Message = "no backends selected"
+			cl.lmd.audit(entry)
+		}
+		*auditEntries = make([]*AuditEntry, 0)
+
 		return
 	}
 	time1 := time.Now()
-	code, msg := cl.SendCommands(ctx, *commandsByPeer)
+	results, sErr := cl.SendCommands(ctx, *commandsByPeer)
+	code, msg := ReturnCodeInternalError, ""
+	if sErr != nil {
+		msg = sErr.Error()
+	} else {
+		code, msg = aggregateCommandResults(results)
+	}
+	duration := time.Since(time1).Seconds()
+	for _, entry := range *auditEntries {
+		switch {
+		case sErr != nil:
+			entry.Code = code
+			entry.Message = msg
+		case len(entry.Peers) == 0:
+			entry.Code = ReturnCodeOK
+			entry.Message = "no backends selected"
+		default:
+			entry.setCommandResults(results)
+		}
+		entry.Duration = duration
+		cl.lmd.audit(entry)
+	}
 	// clear the commands queue
 	*commandsByPeer = make(map[string][]string)
+	*auditEntries = make([]*AuditEntry, 0)
 	if code != ReturnCodeOK {
 		_, err = fmt.Fprintf(cl.connection, "%d: %s\n", code, msg)
 
@@ -260,49 +423,101 @@ func (cl *ClientConnection) sendRemainingCommands(ctx context.Context, commandsB
 }
 
 // SendCommands sends commands for this request to all selected remote sites.
-// It returns any error encountered.
-func (cl *ClientConnection) SendCommands(ctx context.Context, commandsByPeer map[string][]string) (code int, msg string) {
-	code = ReturnCodeOK
-	msg = "OK"
+// It returns the result for each backend or any error encountered.
+func (cl *ClientConnection) SendCommands(ctx context.Context, commandsByPeer map[string][]string) (map[string]*CommandPeerResult, error) {
 	if cl.lmd.flags.flagImport != "" {
-		return ReturnCodeInternalError, "lmd started with -import from file, cannot send commands without real backend connection."
+		return nil, fmt.Errorf("lmd started with -import from file, cannot send commands without real backend connection")
 	}
-	resultChan := make(chan error, len(commandsByPeer))
+
+	return cl.lmd.sendPeerCommands(ctx, commandsByPeer), nil
+}
+
+// CommandPeerResult contains the result of sending commands to a single backend.
+type CommandPeerResult struct {
+	WaitConditionMet *bool  `json:"wait_condition_met,omitempty"`
+	Name             string `json:"name"`
+	Node             string `json:"node,omitempty"`
+	Message          string `json:"message"`
+	Code             int    `json:"code"`
+}
+
+// sendPeerCommands sends the commands to all given backends in parallel and returns the result for each backend.
+// Backends which did not finish within the PeerCommandTimeout are marked as delayed, sending continues in background.
+func (lmd *Daemon) sendPeerCommands(ctx context.Context, commandsByPeer map[string][]string) map[string]*CommandPeerResult {
+	lock := new(deadlock.Mutex)
+	results := make(map[string]*CommandPeerResult, len(commandsByPeer))
 	wgroup := &sync.WaitGroup{}
-	for pID := range commandsByPeer {
-		cl.lmd.PeerMapLock.RLock()
-		peer := cl.lmd.PeerMap[pID]
-		cl.lmd.PeerMapLock.RUnlock()
+	for pID, commands := range commandsByPeer {
+		lmd.PeerMapLock.RLock()
+		peer := lmd.PeerMap[pID]
+		lmd.PeerMapLock.RUnlock()
+		if peer == nil {
+			results[pID] = &CommandPeerResult{Name: pID, Code: ReturnCodeBadRequest, Message: fmt.Sprintf("bad request: backend %s does not exist", pID)}
+
+			continue
+		}
+		result := &CommandPeerResult{Name: peer.Name, Code: ReturnCodeCommandDelayed, Message: "sending command timed out but will continue in background"}
+		results[pID] = result
 		wgroup.Add(1)
-		go func(peer *Peer) {
+		go func(peer *Peer, commands []string) {
 			defer logPanicExitPeer(peer)
 			defer wgroup.Done()
-			resultChan <- peer.SendCommandsWithRetry(ctx, commandsByPeer[peer.ID])
-		}(peer)
+			code, msg := commandResult(peer.SendCommandsWithRetry(ctx, commands))
+			lock.Lock()
+			result.Code = code
+			result.Message = msg
+			lock.Unlock()
+		}(peer, commands)
 	}
 
 	// Wait up to 9.5 seconds for all commands being sent
-	if waitTimeout(ctx, wgroup, PeerCommandTimeout) {
-		return ReturnCodeCommandDelayed, "sending command timed out but will continue in background"
+	waitTimeout(ctx, wgroup, PeerCommandTimeout)
+
+	// return copies, delayed commands might finish later
+	lock.Lock()
+	defer lock.Unlock()
+	copies := make(map[string]*CommandPeerResult, len(results))
+	for pID, result := range results {
+		res := *result
+		copies[pID] = &res
 	}
 
-	// collect errors
-	for {
-		select {
-		case err := <-resultChan:
-			var commandErr *PeerCommandError
-			switch {
-			case errors.As(err, &commandErr):
-				code = commandErr.code
-				msg = commandErr.Error()
-			default:
-				if err != nil {
-					code = ReturnCodeInternalError
-					msg = err.Error()
-				}
-			}
-		default:
-			return code, msg
+	return copies
+}
+
+// commandResult converts the error from sending commands into a return code and message.
+func commandResult(err error) (code int, msg string) {
+	if err == nil {
+		return ReturnCodeOK, "OK"
+	}
+	var commandErr *PeerCommandError
+	if errors.As(err, &commandErr) {
+		return commandErr.code, commandErr.Error()
+	}
+
+	return ReturnCodeInternalError, err.Error()
+}
+
+// aggregateCommandResults returns the combined return code and message of all backends.
+// Delayed commands take precedence over errors, because the final result is unknown.
+func aggregateCommandResults(results map[string]*CommandPeerResult) (code int, msg string) {
+	code = ReturnCodeOK
+	msg = "OK"
+	peerKeys := make([]string, 0, len(results))
+	for pID := range results {
+		peerKeys = append(peerKeys, pID)
+	}
+	sort.Strings(peerKeys)
+	for _, pID := range peerKeys {
+		result := results[pID]
+		switch {
+		case result.Code == ReturnCodeCommandDelayed:
+			return result.Code, result.Message
+		case result.Code != ReturnCodeOK:
+			code = result.Code
+			msg = result.Message
 		}
 	}
+
+	return code, msg
 }
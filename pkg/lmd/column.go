@@ -42,6 +42,11 @@ var VirtualColumnList = []VirtualColumnMapEntry{
 	{Name: "federation_addr", StatusKey: SubAddr},
 	{Name: "federation_type", StatusKey: SubType},
 	{Name: "federation_version", StatusKey: SubVersion},
+	{Name: "source_mode", StatusKey: PeerSourceMode},
+	{Name: "source_addr", StatusKey: SourceAddr},
+	{Name: "source_status", StatusKey: SourceStatus},
+	{Name: "source_last_error", StatusKey: SourceLastError},
+	{Name: "source_active_queries", StatusKey: SourceActiveQueries},
 
 	// calculated columns by ResolveFunc
 	{Name: "lmd_last_cache_update", ResolveFunc: func(d *DataRow, _ *Column) interface{} { return d.LastUpdate }},
@@ -58,6 +63,7 @@ var VirtualColumnList = []VirtualColumnMapEntry{
 	{Name: "total_services", ResolveFunc: VirtualColTotalServices},
 	{Name: "flags", ResolveFunc: VirtualColFlags},
 	{Name: "localtime", ResolveFunc: VirtualColLocaltime},
+	{Name: "redacted", ResolveFunc: VirtualColRedacted},
 	{Name: "empty", ResolveFunc: func(_ *DataRow, _ *Column) interface{} { return "" }}, // return empty string as placeholder for nonexisting columns
 }
 
@@ -281,6 +287,7 @@ type Column struct {
 	RefCol          *Column                // reference to column in other table, ex.: host_alias
 	Table           *Table                 // // reference to the table holding this column
 	VirtualMap      *VirtualColumnMapEntry // reference to resolver for virtual columns
+	Redaction       *ColumnRedaction       // reference to the original column and rules for redacted columns
 	Name            string                 // name and primary key
 	Description     string                 // human description
 	Index           int                    // position in datastore
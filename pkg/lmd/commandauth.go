@@ -0,0 +1,216 @@
+package lmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CommandTarget describes the type of object an external command applies to.
+type CommandTarget uint8
+
+// available command targets.
+const (
+	CommandTargetGlobal CommandTarget = iota
+	CommandTargetHost
+	CommandTargetService
+	CommandTargetHostgroup
+	CommandTargetServicegroup
+	CommandTargetContact
+	CommandTargetContactgroup
+	CommandTargetDowntime
+	CommandTargetComment
+	CommandTargetUnknown
+)
+
+// keyArgs returns the number of leading command arguments naming the target object.
+func (t CommandTarget) keyArgs() int {
+	switch t {
+	case CommandTargetGlobal, CommandTargetUnknown:
+		return 0
+	case CommandTargetService:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// ExternalCommand contains a parsed external command.
+type ExternalCommand struct {
+	Name   string
+	Args   []string
+	Target CommandTarget
+}
+
+// ParseExternalCommand parses a command line like "COMMAND [123] ACKNOWLEDGE_HOST_PROBLEM;host;...".
+func ParseExternalCommand(command string) (cmd *ExternalCommand, err error) {
+	command = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(command), "COMMAND "))
+	if !strings.HasPrefix(command, "[") {
+		return nil, fmt.Errorf("bad request: invalid command: %s", command)
+	}
+	_, command, ok := strings.Cut(command, "]")
+	if !ok {
+		return nil, fmt.Errorf("bad request: invalid command: %s", command)
+	}
+	fields := strings.Split(strings.TrimSpace(command), ";")
+	cmd = &ExternalCommand{
+		Name: strings.ToUpper(fields[0]),
+		Args: fields[1:],
+	}
+	if cmd.Name == "" {
+		return nil, fmt.Errorf("bad request: missing command name")
+	}
+	cmd.Target = commandTarget(cmd.Name, len(cmd.Args))
+
+	return cmd, nil
+}
+
+// commandTarget returns the type of object the command applies to from the list of known commands.
+// Unknown commands without arguments cannot name any object and apply to the whole core.
+func commandTarget(name string, numArgs int) CommandTarget {
+	if target, ok := knownCommands[name]; ok {
+		return target
+	}
+	if numArgs == 0 {
+		return CommandTargetGlobal
+	}
+
+	return CommandTargetUnknown
+}
+
+// hasTarget returns true if the command applies to a single known object.
+func (cmd *ExternalCommand) hasTarget() bool {
+	return cmd.Target != CommandTargetGlobal && cmd.Target != CommandTargetUnknown
+}
+
+// CommandError is a custom error when a command is rejected before sending it to any remote site.
+type CommandError struct {
+	msg  string
+	code int
+}
+
+// Error returns the error message as string.
+func (e *CommandError) Error() string {
+	return e.msg
+}
+
+// authorizeCommand checks the command against the command allow lists of the listener and the ACL
+// and verifies the AuthUser is allowed to see the target object.
+// It returns the backends the command may be sent to.
+func (lmd *Daemon) authorizeCommand(req *Request, listen string) (backends []string, err error) {
+	cmd, err := lmd.checkCommandAllowed(req, listen)
+	if err != nil {
+		return nil, err
+	}
+
+	backends = make([]string, 0, len(req.BackendsMap))
+	for _, peerKey := range req.BackendsMap {
+		backends = append(backends, peerKey)
+	}
+	sort.Strings(backends)
+
+	if req.AuthUser == "" || !cmd.hasTarget() {
+		return backends, nil
+	}
+
+	allowed := lmd.commandTargetBackends(cmd, backends, req.AuthUser)
+	if len(allowed) == 0 {
+		return nil, &CommandError{msg: fmt.Sprintf("%s is not authorized for the target of command %s", req.AuthUser, cmd.Name), code: ReturnCodeForbidden}
+	}
+
+	return allowed, nil
+}
+
+// checkCommandAllowed parses the command of the request and checks it against the command
+// allow lists of the listener and the ACL of the AuthUser.
+func (lmd *Daemon) checkCommandAllowed(req *Request, listen string) (cmd *ExternalCommand, err error) {
+	cmd, err = ParseExternalCommand(req.Command)
+	if err != nil {
+		return nil, &CommandError{msg: err.Error(), code: ReturnCodeBadRequest}
+	}
+
+	if patterns, ok := lmd.Config.ListenerCommands[listen]; ok && !matchAnyPattern(patterns, cmd.Name) {
+		return nil, &CommandError{msg: fmt.Sprintf("command %s not allowed on this listener", cmd.Name), code: ReturnCodeForbidden}
+	}
+
+	// the target of unknown commands cannot be checked against the AuthUser
+	if req.AuthUser != "" && cmd.Target == CommandTargetUnknown {
+		return nil, &CommandError{msg: fmt.Sprintf("unknown command %s not allowed for %s", cmd.Name, req.AuthUser), code: ReturnCodeForbidden}
+	}
+
+	// requests without AuthUser are only restricted if an ACL applies, ex.: from an api token
+	acl := req.ACL()
+	if (req.AuthUser != "" || acl != nil) && !acl.AllowCommand(cmd.Name, cmd.Target == CommandTargetGlobal) {
+		return nil, &CommandError{msg: fmt.Sprintf("command %s not allowed", cmd.Name), code: ReturnCodeForbidden}
+	}
+
+	return cmd, nil
+}
+
+// commandTargetBackends returns the backends which contain the target object of the command.
+// If authUser is set, the object must be visible for this user as well.
+func (lmd *Daemon) commandTargetBackends(cmd *ExternalCommand, backends []string, authUser string) []string {
+	found := make([]string, 0, len(backends))
+	for _, peerKey := range backends {
+		lmd.PeerMapLock.RLock()
+		peer := lmd.PeerMap[peerKey]
+		lmd.PeerMapLock.RUnlock()
+		if peer != nil && peer.isCommandTargetVisible(cmd, authUser) {
+			found = append(found, peerKey)
+		}
+	}
+
+	return found
+}
+
+// isCommandTargetVisible returns true if the target object of the command exists and is visible for the user.
+// Without a user, only the existence of the object is checked.
+func (p *Peer) isCommandTargetVisible(cmd *ExternalCommand, authUser string) bool {
+	var tableName TableName
+	switch cmd.Target {
+	case CommandTargetHost:
+		tableName = TableHosts
+	case CommandTargetService:
+		tableName = TableServices
+	case CommandTargetHostgroup:
+		tableName = TableHostgroups
+	case CommandTargetServicegroup:
+		tableName = TableServicegroups
+	case CommandTargetContact:
+		tableName = TableContacts
+	case CommandTargetContactgroup:
+		tableName = TableContactgroups
+	case CommandTargetDowntime:
+		tableName = TableDowntimes
+	case CommandTargetComment:
+		tableName = TableComments
+	default:
+		return false
+	}
+
+	data, err := p.GetDataStoreSet()
+	if err != nil {
+		return false
+	}
+	data.lock.RLock()
+	defer data.lock.RUnlock()
+	store := data.tables[tableName]
+	if store == nil {
+		return false
+	}
+
+	if len(cmd.Args) < cmd.Target.keyArgs() {
+		return false
+	}
+	var row *DataRow
+	if cmd.Target == CommandTargetService {
+		row = store.Index2[cmd.Args[0]][cmd.Args[1]]
+	} else {
+		row = store.Index[cmd.Args[0]]
+	}
+	if row == nil {
+		return false
+	}
+
+	return row.checkAuth(authUser)
+}
@@ -0,0 +1,145 @@
+package lmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExternalCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		name    string
+		target  CommandTarget
+	}{
+		{"COMMAND [0] DISABLE_NOTIFICATIONS", "DISABLE_NOTIFICATIONS", CommandTargetGlobal},
+		{"COMMAND [0] START_EXECUTING_SVC_CHECKS", "START_EXECUTING_SVC_CHECKS", CommandTargetGlobal},
+		{"COMMAND [0] CHANGE_GLOBAL_HOST_EVENT_HANDLER;cmd", "CHANGE_GLOBAL_HOST_EVENT_HANDLER", CommandTargetGlobal},
+		{"COMMAND [0] ACKNOWLEDGE_HOST_PROBLEM;host;1;1;1;user;comment", "ACKNOWLEDGE_HOST_PROBLEM", CommandTargetHost},
+		{"COMMAND [0] SCHEDULE_HOST_SVC_DOWNTIME;host;0;1;1;0;0;user;comment", "SCHEDULE_HOST_SVC_DOWNTIME", CommandTargetHost},
+		{"COMMAND [0] DEL_DOWNTIME_BY_HOST_NAME;host", "DEL_DOWNTIME_BY_HOST_NAME", CommandTargetHost},
+		{"COMMAND [0] PROCESS_SERVICE_CHECK_RESULT;host;svc;0;ok", "PROCESS_SERVICE_CHECK_RESULT", CommandTargetService},
+		{"COMMAND [0] schedule_svc_check;host;svc;0", "SCHEDULE_SVC_CHECK", CommandTargetService},
+		{"COMMAND [0] SCHEDULE_HOSTGROUP_HOST_DOWNTIME;group;0;1;1;0;0;user;comment", "SCHEDULE_HOSTGROUP_HOST_DOWNTIME", CommandTargetHostgroup},
+		{"COMMAND [0] ENABLE_SERVICEGROUP_SVC_NOTIFICATIONS;group", "ENABLE_SERVICEGROUP_SVC_NOTIFICATIONS", CommandTargetServicegroup},
+		{"COMMAND [0] CHANGE_CONTACT_HOST_NOTIFICATION_TIMEPERIOD;contact;24x7", "CHANGE_CONTACT_HOST_NOTIFICATION_TIMEPERIOD", CommandTargetContact},
+		{"COMMAND [0] ENABLE_CONTACTGROUP_HOST_NOTIFICATIONS;group", "ENABLE_CONTACTGROUP_HOST_NOTIFICATIONS", CommandTargetContactgroup},
+		{"COMMAND [0] DEL_SVC_DOWNTIME;12", "DEL_SVC_DOWNTIME", CommandTargetDowntime},
+		{"COMMAND [0] DEL_HOST_COMMENT;12", "DEL_HOST_COMMENT", CommandTargetComment},
+		{"COMMAND [0] DEL_DOWNTIME_BY_HOSTGROUP_NAME;group", "DEL_DOWNTIME_BY_HOSTGROUP_NAME", CommandTargetHostgroup},
+		{"COMMAND [0] LMD_PAUSE_PEER;id", "LMD_PAUSE_PEER", CommandTargetGlobal},
+		{"COMMAND [0] CUSTOM_COMMAND", "CUSTOM_COMMAND", CommandTargetGlobal},
+		{"COMMAND [0] CUSTOM_HOST_COMMAND;host", "CUSTOM_HOST_COMMAND", CommandTargetUnknown},
+	}
+	for _, test := range tests {
+		cmd, err := ParseExternalCommand(test.command)
+		require.NoError(t, err)
+		assert.Equalf(t, test.name, cmd.Name, "command: %s", test.command)
+		assert.Equalf(t, test.target, cmd.Target, "command: %s", test.command)
+	}
+
+	_, err := ParseExternalCommand("COMMAND TEST")
+	require.Error(t, err)
+}
+
+func TestCommandAuthorization(t *testing.T) {
+	peer, cleanup, mocklmd := StartTestPeer(2, 2, 2)
+	PauseTestPeers(peer)
+
+	res, _, err := peer.QueryString("GET hosts\nColumns: name\nAuthUser: authuser\nBackends: mockid0\n\n")
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	visibleHost := interface2stringNoDedup(res[0][0])
+	res, _, err = peer.QueryString(fmt.Sprintf("GET hosts\nColumns: name\nFilter: name != %s\nBackends: mockid0\n\n", visibleHost))
+	require.NoError(t, err)
+	require.NotEmpty(t, res)
+	hiddenHost := interface2stringNoDedup(res[0][0])
+
+	authorize := func(query, listen string) ([]string, int) {
+		req, _, err2 := NewRequest(context.TODO(), mocklmd, bufio.NewReader(bytes.NewBufferString(query)), ParseDefault)
+		require.NoError(t, err2)
+		require.NoError(t, req.ExpandRequestedBackends())
+		backends, err2 := mocklmd.authorizeCommand(req, listen)
+		if err2 != nil {
+			var commandErr *CommandError
+			require.ErrorAs(t, err2, &commandErr)
+
+			return nil, commandErr.code
+		}
+
+		return backends, ReturnCodeOK
+	}
+
+	// commands without AuthUser are not restricted
+	backends, code := authorize("COMMAND [0] DISABLE_NOTIFICATIONS\n\n", "")
+	assert.Equal(t, ReturnCodeOK, code)
+	assert.Equal(t, []string{"mockid0", "mockid1"}, backends)
+
+	// visible target object
+	backends, code = authorize(fmt.Sprintf("COMMAND [0] SCHEDULE_HOST_CHECK;%s;0\nAuthUser: authuser\nBackends: mockid0\n\n", visibleHost), "")
+	assert.Equal(t, ReturnCodeOK, code)
+	assert.Equal(t, []string{"mockid0"}, backends)
+
+	// hidden and unknown target objects
+	_, code = authorize(fmt.Sprintf("COMMAND [0] SCHEDULE_HOST_CHECK;%s;0\nAuthUser: authuser\nBackends: mockid0\n\n", hiddenHost), "")
+	assert.Equal(t, ReturnCodeForbidden, code)
+
+	_, code = authorize("COMMAND [0] SCHEDULE_HOST_CHECK;unknown;0\nAuthUser: authuser\n\n", "")
+	assert.Equal(t, ReturnCodeForbidden, code)
+
+	_, code = authorize("COMMAND [0] SCHEDULE_SVC_CHECK;unknown\nAuthUser: authuser\n\n", "")
+	assert.Equal(t, ReturnCodeForbidden, code)
+
+	// unknown commands cannot be checked for AuthUsers
+	_, code = authorize(fmt.Sprintf("COMMAND [0] CUSTOM_HOST_COMMAND;%s\nAuthUser: authuser\nBackends: mockid0\n\n", visibleHost), "")
+	assert.Equal(t, ReturnCodeForbidden, code)
+
+	backends, code = authorize(fmt.Sprintf("COMMAND [0] CUSTOM_HOST_COMMAND;%s\n\n", visibleHost), "")
+	assert.Equal(t, ReturnCodeOK, code)
+	assert.Equal(t, []string{"mockid0", "mockid1"}, backends)
+
+	// global commands must be allowed explicitly
+	_, code = authorize("COMMAND [0] DISABLE_NOTIFICATIONS\nAuthUser: authuser\n\n", "")
+	assert.Equal(t, ReturnCodeForbidden, code)
+
+	mocklmd.Config.ACL = []ACL{{Name: "operators", Users: []string{"authuser"}, Commands: []string{"DISABLE_NOTIFICATIONS", "SCHEDULE_*"}}}
+	_, code = authorize("COMMAND [0] DISABLE_NOTIFICATIONS\nAuthUser: authuser\n\n", "")
+	assert.Equal(t, ReturnCodeOK, code)
+
+	_, code = authorize(fmt.Sprintf("COMMAND [0] ACKNOWLEDGE_HOST_PROBLEM;%s;1;1;1;authuser;test\nAuthUser: authuser\nBackends: mockid0\n\n", visibleHost), "")
+	assert.Equal(t, ReturnCodeForbidden, code)
+
+	// acls apply to requests without AuthUser as well
+	mocklmd.Config.ACL = []ACL{{Name: "anonymous", Users: []string{""}, Commands: []string{"SCHEDULE_*"}}}
+	_, code = authorize("COMMAND [0] DISABLE_NOTIFICATIONS\n\n", "")
+	assert.Equal(t, ReturnCodeForbidden, code)
+
+	mocklmd.Config.ACL = nil
+
+	// listener allow list
+	mocklmd.Config.ListenerCommands = map[string][]string{"test.sock": {"SCHEDULE_*"}}
+	_, code = authorize("COMMAND [0] DISABLE_NOTIFICATIONS\n\n", "test.sock")
+	assert.Equal(t, ReturnCodeForbidden, code)
+
+	_, code = authorize("COMMAND [0] DISABLE_NOTIFICATIONS\n\n", "other.sock")
+	assert.Equal(t, ReturnCodeOK, code)
+
+	// rejected commands are answered with the livestatus error code
+	_, _, err = peer.QueryString("COMMAND [0] DISABLE_NOTIFICATIONS\n\n")
+	require.Error(t, err)
+	var peerCmdErr *PeerCommandError
+	if errors.As(err, &peerCmdErr) {
+		assert.Equal(t, ReturnCodeForbidden, peerCmdErr.code)
+	}
+	assert.Contains(t, err.Error(), "not allowed on this listener")
+
+	mocklmd.Config.ListenerCommands = nil
+	err = cleanup()
+	require.NoError(t, err)
+}
@@ -4,8 +4,10 @@ import (
 	"crypto/tls"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/BurntSushi/toml"
@@ -14,21 +16,24 @@ import (
 
 // Connection defines a single connection configuration.
 type Connection struct {
-	TLSCertificate string   `toml:"tlscertificate"`
-	Name           string   `toml:"name"`
-	Proxy          string   `toml:"proxy"`
-	Auth           string   `toml:"auth"`
-	RemoteName     string   `toml:"remote_name"`
-	Section        string   `toml:"section"`
-	ID             string   `toml:"id"`
-	TLSKey         string   `toml:"tlskey"`
-	TLSServerName  string   `toml:"tlsservername"`
-	TLSCA          string   `toml:"tlsca"`
-	Source         []string `toml:"source"`
-	Fallback       []string `toml:"fallback"`
-	Flags          []string `toml:"flags"`
-	TLSSkipVerify  int      `toml:"tlsskipverify"`
-	NoConfigTool   int      `toml:"noconfigtool"` // skip adding config tool to sites query
+	TLSCertificate string   `json:"tlscertificate,omitempty" toml:"tlscertificate,omitempty"`
+	Name           string   `json:"name,omitempty"           toml:"name,omitempty"`
+	Proxy          string   `json:"proxy,omitempty"          toml:"proxy,omitempty"`
+	Auth           string   `json:"auth,omitempty"           toml:"auth,omitempty"`
+	RemoteName     string   `json:"remote_name,omitempty"    toml:"remote_name,omitempty"`
+	StreamSource   string   `json:"stream_source,omitempty"  toml:"stream_source,omitempty"` // http address of a remote lmd to receive pushed changes from
+	SourceMode     string   `json:"source_mode,omitempty"    toml:"source_mode,omitempty"`   // failover, roundrobin or leastconn
+	Section        string   `json:"section,omitempty"        toml:"section,omitempty"`
+	ID             string   `json:"id"                       toml:"id"`
+	TLSKey         string   `json:"tlskey,omitempty"         toml:"tlskey,omitempty"`
+	TLSServerName  string   `json:"tlsservername,omitempty"  toml:"tlsservername,omitempty"`
+	TLSCA          string   `json:"tlsca,omitempty"          toml:"tlsca,omitempty"`
+	Source         []string `json:"source"                   toml:"source"`
+	Fallback       []string `json:"fallback,omitempty"       toml:"fallback,omitempty"`
+	Flags          []string `json:"flags,omitempty"          toml:"flags,omitempty"`
+	TLSSkipVerify  int      `json:"tlsskipverify,omitempty"  toml:"tlsskipverify,omitempty"`
+	NoConfigTool   int      `json:"noconfigtool,omitempty"   toml:"noconfigtool,omitempty"` // skip adding config tool to sites query
+	Paused         bool     `json:"paused,omitempty"         toml:"paused,omitempty"`       // do not start the connection until resumed
 }
 
 // Equals checks if two connection objects are identical.
@@ -44,6 +49,9 @@ func (c *Connection) Equals(other *Connection) bool {
 	equal = equal && c.TLSCA == other.TLSCA
 	equal = equal && c.TLSSkipVerify == other.TLSSkipVerify
 	equal = equal && c.NoConfigTool == other.NoConfigTool
+	equal = equal && c.StreamSource == other.StreamSource
+	equal = equal && c.SourceMode == other.SourceMode
+	equal = equal && c.Paused == other.Paused
 	equal = equal && strings.Join(c.Source, ":") == strings.Join(other.Source, ":")
 	equal = equal && strings.Join(c.Fallback, ":") == strings.Join(other.Fallback, ":")
 	equal = equal && strings.Join(c.Flags, ":") == strings.Join(other.Flags, ":")
@@ -51,6 +59,44 @@ func (c *Connection) Equals(other *Connection) bool {
 	return equal
 }
 
+// ACL defines restrictions for matching users or contact groups.
+type ACL struct {
+	Name        string   `toml:"name"`
+	Users       []string `toml:"users"`        // user name patterns
+	Groups      []string `toml:"groups"`       // contact group names
+	Backends    []string `toml:"backends"`     // allowed backend id, name or section patterns, empty allows all
+	Tables      []string `toml:"tables"`       // allowed tables, empty allows all
+	DenyColumns []string `toml:"deny_columns"` // denied column name patterns
+	Commands    []string `toml:"commands"`     // allowed command name patterns, empty allows all
+}
+
+// RedactRule hides sensitive parts of column values and custom variables from all users except exempt ones.
+type RedactRule struct {
+	regex           *regexp.Regexp
+	Name            string   `toml:"name"`
+	Pattern         string   `toml:"pattern"`          // regular expression of the hidden parts, empty hides the whole value
+	Replacement     string   `toml:"replacement"`      // replacement for hidden parts, defaults to ***
+	Columns         []string `toml:"columns"`          // column name patterns
+	CustomVariables []string `toml:"custom_variables"` // custom variable name patterns
+	ExemptUsers     []string `toml:"exempt_users"`     // user name patterns which see plain values, "" matches requests without AuthUser
+	ExemptGroups    []string `toml:"exempt_groups"`    // contact groups which see plain values
+}
+
+// RequestLimit defines the rate and concurrency limits for a single client, user or listener.
+type RequestLimit struct {
+	Rate       float64 `toml:"rate"`       // requests per second, 0 disables the rate limit
+	Burst      int     `toml:"burst"`      // requests allowed at once before the rate applies, defaults to the rate
+	Concurrent int     `toml:"concurrent"` // concurrently running queries, 0 disables the limit
+}
+
+// APIToken maps a token for the http api to an AuthUser and optional ACL.
+type APIToken struct {
+	Name     string `toml:"name"`     // used in logs instead of the token itself
+	Token    string `toml:"token"`    // sent as bearer token or X-API-Key header
+	AuthUser string `toml:"authuser"` // forced AuthUser for all requests, empty allows all
+	ACL      string `toml:"acl"`      // name of the ACL applied to all requests
+}
+
 type configFiles []string
 
 // String returns the config files list as string.
@@ -73,39 +119,58 @@ func (c *configFiles) Set(value string) (err error) {
 
 // Config defines the available configuration options from supplied config files.
 type Config struct {
-	GroupAuthorization         string       `toml:"GroupAuthorization"`
-	LogFile                    string       `toml:"LogFile"`
-	TLSCertificate             string       `toml:"TLSCertificate"`
-	TLSMinVersion              string       `toml:"TLSMinVersion"`
-	ServiceAuthorization       string       `toml:"ServiceAuthorization"`
-	TLSKey                     string       `toml:"TLSKey"`
-	LogLevel                   string       `toml:"LogLevel"`
-	ListenPrometheus           string       `toml:"ListenPrometheus"`
-	Connections                []Connection `toml:"Connections"`
-	Nodes                      []string     `toml:"Nodes"`
-	Listen                     []string     `toml:"Listen"`
-	TLSClientPems              []string     `toml:"TLSClientPems"`
-	StaleBackendTimeout        int          `toml:"StaleBackendTimeout"`
-	LogHugeQueryThreshold      int          `toml:"LogHugeQueryThreshold"`
-	NetTimeout                 int          `toml:"NetTimeout"`
-	ListenTimeout              int          `toml:"ListenTimeout"`
-	UpdateInterval             int64        `toml:"Updateinterval"`
-	MaxQueryFilter             int          `toml:"MaxQueryFilter"`
-	ConnectTimeout             int          `toml:"ConnectTimeout"`
-	IdleTimeout                int64        `toml:"IdleTimeout"`
-	IdleInterval               int64        `toml:"IdleInterval"`
-	FullUpdateInterval         int64        `toml:"FullUpdateInterval"`
-	MaxParallelPeerConnections int          `toml:"MaxParallelPeerConnections"`
-	SkipSSLCheck               int          `toml:"SkipSSLCheck"`
-	LogSlowQueryThreshold      int          `toml:"LogSlowQueryThreshold"`
-	UpdateOffset               int64        `toml:"UpdateOffset"`
-	CompressionMinimumSize     int          `toml:"CompressionMinimumSize"`
-	CompressionLevel           int          `toml:"CompressionLevel"`
-	MaxClockDelta              float64      `toml:"MaxClockDelta"`
-	SyncIsExecuting            bool         `toml:"SyncIsExecuting"`
-	SaveTempRequests           bool         `toml:"SaveTempRequests"`
-	BackendKeepAlive           bool         `toml:"BackendKeepAlive"`
-	LogQueryStats              bool         `toml:"LogQueryStats"`
+	GroupAuthorization         string              `toml:"GroupAuthorization"`
+	LogFile                    string              `toml:"LogFile"`
+	AuditLog                   string              `toml:"AuditLog"`
+	TLSCertificate             string              `toml:"TLSCertificate"`
+	TLSMinVersion              string              `toml:"TLSMinVersion"`
+	TLSClientAuthUser          string              `toml:"TLSClientAuthUser"` // derive AuthUser from client certificates: cn, email or dns
+	ServiceAuthorization       string              `toml:"ServiceAuthorization"`
+	TLSKey                     string              `toml:"TLSKey"`
+	LogLevel                   string              `toml:"LogLevel"`
+	ListenPrometheus           string              `toml:"ListenPrometheus"`
+	NodeToken                  string              `toml:"NodeToken"`
+	PeerAdminConfig            string              `toml:"PeerAdminConfig"` // config file to persist runtime peer changes, must be included with -c
+	Connections                []Connection        `toml:"Connections"`
+	ACL                        []ACL               `toml:"ACL"`
+	APITokens                  []APIToken          `toml:"APIToken"`
+	Redact                     []RedactRule        `toml:"Redact"`
+	ListenerCommands           map[string][]string `toml:"ListenerCommands"` // allowed command name patterns by listener
+	LimitClient                RequestLimit        `toml:"LimitClient"`      // limits per remote ip address
+	LimitUser                  RequestLimit        `toml:"LimitUser"`        // limits per AuthUser
+	LimitListener              RequestLimit        `toml:"LimitListener"`    // limits per listener
+	Nodes                      []string            `toml:"Nodes"`
+	Listen                     []string            `toml:"Listen"`
+	WebSocketOrigins           []string            `toml:"WebSocketOrigins"` // allowed origin patterns for websocket connections
+	TLSClientPems              []string            `toml:"TLSClientPems"`
+	StaleBackendTimeout        int                 `toml:"StaleBackendTimeout"`
+	LogHugeQueryThreshold      int                 `toml:"LogHugeQueryThreshold"`
+	NetTimeout                 int                 `toml:"NetTimeout"`
+	ListenTimeout              int                 `toml:"ListenTimeout"`
+	UpdateInterval             int64               `toml:"Updateinterval"`
+	MaxQueryFilter             int                 `toml:"MaxQueryFilter"`
+	ConnectTimeout             int                 `toml:"ConnectTimeout"`
+	IdleTimeout                int64               `toml:"IdleTimeout"`
+	IdleInterval               int64               `toml:"IdleInterval"`
+	FullUpdateInterval         int64               `toml:"FullUpdateInterval"`
+	MaxParallelPeerConnections int                 `toml:"MaxParallelPeerConnections"`
+	SkipSSLCheck               int                 `toml:"SkipSSLCheck"`
+	LogSlowQueryThreshold      int                 `toml:"LogSlowQueryThreshold"`
+	UpdateOffset               int64               `toml:"UpdateOffset"`
+	LogCacheWindow             int64               `toml:"LogCacheWindow"`
+	CompressionMinimumSize     int                 `toml:"CompressionMinimumSize"`
+	CompressionLevel           int                 `toml:"CompressionLevel"`
+	MaxClockDelta              float64             `toml:"MaxClockDelta"`
+	PassthroughHedgePercentile float64             `toml:"PassthroughHedgePercentile"`
+	PassthroughHedgeMinDelay   int                 `toml:"PassthroughHedgeMinDelay"`
+	ReadinessPeersUp           float64             `toml:"ReadinessPeersUp"`      // percentage of peers which must be up for /readyz
+	LivenessUpdateTimeout      int64               `toml:"LivenessUpdateTimeout"` // seconds without update before /healthz fails
+	SyncIsExecuting            bool                `toml:"SyncIsExecuting"`
+	SaveTempRequests           bool                `toml:"SaveTempRequests"`
+	BackendKeepAlive           bool                `toml:"BackendKeepAlive"`
+	LogQueryStats              bool                `toml:"LogQueryStats"`
+	PeerAdmin                  bool                `toml:"PeerAdmin"`                 // enable runtime peer administration by http api and LMD_* commands
+	StrictObjectAuthorization  bool                `toml:"StrictObjectAuthorization"` // restrict contacts, contactgroups and commands by AuthUser
 }
 
 // NewConfig reads all config files.
@@ -135,11 +200,17 @@ func NewConfig(files []string) *Config {
 		TLSMinVersion:              "tls1.1",
 		MaxParallelPeerConnections: 3,
 		MaxQueryFilter:             DefaultMaxQueryFilter,
+		PassthroughHedgeMinDelay:   100,
+		ReadinessPeersUp:           50,
+		LivenessUpdateTimeout:      300,
 	}
 
 	// combine listeners from all files
 	allListeners := make([]string, 0)
 	allConnections := make([]Connection, 0)
+	allACL := make([]ACL, 0)
+	allAPITokens := make([]APIToken, 0)
+	allRedact := make([]RedactRule, 0)
 	for _, pattern := range files {
 		configFiles, errGlob := filepath.Glob(pattern)
 		if errGlob != nil {
@@ -164,10 +235,19 @@ func NewConfig(files []string) *Config {
 			conf.Listen = []string{}
 			allConnections = append(allConnections, conf.Connections...)
 			conf.Connections = []Connection{}
+			allACL = append(allACL, conf.ACL...)
+			conf.ACL = []ACL{}
+			allAPITokens = append(allAPITokens, conf.APITokens...)
+			conf.APITokens = []APIToken{}
+			allRedact = append(allRedact, conf.Redact...)
+			conf.Redact = []RedactRule{}
 		}
 	}
 	conf.Listen = allListeners
 	conf.Connections = allConnections
+	conf.ACL = allACL
+	conf.APITokens = allAPITokens
+	conf.Redact = allRedact
 
 	for num := range conf.Connections {
 		for j := range conf.Connections[num].Source {
@@ -239,10 +319,127 @@ func (conf *Config) ValidateConfig() {
 		log.Warnf("config: UpdateOffset invalid, value must be greater than 0")
 		conf.UpdateOffset = 3
 	}
+	if conf.PassthroughHedgePercentile < 0 || conf.PassthroughHedgePercentile >= 100 {
+		log.Warnf("config: PassthroughHedgePercentile invalid, value must be between 0 and 100")
+		conf.PassthroughHedgePercentile = 0
+	}
+	if conf.LogCacheWindow < 0 {
+		log.Warnf("config: LogCacheWindow invalid, value must be greater than 0")
+		conf.LogCacheWindow = 0
+	}
+	if conf.PassthroughHedgeMinDelay < 0 {
+		log.Warnf("config: PassthroughHedgeMinDelay invalid, value must be greater than 0")
+		conf.PassthroughHedgeMinDelay = DefaultConfig.PassthroughHedgeMinDelay
+	}
+	if conf.ReadinessPeersUp < 0 || conf.ReadinessPeersUp > 100 {
+		log.Warnf("config: ReadinessPeersUp invalid, value must be between 0 and 100")
+		conf.ReadinessPeersUp = DefaultConfig.ReadinessPeersUp
+	}
+	if conf.LivenessUpdateTimeout < 0 {
+		log.Warnf("config: LivenessUpdateTimeout invalid, value must be greater than 0")
+		conf.LivenessUpdateTimeout = DefaultConfig.LivenessUpdateTimeout
+	}
+	switch conf.TLSClientAuthUser {
+	case "", TLSClientAuthUserCN, TLSClientAuthUserEmail, TLSClientAuthUserDNS:
+	default:
+		log.Warnf("config: TLSClientAuthUser invalid, value must be one of: cn, email or dns")
+		conf.TLSClientAuthUser = ""
+	}
+	if conf.TLSClientAuthUser != "" && len(conf.TLSClientPems) == 0 {
+		log.Warnf("config: TLSClientAuthUser requires TLSClientPems, all tls client connections will be rejected")
+	}
 	_, err := parseTLSMinVersion(conf.TLSMinVersion)
 	if err != nil {
 		log.Warnf("%s", err)
 	}
+	for i := range conf.Connections {
+		con := &conf.Connections[i]
+		if _, err := NewSourceMode(con.SourceMode); err != nil {
+			log.Warnf("config: connection %s: %s", con.Name, err)
+			con.SourceMode = SourceModeFailover.String()
+		}
+	}
+	conf.validateACL()
+	conf.validateAPITokens()
+	conf.validateRedact()
+	for name, limit := range map[string]*RequestLimit{"LimitClient": &conf.LimitClient, "LimitUser": &conf.LimitUser, "LimitListener": &conf.LimitListener} {
+		if limit.Rate < 0 || limit.Burst < 0 || limit.Concurrent < 0 {
+			log.Warnf("config: %s must not be negative, limit disabled", name)
+			*limit = RequestLimit{}
+		}
+	}
+}
+
+// validateACL warns about invalid patterns and unknown tables in all ACLs.
+// Invalid entries never match, so they do not widen the permissions.
+func (conf *Config) validateACL() {
+	for i := range conf.ACL {
+		acl := &conf.ACL[i]
+		if len(acl.Users) == 0 && len(acl.Groups) == 0 && acl.Name == "" {
+			log.Warnf("config: ACL #%d has neither users, groups nor a name and will never match", i)
+		}
+		for _, patterns := range [][]string{acl.Users, acl.Backends, acl.DenyColumns, acl.Commands} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					log.Warnf("config: ACL %s: invalid pattern %s: %s", acl.Name, pattern, err)
+				}
+			}
+		}
+		for _, table := range acl.Tables {
+			if _, err := NewTableName(table); err != nil {
+				log.Warnf("config: ACL %s: %s", acl.Name, err)
+			}
+		}
+	}
+}
+
+// validateAPITokens warns about tokens without value and unknown ACLs.
+// Such tokens never match, but still enable authentication for the http api.
+func (conf *Config) validateAPITokens() {
+	for i := range conf.APITokens {
+		token := &conf.APITokens[i]
+		if token.Name == "" {
+			token.Name = fmt.Sprintf("#%d", i)
+		}
+		if token.Token == "" {
+			log.Warnf("config: APIToken %s has no token and will never match", token.Name)
+		}
+		if token.ACL != "" && !slices.ContainsFunc(conf.ACL, func(acl ACL) bool { return acl.Name == token.ACL }) {
+			log.Warnf("config: APIToken %s: unknown ACL %s, all requests will be rejected", token.Name, token.ACL)
+		}
+	}
+}
+
+// validateRedact compiles the patterns of all redaction rules.
+// Rules with invalid patterns hide the whole value, so they do not reveal anything.
+func (conf *Config) validateRedact() {
+	for i := range conf.Redact {
+		rule := &conf.Redact[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("#%d", i)
+		}
+		if len(rule.Columns) == 0 && len(rule.CustomVariables) == 0 {
+			log.Warnf("config: Redact %s has neither columns nor custom_variables and will never match", rule.Name)
+		}
+		for _, patterns := range [][]string{rule.Columns, rule.CustomVariables, rule.ExemptUsers} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					log.Warnf("config: Redact %s: invalid pattern %s: %s", rule.Name, pattern, err)
+				}
+			}
+		}
+		rule.regex = nil
+		if rule.Pattern == "" {
+			continue
+		}
+		regex, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			log.Warnf("config: Redact %s: invalid pattern %s, hiding whole values: %s", rule.Name, rule.Pattern, err)
+
+			continue
+		}
+		rule.regex = regex
+	}
 }
 
 func (conf *Config) SetServiceAuthorization() {
@@ -4,7 +4,9 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"math"
+	"slices"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -60,6 +62,25 @@ func NewDataRow(store *DataStore, raw []interface{}, columns ColumnList, timesta
 	return
 }
 
+// snapshot returns a copy of this row which is not changed by later updates.
+// Values are replaced on update, so the stored values itself are shared.
+func (d *DataRow) snapshot() *DataRow {
+	return &DataRow{
+		DataStore:             d.DataStore,
+		Refs:                  maps.Clone(d.Refs),
+		dataInt64List:         slices.Clone(d.dataInt64List),
+		dataString:            slices.Clone(d.dataString),
+		dataInt:               slices.Clone(d.dataInt),
+		dataInt64:             slices.Clone(d.dataInt64),
+		dataFloat:             slices.Clone(d.dataFloat),
+		dataStringList:        slices.Clone(d.dataStringList),
+		dataServiceMemberList: slices.Clone(d.dataServiceMemberList),
+		dataStringLarge:       slices.Clone(d.dataStringLarge),
+		dataInterfaceList:     slices.Clone(d.dataInterfaceList),
+		LastUpdate:            d.LastUpdate,
+	}
+}
+
 // GetID calculates and returns the ID value (nul byte concatenated primary key values).
 func (d *DataRow) GetID() string {
 	if len(d.DataStore.Table.PrimaryKey) == 0 {
@@ -133,7 +154,7 @@ func (d *DataRow) SetData(raw []interface{}, columns ColumnList, timestamp float
 		}
 	}
 
-	return d.UpdateValues(0, raw, columns, timestamp)
+	return d.updateValues(0, raw, columns, timestamp)
 }
 
 // setLowerCaseCache sets lowercase columns.
@@ -483,6 +504,9 @@ func (d *DataRow) getVirtualRowValue(col *Column) interface{} {
 
 // GetCustomVarValue returns custom variable value for given name.
 func (d *DataRow) GetCustomVarValue(col *Column, name string) string {
+	if col.Redaction != nil {
+		return col.Redaction.redactCustomVar(name, d.GetCustomVarValue(col.Redaction.Column, name))
+	}
 	if col.StorageType == RefStore {
 		ref := d.Refs[col.RefColTableName]
 
@@ -837,11 +861,38 @@ func (d *DataRow) getStatsKey(res *Response) string {
 	return strings.Join(keyValues, ListSepChar1)
 }
 
-// UpdateValues updates this datarow with new values.
+// UpdateValues updates this datarow with new values and publishes the change to the change stream.
 func (d *DataRow) UpdateValues(dataOffset int, data []interface{}, columns ColumnList, timestamp float64) error {
+	err := d.updateValues(dataOffset, data, columns, timestamp)
+	if err != nil {
+		return err
+	}
+	d.publishChange(columns, d.LastUpdate)
+
+	return nil
+}
+
+// updateValues updates this datarow with new values.
+func (d *DataRow) updateValues(dataOffset int, data []interface{}, columns ColumnList, timestamp float64) error {
+	if err := d.checkValuesSize(dataOffset, data, columns); err != nil {
+		return err
+	}
+	d.setValues(dataOffset, data, columns, timestamp)
+
+	return nil
+}
+
+// checkValuesSize returns an error if the data does not match the given columns.
+func (d *DataRow) checkValuesSize(dataOffset int, data []interface{}, columns ColumnList) error {
 	if len(columns) != len(data)-dataOffset {
 		return fmt.Errorf("table %s update failed, data size mismatch, expected %d columns and got %d", d.DataStore.Table.Name.String(), len(columns), len(data))
 	}
+
+	return nil
+}
+
+// setValues updates this datarow with new values, the size of data must have been checked before.
+func (d *DataRow) setValues(dataOffset int, data []interface{}, columns ColumnList, timestamp float64) {
 	for idx, col := range columns {
 		localIndex := col.Index
 		if col.StorageType != LocalStore {
@@ -883,15 +934,21 @@ func (d *DataRow) UpdateValues(dataOffset int, data []interface{}, columns Colum
 		timestamp = currentUnixTime()
 	}
 	d.LastUpdate = timestamp
-
-	return nil
 }
 
 // UpdateValuesNumberOnly updates this datarow with new values but skips strings.
 func (d *DataRow) UpdateValuesNumberOnly(dataOffset int, data []interface{}, columns ColumnList, timestamp float64) error {
-	if len(columns) != len(data)-dataOffset {
-		return fmt.Errorf("table %s update failed, data size mismatch, expected %d columns and got %d", d.DataStore.Table.Name.String(), len(columns), len(data))
+	if err := d.checkValuesSize(dataOffset, data, columns); err != nil {
+		return err
 	}
+	d.setNumberValues(dataOffset, data, columns, timestamp)
+	d.publishChange(columns, timestamp)
+
+	return nil
+}
+
+// setNumberValues updates this datarow with new values but skips strings, the size of data must have been checked before.
+func (d *DataRow) setNumberValues(dataOffset int, data []interface{}, columns ColumnList, timestamp float64) {
 	for i, col := range columns {
 		localIndex := col.Index
 		resIndex := i + dataOffset
@@ -911,8 +968,6 @@ func (d *DataRow) UpdateValuesNumberOnly(dataOffset int, data []interface{}, col
 		}
 	}
 	d.LastUpdate = timestamp
-
-	return nil
 }
 
 // CheckChangedIntValues returns true if the given data results in an update.
@@ -1396,6 +1451,11 @@ func (d *DataRow) WriteJSONColumn(jsonwriter *jsoniter.Stream, col *Column) {
 
 		return
 	}
+	if col.Redaction != nil {
+		d.WriteJSONRedactedColumn(jsonwriter, col)
+
+		return
+	}
 	switch col.StorageType {
 	case LocalStore:
 		d.WriteJSONLocalColumn(jsonwriter, col)
@@ -1574,6 +1634,9 @@ func (d *DataRow) isAuthorizedFor(authUser, host, service string) (canView bool)
 				return true
 			}
 		}
+		if d.isAuthorizedForContactGroups(authUser, hostObj, dataSet.tables[TableHosts].GetColumn("contact_groups")) {
+			return true
+		}
 	}
 
 	// get contacts on services
@@ -1588,11 +1651,31 @@ func (d *DataRow) isAuthorizedFor(authUser, host, service string) (canView bool)
 				return true
 			}
 		}
+		if d.isAuthorizedForContactGroups(authUser, serviceObj, dataSet.tables[TableServices].GetColumn("contact_groups")) {
+			return true
+		}
 	}
 
 	return canView
 }
 
+// isAuthorizedForContactGroups returns true if the user is member of any contact group of given host or service.
+func (d *DataRow) isAuthorizedForContactGroups(authUser string, obj *DataRow, groupsColumn *Column) bool {
+	contactGroups := obj.GetStringList(groupsColumn)
+	if len(contactGroups) == 0 {
+		return false
+	}
+
+	userGroups := d.DataStore.DataSet.getContactGroups(authUser)
+	for _, group := range contactGroups {
+		if userGroups[group] {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (d *DataRow) isAuthorizedForHostGroup(authUser, hostgroup string) (canView bool) {
 	peer := d.DataStore.Peer
 	dataSet := d.DataStore.DataSet
@@ -1722,6 +1805,26 @@ func (d *DataRow) checkAuth(authUser string) (canView bool) {
 		hostName := d.dataString[hostIndex]
 		serviceDescription := d.dataString[serviceIndex]
 		canView = d.isAuthorizedFor(authUser, hostName, serviceDescription)
+	case TableContacts:
+		// like naemon, contacts and commands are visible for all users unless StrictObjectAuthorization is set
+		// contacts can only see themselves then
+		canView = !d.DataStore.Peer.lmd.Config.StrictObjectAuthorization || d.GetStringByName("name") == authUser
+	case TableContactgroups:
+		canView = !d.DataStore.Peer.lmd.Config.StrictObjectAuthorization || slices.Contains(d.GetStringListByName("members"), authUser)
+	case TableCommands:
+		// command lines might contain credentials
+		canView = !d.DataStore.Peer.lmd.Config.StrictObjectAuthorization
+	case TableLog:
+		canView = d.DataStore.DataSet.isAuthorizedForLogEntry(authUser,
+			d.GetStringByName("host_name"),
+			d.GetStringByName("service_description"),
+			d.GetStringListByName("current_host_contacts"),
+			d.GetStringListByName("current_service_contacts"),
+			d.DataStore.Peer.lmd.Config.ServiceAuthorization,
+		)
+	case TableTimeperiods, TableStatus:
+		// global information, visible for all users
+		canView = true
 	default:
 		canView = true
 	}
@@ -1729,6 +1832,50 @@ func (d *DataRow) checkAuth(authUser string) (canView bool) {
 	return canView
 }
 
+// isAuthorizedForLogEntry returns true if the user is allowed to see the log entry, either as contact at the time of
+// the entry or as member of a contact group of the current host or service. Entries without host, ex.: program messages,
+// are visible for all users. Contact groups are only checked if the data set is available, ds.lock must be held then.
+func (ds *DataStoreSet) isAuthorizedForLogEntry(authUser, host, service string, hostContacts, serviceContacts []string, serviceAuthorization string) bool {
+	if host == "" {
+		return true
+	}
+	if service != "" {
+		if slices.Contains(serviceContacts, authUser) || ds.isContactGroupMember(authUser, host, service) {
+			return true
+		}
+		if serviceAuthorization == AuthStrict {
+			return false
+		}
+	}
+
+	return slices.Contains(hostContacts, authUser) || ds.isContactGroupMember(authUser, host, "")
+}
+
+// isContactGroupMember returns true if the user is member of any contact group of the host or service. ds.lock must be held.
+func (ds *DataStoreSet) isContactGroupMember(authUser, host, service string) bool {
+	if ds == nil {
+		return false
+	}
+	var store *DataStore
+	var obj *DataRow
+	if service == "" {
+		store = ds.tables[TableHosts]
+		if store != nil {
+			obj = store.Index[host]
+		}
+	} else {
+		store = ds.tables[TableServices]
+		if store != nil {
+			obj = store.Index2[host][service]
+		}
+	}
+	if obj == nil {
+		return false
+	}
+
+	return obj.isAuthorizedForContactGroups(authUser, obj, store.GetColumn("contact_groups"))
+}
+
 func (d *DataRow) CountStats(stats, result []*Filter) {
 	for resultPos, stat := range stats {
 		if stat.StatsPos > 0 {
@@ -177,6 +177,9 @@ func (d *DataStore) InsertItem(index int, row *DataRow) {
 // AddItem adds an new DataRow to a DataStore.
 func (d *DataStore) AddItem(row *DataRow) {
 	d.Data = append(d.Data, row)
+	if d.DataSet != nil {
+		d.DataSet.updateAuthIndex(d, row, false)
+	}
 	switch len(d.Table.PrimaryKey) {
 	case 0:
 	case 1:
@@ -214,6 +217,9 @@ func (d *DataStore) RemoveItem(row *DataRow) {
 	for i := range d.Data {
 		if d.Data[i] == row {
 			d.Data = append(d.Data[:i], d.Data[i+1:]...)
+			if d.DataSet != nil {
+				d.DataSet.updateAuthIndex(d, row, true)
+			}
 
 			return
 		}
@@ -278,7 +284,30 @@ func (d *DataStore) GetWaitObject(req *Request) (*DataRow, bool) {
 type getPreFilteredDataFilter func(*DataStore, map[string]bool, *Filter) bool
 
 // GetPreFilteredData returns d.Data but try to return reduced dataset by using host / service index if table supports it.
-func (d *DataStore) GetPreFilteredData(filter []*Filter) []*DataRow {
+// If authUser is set and the table has an authorization index, only visible rows are returned and authChecked is true.
+func (d *DataStore) GetPreFilteredData(filter []*Filter, authUser string) (data []*DataRow, authChecked bool) {
+	if authUser == "" || !d.isAuthIndexed() {
+		return d.getPreFilteredData(filter), false
+	}
+
+	authRows, visible := d.DataSet.getAuthRows(d, authUser)
+	data = d.getPreFilteredData(filter)
+	if len(data) == len(d.Data) {
+		// no index used
+		return authRows, true
+	}
+
+	filtered := make([]*DataRow, 0, len(data))
+	for _, row := range data {
+		if visible[row] {
+			filtered = append(filtered, row)
+		}
+	}
+
+	return filtered, true
+}
+
+func (d *DataStore) getPreFilteredData(filter []*Filter) []*DataRow {
 	if len(filter) == 0 {
 		return d.Data
 	}
@@ -473,7 +502,8 @@ func (d *DataStore) TryFilterIndex(uniqHosts map[string]bool, filter []*Filter,
 			}
 			filterFound++
 		default:
-			if filterCb(d, uniqHosts, fil) {
+			// redacted columns must not be looked up by their plain values
+			if fil.Column.Redaction == nil && filterCb(d, uniqHosts, fil) {
 				filterFound++
 			} else if breakOnNoneIndexableFilter {
 				return false
@@ -3,6 +3,7 @@ package lmd
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -13,18 +14,45 @@ import (
 
 const missedTimestampMaxFilter = 150
 
+// AuthCacheSize sets the maximum number of users with cached authorization data per backend.
+const AuthCacheSize = 1000
+
 // DataStoreSet is a collection of data stores.
 type DataStoreSet struct {
-	peer   *Peer
-	lock   *deadlock.RWMutex
-	tables map[TableName]*DataStore
+	peer       *Peer
+	lock       *deadlock.RWMutex
+	tables     map[TableName]*DataStore
+	authLock   *deadlock.RWMutex          // lock for the authGroups and authIndex cache
+	authGroups *lruCache[map[string]bool] // cached contact groups by AuthUser
+	authIndex  *lruCache[*AuthIndex]      // precomputed visible rows by AuthUser
+}
+
+// dataGeneration collects delta updates of multiple tables which will be applied together,
+// so readers either see all or none of them.
+type dataGeneration struct {
+	updates []*pendingUpdate
+}
+
+// pendingUpdate contains a prepared update for a single table.
+type pendingUpdate struct {
+	store      *DataStore
+	resMeta    *ResultMetaData // nil for updates from the change stream
+	updateSet  []*ResultPrepared
+	columns    ColumnList // updated columns, defaults to the dynamic columns of the store
+	dataOffset int
+	resultSize int
+	timestamp  float64 // time of the update, defaults to the time of the commit
+	prepare    time.Duration
 }
 
 func NewDataStoreSet(peer *Peer) *DataStoreSet {
 	dataset := DataStoreSet{
-		lock:   new(deadlock.RWMutex),
-		tables: make(map[TableName]*DataStore),
-		peer:   peer,
+		lock:       new(deadlock.RWMutex),
+		tables:     make(map[TableName]*DataStore),
+		peer:       peer,
+		authLock:   new(deadlock.RWMutex),
+		authGroups: newLRUCache[map[string]bool](AuthCacheSize),
+		authIndex:  newLRUCache[*AuthIndex](AuthCacheSize),
 	}
 
 	return &dataset
@@ -35,6 +63,10 @@ func (ds *DataStoreSet) Set(name TableName, store *DataStore) {
 	ds.tables[name] = store
 	store.DataSet = ds
 	ds.lock.Unlock()
+
+	if name == TableContacts || name == TableContactgroups {
+		ds.resetAuthCache()
+	}
 }
 
 func (ds *DataStoreSet) Get(name TableName) *DataStore {
@@ -128,6 +160,58 @@ func (ds *DataStoreSet) SetReferences() (err error) {
 	return
 }
 
+// getContactGroups returns the contact groups of given user. Results are cached for existing contacts
+// and reset whenever the contacts or contact groups are replaced. ds.lock must be held.
+func (ds *DataStoreSet) getContactGroups(authUser string) map[string]bool {
+	ds.authLock.RLock()
+	groups, ok := ds.authGroups.get(authUser)
+	ds.authLock.RUnlock()
+	if ok {
+		return groups
+	}
+
+	groups = make(map[string]bool)
+	if !ds.isContact(authUser) {
+		// unknown users cannot be member of any group
+		return groups
+	}
+	store := ds.tables[TableContactgroups]
+	if store != nil {
+		nameCol := store.GetColumn("name")
+		membersCol := store.GetColumn("members")
+		for _, row := range store.Data {
+			if slices.Contains(row.GetStringList(membersCol), authUser) {
+				groups[row.GetString(nameCol)] = true
+			}
+		}
+	}
+
+	ds.authLock.Lock()
+	ds.authGroups.add(authUser, groups)
+	ds.authLock.Unlock()
+
+	return groups
+}
+
+// isContact returns true if a contact with given name exists. ds.lock must be held.
+func (ds *DataStoreSet) isContact(name string) bool {
+	store := ds.tables[TableContacts]
+	if store == nil {
+		return false
+	}
+	_, ok := store.Index[name]
+
+	return ok
+}
+
+// resetAuthCache removes all cached authorization data.
+func (ds *DataStoreSet) resetAuthCache() {
+	ds.authLock.Lock()
+	ds.authGroups.clear()
+	ds.authIndex.clear()
+	ds.authLock.Unlock()
+}
+
 func (ds *DataStoreSet) hasChanged(ctx context.Context) (changed bool) {
 	changed = false
 	tablenames := []TableName{TableCommands, TableContactgroups, TableContacts, TableHostgroups, TableHosts, TableServicegroups, TableTimeperiods}
@@ -199,6 +283,11 @@ func (ds *DataStoreSet) UpdateDelta(ctx context.Context, from, until float64) (e
 		return err
 	}
 
+	// hosts and services updates are applied as one generation, otherwise queries could see
+	// updated hosts along with outdated services
+	generation := &dataGeneration{}
+	genCtx := context.WithValue(ctx, CtxGeneration, generation)
+
 	updateOffset := float64(ds.peer.lmd.Config.UpdateOffset)
 	updateThreshold := int64(from - updateOffset)
 
@@ -219,11 +308,18 @@ func (ds *DataStoreSet) UpdateDelta(ctx context.Context, from, until float64) (e
 			}
 		}
 	}
-	err = ds.UpdateDeltaHosts(ctx, filterStr, true, updateThreshold)
-	if err != nil {
-		return err
+	// hosts and services are pushed by the change stream of the parent lmd
+	if !ds.peer.isStreamingChanges(from) {
+		err = ds.UpdateDeltaHosts(genCtx, filterStr, true, updateThreshold)
+		if err != nil {
+			return err
+		}
+		err = ds.UpdateDeltaServices(genCtx, filterStr, true, updateThreshold)
+		if err != nil {
+			return err
+		}
 	}
-	err = ds.UpdateDeltaServices(ctx, filterStr, true, updateThreshold)
+	err = ds.commitGeneration(generation)
 	if err != nil {
 		return err
 	}
@@ -307,11 +403,11 @@ func (ds *DataStoreSet) updateDeltaHostsServices(ctx context.Context, tableName
 	case TableHosts:
 		hostDataOffset := 1
 
-		return ds.insertDeltaDataResult(hostDataOffset, res, meta, table)
+		return ds.insertDeltaDataResult(ctx, hostDataOffset, res, meta, table)
 	case TableServices:
 		serviceDataOffset := 2
 
-		return ds.insertDeltaDataResult(serviceDataOffset, res, meta, table)
+		return ds.insertDeltaDataResult(ctx, serviceDataOffset, res, meta, table)
 	default:
 		logWith(peer, req).Panicf("not implemented for: %s", tableName.String())
 	}
@@ -319,51 +415,128 @@ func (ds *DataStoreSet) updateDeltaHostsServices(ctx context.Context, tableName
 	return nil
 }
 
-func (ds *DataStoreSet) insertDeltaDataResult(dataOffset int, res ResultSet, resMeta *ResultMetaData, table *DataStore) (err error) {
-	updateType := "delta"
+// insertDeltaDataResult prepares and applies the delta update result. If the context contains a generation,
+// the update will only be added to it and applied once the generation is committed.
+func (ds *DataStoreSet) insertDeltaDataResult(ctx context.Context, dataOffset int, res ResultSet, resMeta *ResultMetaData, table *DataStore) (err error) {
 	time1 := time.Now()
 	updateSet, err := table.prepareDataUpdateSet(dataOffset, res, table.DynamicColumnCache)
 	if err != nil {
 		return err
 	}
-	durationPrepare := time.Since(time1).Truncate(time.Millisecond)
+	update := &pendingUpdate{
+		store:      table,
+		resMeta:    resMeta,
+		updateSet:  updateSet,
+		dataOffset: dataOffset,
+		resultSize: len(res),
+		prepare:    time.Since(time1).Truncate(time.Millisecond),
+	}
 
-	now := currentUnixTime()
-	time2 := time.Now()
+	if generation, ok := ctx.Value(CtxGeneration).(*dataGeneration); ok {
+		generation.updates = append(generation.updates, update)
 
-	if len(updateSet) == len(table.Data) {
-		updateType = "full"
+		return nil
 	}
 
+	return ds.commitGeneration(&dataGeneration{updates: []*pendingUpdate{update}})
+}
+
+// commitGeneration applies all pending updates of a generation within a single write lock. Queries hold the
+// read lock while building their result, so they see either the previous or the new state of all tables,
+// but they still wait for the update to finish. The generation is validated before the lock is taken and the
+// rows are updated without any further checks, so either all or none of its updates are applied.
+// Changed host and service states are published as state events afterwards.
+func (ds *DataStoreSet) commitGeneration(generation *dataGeneration) (err error) {
+	if len(generation.updates) == 0 {
+		return nil
+	}
+	for _, pending := range generation.updates {
+		if err = pending.validate(); err != nil {
+			return err
+		}
+	}
+
+	now := currentUnixTime()
+	time2 := time.Now()
+
 	ds.lock.Lock()
 	durationLock := time.Since(time2).Truncate(time.Millisecond)
 	time3 := time.Now()
 
-	for _, update := range updateSet {
-		if update.FullUpdate {
-			err = update.DataRow.UpdateValues(dataOffset, update.ResultRow, table.DynamicColumnCache, now)
-		} else {
-			err = update.DataRow.UpdateValuesNumberOnly(dataOffset, update.ResultRow, table.DynamicColumnCache, now)
+	var events []*StateEvent
+	for _, pending := range generation.updates {
+		columns := pending.getColumns()
+		stateColumns := pending.store.getStateEventColumns()
+		timestamp := now
+		if pending.timestamp > 0 {
+			timestamp = pending.timestamp
 		}
-		if err != nil {
-			ds.lock.Unlock()
-
-			return err
+		for _, update := range pending.updateSet {
+			var previous [len(stateEventColumns)]int64
+			if stateColumns != nil {
+				previous = update.DataRow.getStateEventValues(stateColumns)
+			}
+			if update.FullUpdate {
+				update.DataRow.setValues(pending.dataOffset, update.ResultRow, columns, timestamp)
+			} else {
+				update.DataRow.setNumberValues(pending.dataOffset, update.ResultRow, columns, timestamp)
+			}
+			update.DataRow.publishChange(columns, timestamp)
+			if stateColumns != nil {
+				if event := update.DataRow.newStateEvent(stateColumns, previous); event != nil {
+					events = append(events, event)
+				}
+			}
 		}
 	}
 	ds.lock.Unlock()
 
+	if len(events) > 0 {
+		ds.peer.lmd.stateEvents.Publish(events)
+	}
+
 	durationInsert := time.Since(time3).Truncate(time.Millisecond)
 
 	p := ds.peer
-	tableName := table.Table.Name.String()
-	promObjectUpdate.WithLabelValues(p.Name, tableName).Add(float64(len(res)))
-	logWith(p, resMeta.Request).Debugf("up. %-5s table: %15s - fetch: %9s - prep: %9s - lock: %9s - insert: %9s - count: %8d - size: %8d kB",
-		updateType, tableName, resMeta.Duration.Truncate(time.Millisecond), durationPrepare, durationLock, durationInsert, len(updateSet), resMeta.Size/1024)
+	for _, pending := range generation.updates {
+		if pending.resMeta == nil {
+			continue
+		}
+		updateType := "delta"
+		if len(pending.updateSet) == len(pending.store.Data) {
+			updateType = "full"
+		}
+		resMeta := pending.resMeta
+		tableName := pending.store.Table.Name.String()
+		promObjectUpdate.WithLabelValues(p.Name, tableName).Add(float64(pending.resultSize))
+		logWith(p, resMeta.Request).Debugf("up. %-5s table: %15s - fetch: %9s - prep: %9s - lock: %9s - insert: %9s - count: %8d - size: %8d kB",
+			updateType, tableName, resMeta.Duration.Truncate(time.Millisecond), pending.prepare, durationLock, durationInsert, len(pending.updateSet), resMeta.Size/1024)
+	}
 
 	return nil
 }
 
+// validate returns an error if any row of the update does not match the columns of its store.
+func (pending *pendingUpdate) validate() error {
+	columns := pending.getColumns()
+	for _, update := range pending.updateSet {
+		if err := update.DataRow.checkValuesSize(pending.dataOffset, update.ResultRow, columns); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getColumns returns the columns updated by this update.
+func (pending *pendingUpdate) getColumns() ColumnList {
+	if pending.columns != nil {
+		return pending.columns
+	}
+
+	return pending.store.DynamicColumnCache
+}
+
 // UpdateDeltaFullScanHostsServices is a table independent wrapper for UpdateDeltaFullScan
 // It returns true if an update was done and any error encountered.
 func (ds *DataStoreSet) UpdateDeltaFullScanHostsServices(ctx context.Context, store *DataStore, filterStr string, updateThreshold int64) (updated bool, err error) {
@@ -722,7 +895,7 @@ func (ds *DataStoreSet) UpdateFullTable(ctx context.Context, tableName TableName
 		// continue with normal update
 		fallthrough
 	default:
-		err = ds.insertDeltaDataResult(primaryKeysLen, res, resMeta, store)
+		err = ds.insertDeltaDataResult(ctx, primaryKeysLen, res, resMeta, store)
 		if err != nil {
 			return err
 		}
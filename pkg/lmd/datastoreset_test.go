@@ -69,6 +69,48 @@ func TestDSFullUpdate(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestDSGeneration(t *testing.T) {
+	peer, cleanup, _ := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	generation := &dataGeneration{}
+	ctx := context.WithValue(context.TODO(), CtxGeneration, generation)
+	err := peer.data.UpdateDeltaHosts(ctx, "", false, 0)
+	require.NoError(t, err)
+	err = peer.data.UpdateDeltaServices(ctx, "", false, 0)
+	require.NoError(t, err)
+
+	// updates are staged only
+	require.Len(t, generation.updates, 2)
+
+	err = peer.data.commitGeneration(generation)
+	require.NoError(t, err)
+
+	// invalid generations are not applied at all
+	hosts := peer.data.Get(TableHosts)
+	host := hosts.Data[0]
+	hostRow := make([]interface{}, len(hosts.DynamicColumnCache))
+	for i, col := range hosts.DynamicColumnCache {
+		hostRow[i] = host.GetValueByColumn(col)
+	}
+	peer.data.lock.RLock()
+	lastUpdate := host.LastUpdate
+	peer.data.lock.RUnlock()
+	services := peer.data.Get(TableServices)
+	generation = &dataGeneration{updates: []*pendingUpdate{
+		{store: hosts, updateSet: []*ResultPrepared{{DataRow: host, ResultRow: hostRow, FullUpdate: true}}},
+		{store: services, dataOffset: 2, updateSet: []*ResultPrepared{{DataRow: services.Data[0], ResultRow: []interface{}{"a", "b"}}}},
+	}}
+	err = peer.data.commitGeneration(generation)
+	require.ErrorContains(t, err, "data size mismatch")
+	peer.data.lock.RLock()
+	assert.InDelta(t, lastUpdate, host.LastUpdate, 0)
+	peer.data.lock.RUnlock()
+
+	err = cleanup()
+	require.NoError(t, err)
+}
+
 func TestDSDowntimesComments(t *testing.T) {
 	peer, cleanup, _ := StartTestPeer(1, 10, 10)
 	PauseTestPeers(peer)
@@ -0,0 +1,159 @@
+package lmd
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+// eventBroker distributes events to all subscribers whose filter matches.
+type eventBroker[T, F any] struct {
+	lock        *deadlock.RWMutex
+	subscribers map[*eventSubscriber[T, F]]bool
+	count       atomic.Int32 // number of subscribers, used to skip building events if nobody listens
+}
+
+// eventSubscriber is a single consumer of an event broker.
+type eventSubscriber[T, F any] struct {
+	filter  F
+	events  chan T
+	dropped chan struct{} // closed if the subscriber could not keep up
+	once    sync.Once
+}
+
+// eventStream sends the events of a subscriber to a streaming http response till the client disconnects.
+type eventStream[T any] struct {
+	keepalive func() error        // writes a keepalive message
+	write     func(event T) error // writes a single event
+	name      string              // used in log messages, ex.: change stream
+	heartbeat time.Duration       // interval of keepalive messages
+}
+
+func newEventBroker[T, F any]() *eventBroker[T, F] {
+	return &eventBroker[T, F]{
+		lock:        new(deadlock.RWMutex),
+		subscribers: make(map[*eventSubscriber[T, F]]bool),
+	}
+}
+
+// subscribe adds a new subscriber buffering up to size events.
+func (b *eventBroker[T, F]) subscribe(filter F, size int) *eventSubscriber[T, F] {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.add(filter, size)
+}
+
+// add adds a new subscriber, the lock must be held.
+func (b *eventBroker[T, F]) add(filter F, size int) *eventSubscriber[T, F] {
+	sub := &eventSubscriber[T, F]{
+		filter:  filter,
+		events:  make(chan T, size),
+		dropped: make(chan struct{}),
+	}
+	b.subscribers[sub] = true
+	b.count.Store(int32(len(b.subscribers)))
+
+	return sub
+}
+
+// unsubscribe removes the subscriber.
+func (b *eventBroker[T, F]) unsubscribe(sub *eventSubscriber[T, F]) {
+	b.lock.Lock()
+	delete(b.subscribers, sub)
+	b.count.Store(int32(len(b.subscribers)))
+	b.lock.Unlock()
+}
+
+// wants returns true if the filter of any subscriber matches.
+func (b *eventBroker[T, F]) wants(match func(filter F) bool) bool {
+	if b.count.Load() == 0 {
+		return false
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for sub := range b.subscribers {
+		if match(sub.filter) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// publish sends the event to all subscribers whose filter matches, a nil match sends it to everyone.
+func (b *eventBroker[T, F]) publish(event T, match func(filter F) bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	b.send(event, match)
+}
+
+// send sends the event to all matching subscribers, the lock must be held.
+// Subscribers which cannot keep up will be dropped.
+func (b *eventBroker[T, F]) send(event T, match func(filter F) bool) {
+	for sub := range b.subscribers {
+		if match != nil && !match(sub.filter) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			sub.once.Do(func() { close(sub.dropped) })
+		}
+	}
+}
+
+// start sends the status line and headers. Streams are not limited by the regular request timeout.
+func (s *eventStream[T]) start(wrt http.ResponseWriter) *http.ResponseController {
+	ctrl := http.NewResponseController(wrt)
+	err := ctrl.SetWriteDeadline(time.Time{})
+	if err != nil {
+		log.Debugf("failed to reset write deadline: %e", err)
+	}
+	wrt.WriteHeader(http.StatusOK)
+
+	return ctrl
+}
+
+// run sends all events till the client disconnects or the subscriber gets dropped.
+func (s *eventStream[T]) run(request *http.Request, ctrl *http.ResponseController, events <-chan T, dropped <-chan struct{}) {
+	if err := ctrl.Flush(); err != nil {
+		log.Debugf("flushing %s failed: %e", s.name, err)
+
+		return
+	}
+
+	heartbeat := time.NewTicker(s.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-request.Context().Done():
+			log.Debugf("%s subscriber %s disconnected", s.name, request.RemoteAddr)
+
+			return
+		case <-dropped:
+			log.Warnf("%s subscriber %s could not keep up, closing stream", s.name, request.RemoteAddr)
+
+			return
+		case <-heartbeat.C:
+			err = s.keepalive()
+		case event := <-events:
+			err = s.write(event)
+		}
+		if err != nil {
+			log.Debugf("sending %s event failed: %e", s.name, err)
+
+			return
+		}
+		if err = ctrl.Flush(); err != nil {
+			log.Debugf("flushing %s failed: %e", s.name, err)
+
+			return
+		}
+	}
+}
@@ -157,7 +157,10 @@ func (ex *Exporter) addTable(peer *Peer, table *Table) (written int64, err error
 	if err != nil {
 		return 0, err
 	}
-	req.SetRequestColumns()
+	err = req.SetRequestColumns()
+	if err != nil {
+		return 0, err
+	}
 	res, _, err := NewResponse(context.TODO(), req, nil)
 	if err != nil {
 		return 0, err
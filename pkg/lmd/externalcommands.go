@@ -0,0 +1,191 @@
+package lmd
+
+// knownCommands maps the naemon external commands to the type of object they apply to.
+// The key arguments naming the target object are always the leading arguments, see CommandTarget.keyArgs.
+var knownCommands = map[string]CommandTarget{
+	// global commands
+	"CHANGE_GLOBAL_HOST_EVENT_HANDLER":    CommandTargetGlobal,
+	"CHANGE_GLOBAL_SVC_EVENT_HANDLER":     CommandTargetGlobal,
+	"DEL_DOWNTIME_BY_START_TIME_COMMENT":  CommandTargetGlobal,
+	"DISABLE_EVENT_HANDLERS":              CommandTargetGlobal,
+	"DISABLE_FAILURE_PREDICTION":          CommandTargetGlobal,
+	"DISABLE_FLAP_DETECTION":              CommandTargetGlobal,
+	"DISABLE_HOST_FRESHNESS_CHECKS":       CommandTargetGlobal,
+	"DISABLE_NOTIFICATIONS":               CommandTargetGlobal,
+	"DISABLE_PERFORMANCE_DATA":            CommandTargetGlobal,
+	"DISABLE_SERVICE_FRESHNESS_CHECKS":    CommandTargetGlobal,
+	"ENABLE_EVENT_HANDLERS":               CommandTargetGlobal,
+	"ENABLE_FAILURE_PREDICTION":           CommandTargetGlobal,
+	"ENABLE_FLAP_DETECTION":               CommandTargetGlobal,
+	"ENABLE_HOST_FRESHNESS_CHECKS":        CommandTargetGlobal,
+	"ENABLE_NOTIFICATIONS":                CommandTargetGlobal,
+	"ENABLE_PERFORMANCE_DATA":             CommandTargetGlobal,
+	"ENABLE_SERVICE_FRESHNESS_CHECKS":     CommandTargetGlobal,
+	"PROCESS_FILE":                        CommandTargetGlobal,
+	"READ_STATE_INFORMATION":              CommandTargetGlobal,
+	"RESTART_PROGRAM":                     CommandTargetGlobal,
+	"SAVE_STATE_INFORMATION":              CommandTargetGlobal,
+	"SHUTDOWN_PROGRAM":                    CommandTargetGlobal,
+	"START_ACCEPTING_PASSIVE_HOST_CHECKS": CommandTargetGlobal,
+	"START_ACCEPTING_PASSIVE_SVC_CHECKS":  CommandTargetGlobal,
+	"START_EXECUTING_HOST_CHECKS":         CommandTargetGlobal,
+	"START_EXECUTING_SVC_CHECKS":          CommandTargetGlobal,
+	"START_OBSESSING_OVER_HOST_CHECKS":    CommandTargetGlobal,
+	"START_OBSESSING_OVER_SVC_CHECKS":     CommandTargetGlobal,
+	"STOP_ACCEPTING_PASSIVE_HOST_CHECKS":  CommandTargetGlobal,
+	"STOP_ACCEPTING_PASSIVE_SVC_CHECKS":   CommandTargetGlobal,
+	"STOP_EXECUTING_HOST_CHECKS":          CommandTargetGlobal,
+	"STOP_EXECUTING_SVC_CHECKS":           CommandTargetGlobal,
+	"STOP_OBSESSING_OVER_HOST_CHECKS":     CommandTargetGlobal,
+	"STOP_OBSESSING_OVER_SVC_CHECKS":      CommandTargetGlobal,
+
+	// lmd peer administration
+	"LMD_ADD_PEER":    CommandTargetGlobal,
+	"LMD_PAUSE_PEER":  CommandTargetGlobal,
+	"LMD_REMOVE_PEER": CommandTargetGlobal,
+	"LMD_RESUME_PEER": CommandTargetGlobal,
+	"LMD_RESYNC_PEER": CommandTargetGlobal,
+
+	// host commands: host_name
+	"ACKNOWLEDGE_HOST_PROBLEM":                       CommandTargetHost,
+	"ACKNOWLEDGE_HOST_PROBLEM_EXPIRE":                CommandTargetHost,
+	"ADD_HOST_COMMENT":                               CommandTargetHost,
+	"CHANGE_CUSTOM_HOST_VAR":                         CommandTargetHost,
+	"CHANGE_HOST_CHECK_COMMAND":                      CommandTargetHost,
+	"CHANGE_HOST_CHECK_TIMEPERIOD":                   CommandTargetHost,
+	"CHANGE_HOST_EVENT_HANDLER":                      CommandTargetHost,
+	"CHANGE_HOST_MODATTR":                            CommandTargetHost,
+	"CHANGE_HOST_NOTIFICATION_TIMEPERIOD":            CommandTargetHost,
+	"CHANGE_MAX_HOST_CHECK_ATTEMPTS":                 CommandTargetHost,
+	"CHANGE_NORMAL_HOST_CHECK_INTERVAL":              CommandTargetHost,
+	"CHANGE_RETRY_HOST_CHECK_INTERVAL":               CommandTargetHost,
+	"CLEAR_HOST_FLAPPING_STATE":                      CommandTargetHost,
+	"DEL_ALL_HOST_COMMENTS":                          CommandTargetHost,
+	"DEL_DOWNTIME_BY_HOST_NAME":                      CommandTargetHost,
+	"DELAY_HOST_NOTIFICATION":                        CommandTargetHost,
+	"DISABLE_ALL_NOTIFICATIONS_BEYOND_HOST":          CommandTargetHost,
+	"DISABLE_HOST_AND_CHILD_NOTIFICATIONS":           CommandTargetHost,
+	"DISABLE_HOST_CHECK":                             CommandTargetHost,
+	"DISABLE_HOST_EVENT_HANDLER":                     CommandTargetHost,
+	"DISABLE_HOST_FLAP_DETECTION":                    CommandTargetHost,
+	"DISABLE_HOST_NOTIFICATIONS":                     CommandTargetHost,
+	"DISABLE_HOST_SVC_CHECKS":                        CommandTargetHost,
+	"DISABLE_HOST_SVC_NOTIFICATIONS":                 CommandTargetHost,
+	"DISABLE_PASSIVE_HOST_CHECKS":                    CommandTargetHost,
+	"ENABLE_ALL_NOTIFICATIONS_BEYOND_HOST":           CommandTargetHost,
+	"ENABLE_HOST_AND_CHILD_NOTIFICATIONS":            CommandTargetHost,
+	"ENABLE_HOST_CHECK":                              CommandTargetHost,
+	"ENABLE_HOST_EVENT_HANDLER":                      CommandTargetHost,
+	"ENABLE_HOST_FLAP_DETECTION":                     CommandTargetHost,
+	"ENABLE_HOST_NOTIFICATIONS":                      CommandTargetHost,
+	"ENABLE_HOST_SVC_CHECKS":                         CommandTargetHost,
+	"ENABLE_HOST_SVC_NOTIFICATIONS":                  CommandTargetHost,
+	"ENABLE_PASSIVE_HOST_CHECKS":                     CommandTargetHost,
+	"PROCESS_HOST_CHECK_RESULT":                      CommandTargetHost,
+	"REMOVE_HOST_ACKNOWLEDGEMENT":                    CommandTargetHost,
+	"SCHEDULE_AND_PROPAGATE_HOST_DOWNTIME":           CommandTargetHost,
+	"SCHEDULE_AND_PROPAGATE_TRIGGERED_HOST_DOWNTIME": CommandTargetHost,
+	"SCHEDULE_FORCED_HOST_CHECK":                     CommandTargetHost,
+	"SCHEDULE_FORCED_HOST_SVC_CHECKS":                CommandTargetHost,
+	"SCHEDULE_HOST_CHECK":                            CommandTargetHost,
+	"SCHEDULE_HOST_DOWNTIME":                         CommandTargetHost,
+	"SCHEDULE_HOST_SVC_CHECKS":                       CommandTargetHost,
+	"SCHEDULE_HOST_SVC_DOWNTIME":                     CommandTargetHost,
+	"SEND_CUSTOM_HOST_NOTIFICATION":                  CommandTargetHost,
+	"SET_HOST_NOTIFICATION_NUMBER":                   CommandTargetHost,
+	"START_OBSESSING_OVER_HOST":                      CommandTargetHost,
+	"STOP_OBSESSING_OVER_HOST":                       CommandTargetHost,
+
+	// service commands: host_name;service_description
+	"ACKNOWLEDGE_SVC_PROBLEM":            CommandTargetService,
+	"ACKNOWLEDGE_SVC_PROBLEM_EXPIRE":     CommandTargetService,
+	"ADD_SVC_COMMENT":                    CommandTargetService,
+	"CHANGE_CUSTOM_SVC_VAR":              CommandTargetService,
+	"CHANGE_MAX_SVC_CHECK_ATTEMPTS":      CommandTargetService,
+	"CHANGE_NORMAL_SVC_CHECK_INTERVAL":   CommandTargetService,
+	"CHANGE_RETRY_SVC_CHECK_INTERVAL":    CommandTargetService,
+	"CHANGE_SVC_CHECK_COMMAND":           CommandTargetService,
+	"CHANGE_SVC_CHECK_TIMEPERIOD":        CommandTargetService,
+	"CHANGE_SVC_EVENT_HANDLER":           CommandTargetService,
+	"CHANGE_SVC_MODATTR":                 CommandTargetService,
+	"CHANGE_SVC_NOTIFICATION_TIMEPERIOD": CommandTargetService,
+	"CLEAR_SVC_FLAPPING_STATE":           CommandTargetService,
+	"DEL_ALL_SVC_COMMENTS":               CommandTargetService,
+	"DELAY_SVC_NOTIFICATION":             CommandTargetService,
+	"DISABLE_PASSIVE_SVC_CHECKS":         CommandTargetService,
+	"DISABLE_SVC_CHECK":                  CommandTargetService,
+	"DISABLE_SVC_EVENT_HANDLER":          CommandTargetService,
+	"DISABLE_SVC_FLAP_DETECTION":         CommandTargetService,
+	"DISABLE_SVC_NOTIFICATIONS":          CommandTargetService,
+	"ENABLE_PASSIVE_SVC_CHECKS":          CommandTargetService,
+	"ENABLE_SVC_CHECK":                   CommandTargetService,
+	"ENABLE_SVC_EVENT_HANDLER":           CommandTargetService,
+	"ENABLE_SVC_FLAP_DETECTION":          CommandTargetService,
+	"ENABLE_SVC_NOTIFICATIONS":           CommandTargetService,
+	"PROCESS_SERVICE_CHECK_RESULT":       CommandTargetService,
+	"REMOVE_SVC_ACKNOWLEDGEMENT":         CommandTargetService,
+	"SCHEDULE_FORCED_SVC_CHECK":          CommandTargetService,
+	"SCHEDULE_SVC_CHECK":                 CommandTargetService,
+	"SCHEDULE_SVC_DOWNTIME":              CommandTargetService,
+	"SEND_CUSTOM_SVC_NOTIFICATION":       CommandTargetService,
+	"SET_SVC_NOTIFICATION_NUMBER":        CommandTargetService,
+	"START_OBSESSING_OVER_SVC":           CommandTargetService,
+	"STOP_OBSESSING_OVER_SVC":            CommandTargetService,
+
+	// hostgroup commands: hostgroup_name
+	"DEL_DOWNTIME_BY_HOSTGROUP_NAME":        CommandTargetHostgroup,
+	"DISABLE_HOSTGROUP_HOST_CHECKS":         CommandTargetHostgroup,
+	"DISABLE_HOSTGROUP_HOST_NOTIFICATIONS":  CommandTargetHostgroup,
+	"DISABLE_HOSTGROUP_PASSIVE_HOST_CHECKS": CommandTargetHostgroup,
+	"DISABLE_HOSTGROUP_PASSIVE_SVC_CHECKS":  CommandTargetHostgroup,
+	"DISABLE_HOSTGROUP_SVC_CHECKS":          CommandTargetHostgroup,
+	"DISABLE_HOSTGROUP_SVC_NOTIFICATIONS":   CommandTargetHostgroup,
+	"ENABLE_HOSTGROUP_HOST_CHECKS":          CommandTargetHostgroup,
+	"ENABLE_HOSTGROUP_HOST_NOTIFICATIONS":   CommandTargetHostgroup,
+	"ENABLE_HOSTGROUP_PASSIVE_HOST_CHECKS":  CommandTargetHostgroup,
+	"ENABLE_HOSTGROUP_PASSIVE_SVC_CHECKS":   CommandTargetHostgroup,
+	"ENABLE_HOSTGROUP_SVC_CHECKS":           CommandTargetHostgroup,
+	"ENABLE_HOSTGROUP_SVC_NOTIFICATIONS":    CommandTargetHostgroup,
+	"SCHEDULE_HOSTGROUP_HOST_DOWNTIME":      CommandTargetHostgroup,
+	"SCHEDULE_HOSTGROUP_SVC_DOWNTIME":       CommandTargetHostgroup,
+
+	// servicegroup commands: servicegroup_name
+	"DISABLE_SERVICEGROUP_HOST_CHECKS":         CommandTargetServicegroup,
+	"DISABLE_SERVICEGROUP_HOST_NOTIFICATIONS":  CommandTargetServicegroup,
+	"DISABLE_SERVICEGROUP_PASSIVE_HOST_CHECKS": CommandTargetServicegroup,
+	"DISABLE_SERVICEGROUP_PASSIVE_SVC_CHECKS":  CommandTargetServicegroup,
+	"DISABLE_SERVICEGROUP_SVC_CHECKS":          CommandTargetServicegroup,
+	"DISABLE_SERVICEGROUP_SVC_NOTIFICATIONS":   CommandTargetServicegroup,
+	"ENABLE_SERVICEGROUP_HOST_CHECKS":          CommandTargetServicegroup,
+	"ENABLE_SERVICEGROUP_HOST_NOTIFICATIONS":   CommandTargetServicegroup,
+	"ENABLE_SERVICEGROUP_PASSIVE_HOST_CHECKS":  CommandTargetServicegroup,
+	"ENABLE_SERVICEGROUP_PASSIVE_SVC_CHECKS":   CommandTargetServicegroup,
+	"ENABLE_SERVICEGROUP_SVC_CHECKS":           CommandTargetServicegroup,
+	"ENABLE_SERVICEGROUP_SVC_NOTIFICATIONS":    CommandTargetServicegroup,
+	"SCHEDULE_SERVICEGROUP_HOST_DOWNTIME":      CommandTargetServicegroup,
+	"SCHEDULE_SERVICEGROUP_SVC_DOWNTIME":       CommandTargetServicegroup,
+
+	// contact commands: contact_name
+	"CHANGE_CONTACT_HOST_NOTIFICATION_TIMEPERIOD": CommandTargetContact,
+	"CHANGE_CONTACT_MODATTR":                      CommandTargetContact,
+	"CHANGE_CONTACT_MODHATTR":                     CommandTargetContact,
+	"CHANGE_CONTACT_MODSATTR":                     CommandTargetContact,
+	"CHANGE_CONTACT_SVC_NOTIFICATION_TIMEPERIOD":  CommandTargetContact,
+	"CHANGE_CUSTOM_CONTACT_VAR":                   CommandTargetContact,
+	"DISABLE_CONTACT_HOST_NOTIFICATIONS":          CommandTargetContact,
+	"DISABLE_CONTACT_SVC_NOTIFICATIONS":           CommandTargetContact,
+	"ENABLE_CONTACT_HOST_NOTIFICATIONS":           CommandTargetContact,
+	"ENABLE_CONTACT_SVC_NOTIFICATIONS":            CommandTargetContact,
+
+	// contactgroup commands: contactgroup_name
+	"DISABLE_CONTACTGROUP_HOST_NOTIFICATIONS": CommandTargetContactgroup,
+	"DISABLE_CONTACTGROUP_SVC_NOTIFICATIONS":  CommandTargetContactgroup,
+	"ENABLE_CONTACTGROUP_HOST_NOTIFICATIONS":  CommandTargetContactgroup,
+	"ENABLE_CONTACTGROUP_SVC_NOTIFICATIONS":   CommandTargetContactgroup,
+
+	// downtime and comment commands: id
+	"DEL_HOST_COMMENT":  CommandTargetComment,
+	"DEL_HOST_DOWNTIME": CommandTargetDowntime,
+	"DEL_SVC_COMMENT":   CommandTargetComment,
+	"DEL_SVC_DOWNTIME":  CommandTargetDowntime,
+}
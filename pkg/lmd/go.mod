@@ -7,6 +7,8 @@ require (
 	github.com/OneOfOne/xxhash v1.2.8
 	github.com/a8m/djson v0.0.0-20170509170705-c02c5aef757f
 	github.com/buger/jsonparser v1.1.1
+	github.com/gorilla/websocket v1.5.3
+	github.com/graphql-go/graphql v0.8.1
 	github.com/json-iterator/go v1.1.12
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/kdar/factorlog v0.0.0-20211012144011-6ea75a169038
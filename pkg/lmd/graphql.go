@@ -0,0 +1,1000 @@
+package lmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// GraphQLBatchSize sets the maximum number of parent objects resolved with a single request.
+	GraphQLBatchSize = 100
+
+	// GraphQLMaxBodySize sets the maximum size of a graphql request body in bytes.
+	GraphQLMaxBodySize = 1 << 20
+
+	// graphQLMaxDepth limits the nesting of selections and fragments.
+	graphQLMaxDepth = 20
+
+	// graphQLMaxFields limits the number of fields of a query with all fragments expanded.
+	graphQLMaxFields = 1000
+)
+
+// graphQLFilterPrefixes contains the livestatus header lines which can be used as graphql filter.
+var graphQLFilterPrefixes = []string{"Filter:", "And:", "Or:", "Negate:"}
+
+var (
+	graphQLSchemaOnce sync.Once
+	graphQLSchema     *gqlSchema
+)
+
+// GraphQLRequest contains a graphql request as sent by http clients.
+type GraphQLRequest struct {
+	Variables     map[string]interface{} `json:"variables"`
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+}
+
+// GraphQLResponse contains the result of a graphql request.
+type GraphQLResponse struct {
+	Data   interface{}                `json:"data,omitempty"`
+	Errors []gqlerrors.FormattedError `json:"errors,omitempty"`
+}
+
+// gqlSchema contains the graphql schema derived from the table definitions.
+type gqlSchema struct {
+	schema    graphql.Schema
+	relations map[string]map[string]*gqlRelation // relation fields by type and field name
+}
+
+// gqlRelation connects two tables, child objects are found by matching the parent columns with the child columns.
+type gqlRelation struct {
+	table         *Table
+	parentColumns []string
+	childColumns  []string
+	list          bool
+}
+
+// gqlRow is a single object as returned by a table request. It is the source of all fields of an object type.
+type gqlRow struct {
+	values   map[string]json.RawMessage
+	authUser string // applies to all nested relations
+}
+
+// gqlParentKey contains the values of the parent columns of a relation.
+type gqlParentKey struct {
+	peerKey string
+	values  []string
+}
+
+// gqlLoader fetches the children of a relation field for all parents at once.
+type gqlLoader struct {
+	err      error
+	relation *gqlRelation
+	listData map[string]interface{}
+	children map[string][]*gqlRow
+	authUser string
+	columns  []interface{}
+	pending  []gqlParentKey
+	seen     map[string]bool
+}
+
+// gqlLimits counts the depth and fields of a query with all fragments expanded.
+type gqlLimits struct {
+	fragments map[string]*ast.FragmentDefinition
+	counted   map[string]int  // number of fields of already counted fragments by name and depth
+	spreading map[string]bool // fragments currently being counted, used to detect cycles
+}
+
+// gqlExecutor contains the state of a single graphql request, it is passed to the resolvers by context.
+type gqlExecutor struct {
+	ctx        context.Context
+	controller *HTTPServerController
+	schema     *gqlSchema
+	loaders    map[string]*gqlLoader
+	failed     map[string]bool
+	errors     []gqlerrors.FormattedError
+}
+
+// graphql handles graphql queries sent by GET or POST.
+func (c *HTTPServerController) graphql(wrt http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	wrt.Header().Set("Content-Type", "application/json")
+	res := &GraphQLResponse{}
+	status := http.StatusOK
+	gqlReq, err := parseGraphQLRequest(wrt, request)
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		res.Errors = []gqlerrors.FormattedError{gqlerrors.NewFormattedError(fmt.Sprintf("request body exceeds the maximum size of %d bytes", maxBytesErr.Limit))}
+		status = http.StatusRequestEntityTooLarge
+	case err != nil:
+		res.Errors = []gqlerrors.FormattedError{gqlerrors.NewFormattedError(err.Error())}
+		status = http.StatusBadRequest
+	default:
+		res, status = c.executeGraphQL(request.Context(), gqlReq)
+	}
+	wrt.WriteHeader(status)
+	restWriteJSON(wrt, res)
+}
+
+// parseGraphQLRequest reads the query from the url parameters, a json body or a plain application/graphql body.
+// Request bodies are limited to GraphQLMaxBodySize.
+func parseGraphQLRequest(wrt http.ResponseWriter, request *http.Request) (gqlReq *GraphQLRequest, err error) {
+	gqlReq = &GraphQLRequest{}
+	switch {
+	case request.Method == http.MethodGet:
+		query := request.URL.Query()
+		gqlReq.Query = query.Get("query")
+		gqlReq.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &gqlReq.Variables); err != nil {
+				return nil, fmt.Errorf("variables not understood: %s", err.Error())
+			}
+		}
+	case strings.HasPrefix(request.Header.Get("Content-Type"), "application/graphql"):
+		defer request.Body.Close()
+		body, err := io.ReadAll(http.MaxBytesReader(wrt, request.Body, GraphQLMaxBodySize))
+		if err != nil {
+			return nil, gqlBodyError(err)
+		}
+		gqlReq.Query = string(body)
+	default:
+		defer request.Body.Close()
+		if err := json.NewDecoder(http.MaxBytesReader(wrt, request.Body, GraphQLMaxBodySize)).Decode(gqlReq); err != nil {
+			return nil, gqlBodyError(err)
+		}
+	}
+	if strings.TrimSpace(gqlReq.Query) == "" {
+		return nil, fmt.Errorf("no query given")
+	}
+
+	return gqlReq, nil
+}
+
+// gqlBodyError keeps errors from exceeding the body size limit and hides all other read errors.
+func gqlBodyError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return maxBytesErr
+	}
+
+	return fmt.Errorf("request not understood")
+}
+
+// executeGraphQL parses, validates and runs the graphql request.
+// Invalid documents return a bad request, errors during execution are returned along with the partial data.
+func (c *HTTPServerController) executeGraphQL(ctx context.Context, gqlReq *GraphQLRequest) (*GraphQLResponse, int) {
+	badRequest := func(errs ...gqlerrors.FormattedError) (*GraphQLResponse, int) {
+		return &GraphQLResponse{Errors: errs}, http.StatusBadRequest
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(gqlReq.Query), Name: "GraphQL request"})})
+	if err != nil {
+		return badRequest(gqlerrors.FormatError(err))
+	}
+	operation, err := gqlOperation(doc, gqlReq.OperationName)
+	if err != nil {
+		return badRequest(gqlerrors.NewFormattedError(err.Error()))
+	}
+	if operation.Operation != ast.OperationTypeQuery {
+		return badRequest(gqlerrors.NewFormattedError(fmt.Sprintf("%s operations are not supported", operation.Operation)))
+	}
+	// limits are checked first, the validation has to expand all fragments as well
+	if _, err = newGQLLimits(doc).count(operation.SelectionSet, 0); err != nil {
+		return badRequest(gqlerrors.NewFormattedError(err.Error()))
+	}
+	schema := getGraphQLSchema()
+	if validation := graphql.ValidateDocument(&schema.schema, doc, nil); !validation.IsValid {
+		return badRequest(validation.Errors...)
+	}
+
+	exec := &gqlExecutor{
+		ctx:        ctx,
+		controller: c,
+		schema:     schema,
+		loaders:    make(map[string]*gqlLoader),
+		failed:     make(map[string]bool),
+	}
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        schema.schema,
+		AST:           doc,
+		OperationName: gqlReq.OperationName,
+		Args:          gqlReq.Variables,
+		Context:       context.WithValue(ctx, CtxGraphQL, exec),
+	})
+	if result.Data == nil && result.HasErrors() {
+		// variables could not be coerced
+		return badRequest(result.Errors...)
+	}
+
+	return &GraphQLResponse{Data: result.Data, Errors: append(result.Errors, exec.errors...)}, http.StatusOK
+}
+
+// gqlOperation returns the operation with given name, the name is optional if the document contains one operation only.
+func gqlOperation(doc *ast.Document, name string) (*ast.OperationDefinition, error) {
+	var found *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		operation, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "" && found != nil:
+			return nil, fmt.Errorf("operationName is required if the document contains multiple operations")
+		case name == "", operation.Name != nil && operation.Name.Value == name:
+			found = operation
+		}
+	}
+	switch {
+	case found != nil:
+		return found, nil
+	case name != "":
+		return nil, fmt.Errorf("unknown operation %s", name)
+	default:
+		return nil, fmt.Errorf("document contains no operation")
+	}
+}
+
+func newGQLLimits(doc *ast.Document) *gqlLimits {
+	limits := &gqlLimits{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		counted:   make(map[string]int),
+		spreading: make(map[string]bool),
+	}
+	for _, def := range doc.Definitions {
+		if fragment, ok := def.(*ast.FragmentDefinition); ok {
+			limits.fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	return limits
+}
+
+// count returns the number of fields of the selection set, which is limited by graphQLMaxFields.
+func (limits *gqlLimits) count(set *ast.SelectionSet, depth int) (numFields int, err error) {
+	if set == nil {
+		return 0, nil
+	}
+	if depth > graphQLMaxDepth {
+		return 0, fmt.Errorf("query exceeds the maximum depth of %d", graphQLMaxDepth)
+	}
+	for _, sel := range set.Selections {
+		var num int
+		switch sel := sel.(type) {
+		case *ast.Field:
+			num, err = limits.count(sel.SelectionSet, depth+1)
+			num++
+		case *ast.InlineFragment:
+			num, err = limits.count(sel.SelectionSet, depth+1)
+		case *ast.FragmentSpread:
+			num, err = limits.countFragment(sel.Name.Value, depth+1)
+		}
+		if err != nil {
+			return 0, err
+		}
+		numFields += num
+		if numFields > graphQLMaxFields {
+			return 0, fmt.Errorf("query exceeds the maximum of %d fields", graphQLMaxFields)
+		}
+	}
+
+	return numFields, nil
+}
+
+// countFragment returns the number of fields of a fragment spread.
+// Fragments are counted once per depth, spreading the same fragment again only adds its fields.
+// Unknown fragments are reported by the validation.
+func (limits *gqlLimits) countFragment(name string, depth int) (int, error) {
+	fragment, ok := limits.fragments[name]
+	if !ok {
+		return 0, nil
+	}
+	if limits.spreading[name] {
+		return 0, fmt.Errorf("fragment %s cannot spread itself", name)
+	}
+
+	key := fmt.Sprintf("%s:%d", name, depth)
+	if num, ok := limits.counted[key]; ok {
+		return num, nil
+	}
+	limits.spreading[name] = true
+	num, err := limits.count(fragment.SelectionSet, depth)
+	delete(limits.spreading, name)
+	if err != nil {
+		return 0, err
+	}
+	limits.counted[key] = num
+
+	return num, nil
+}
+
+// getGraphQLSchema returns the schema, it is built once since the tables do not change at runtime.
+func getGraphQLSchema() *gqlSchema {
+	graphQLSchemaOnce.Do(func() {
+		graphQLSchema = buildGraphQLSchema()
+	})
+
+	return graphQLSchema
+}
+
+// buildGraphQLSchema creates one object type per table along with the relations from Table.RefTables.
+func buildGraphQLSchema() *gqlSchema {
+	int64Type := graphql.NewScalar(graphql.ScalarConfig{
+		Name:        "Int64",
+		Description: "signed 64bit integer",
+		Serialize:   func(value interface{}) interface{} { return value },
+	})
+	jsonType := graphql.NewScalar(graphql.ScalarConfig{
+		Name:        "JSON",
+		Description: "arbitrary json value, used for custom variables and nested lists",
+		Serialize:   func(value interface{}) interface{} { return value },
+	})
+
+	tables := make([]*Table, 0, len(Objects.Tables))
+	for _, table := range Objects.Tables {
+		tables = append(tables, table)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name.String() < tables[j].Name.String() })
+
+	schema := &gqlSchema{relations: make(map[string]map[string]*gqlRelation)}
+	fields := make(map[string]graphql.Fields)
+	objects := make(map[string]*graphql.Object)
+	queryFields := graphql.Fields{}
+	for _, table := range tables {
+		name := table.Name.String()
+		typeName := gqlTypeName(table)
+		fields[typeName] = graphql.Fields{}
+		for _, col := range table.Columns {
+			fields[typeName][col.Name] = &graphql.Field{
+				Type:        gqlColumnType(col, int64Type, jsonType),
+				Description: col.Description,
+				Resolve:     gqlColumnResolver(col),
+			}
+		}
+		// fields are resolved lazily, relations are added once all types exist
+		objects[typeName] = graphql.NewObject(graphql.ObjectConfig{
+			Name:        typeName,
+			Description: fmt.Sprintf("object of the %s table", name),
+			Fields:      graphql.FieldsThunk(func() graphql.Fields { return fields[typeName] }),
+		})
+
+		queryFields[name] = &graphql.Field{
+			Type:        graphql.NewList(graphql.NewNonNull(objects[typeName])),
+			Description: fmt.Sprintf("list of %s", name),
+			Args:        gqlArgs(gqlListArgs(), gqlScopeArgs()),
+			Resolve:     gqlRootResolver(table, false),
+		}
+		singular := gqlSingularName(table)
+		if len(table.PrimaryKey) == 0 || singular == name {
+			continue
+		}
+		args := graphql.FieldConfigArgument{}
+		for _, key := range table.PrimaryKey {
+			args[key] = &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "primary key"}
+		}
+		queryFields[singular] = &graphql.Field{
+			Type:        objects[typeName],
+			Description: fmt.Sprintf("single object of the %s table by its primary key", name),
+			Args:        gqlArgs(args, gqlScopeArgs()),
+			Resolve:     gqlRootResolver(table, true),
+		}
+	}
+
+	// virtual tables like hostsbygroup only duplicate existing ones
+	for _, table := range tables {
+		if table.Virtual != nil || table.PassthroughOnly {
+			continue
+		}
+		typeName := gqlTypeName(table)
+		for i := range table.RefTables {
+			ref := &table.RefTables[i]
+			if len(ref.Columns) != len(ref.Table.PrimaryKey) {
+				continue
+			}
+			target := gqlTypeName(ref.Table)
+			localColumns := make([]string, 0, len(ref.Columns))
+			for _, col := range ref.Columns {
+				localColumns = append(localColumns, col.Name)
+			}
+
+			name := gqlSingularName(ref.Table)
+			if _, ok := fields[typeName][name]; ok {
+				name += "_object"
+			}
+			schema.addRelation(fields[typeName], typeName, name, &graphql.Field{
+				Type:        objects[target],
+				Description: fmt.Sprintf("referenced %s object", ref.Table.Name.String()),
+			}, &gqlRelation{table: ref.Table, parentColumns: localColumns, childColumns: ref.Table.PrimaryKey})
+
+			// reverse relations replace the column of the same name, ex.: the list of service names of hosts
+			schema.addRelation(fields[target], target, table.Name.String(), &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(objects[typeName])),
+				Description: fmt.Sprintf("list of %s referencing this object", table.Name.String()),
+				Args:        gqlListArgs(),
+			}, &gqlRelation{table: table, parentColumns: ref.Table.PrimaryKey, childColumns: localColumns, list: true})
+		}
+	}
+
+	var err error
+	schema.schema, err = graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{Name: "Query", Description: "livestatus tables", Fields: queryFields}),
+	})
+	if err != nil {
+		log.Panicf("invalid graphql schema: %s", err.Error())
+	}
+
+	return schema
+}
+
+// addRelation adds a relation field to the type, the first relation with a name wins.
+func (schema *gqlSchema) addRelation(fields graphql.Fields, typeName, name string, field *graphql.Field, relation *gqlRelation) {
+	if schema.relations[typeName] == nil {
+		schema.relations[typeName] = make(map[string]*gqlRelation)
+	}
+	if _, ok := schema.relations[typeName][name]; ok {
+		return
+	}
+	schema.relations[typeName][name] = relation
+	field.Resolve = func(params graphql.ResolveParams) (interface{}, error) {
+		exec, err := gqlExecutorFromContext(params.Context)
+		if err != nil {
+			return nil, err
+		}
+
+		return exec.resolveRelation(relation, params)
+	}
+	fields[name] = field
+}
+
+// selectedColumns returns the columns required by the selection of the resolved field.
+// Relations require their parent columns, the peer_key is always added to match children by backend.
+func (schema *gqlSchema) selectedColumns(table *Table, info graphql.ResolveInfo, extraColumns []string) []interface{} {
+	columns := []interface{}{}
+	added := make(map[string]bool)
+	addColumn := func(name string) {
+		if !added[name] {
+			added[name] = true
+			columns = append(columns, name)
+		}
+	}
+	relations := schema.relations[gqlTypeName(table)]
+	spread := make(map[string]bool)
+	var walk func(set *ast.SelectionSet)
+	walk = func(set *ast.SelectionSet) {
+		if set == nil {
+			return
+		}
+		for _, sel := range set.Selections {
+			switch sel := sel.(type) {
+			case *ast.Field:
+				if relation, ok := relations[sel.Name.Value]; ok {
+					for _, col := range relation.parentColumns {
+						addColumn(col)
+					}
+				} else if table.GetColumn(sel.Name.Value) != nil {
+					addColumn(sel.Name.Value)
+				}
+			case *ast.InlineFragment:
+				walk(sel.SelectionSet)
+			case *ast.FragmentSpread:
+				if spread[sel.Name.Value] {
+					continue
+				}
+				spread[sel.Name.Value] = true
+				if fragment, ok := info.Fragments[sel.Name.Value].(*ast.FragmentDefinition); ok {
+					walk(fragment.SelectionSet)
+				}
+			}
+		}
+	}
+	for _, field := range info.FieldASTs {
+		walk(field.SelectionSet)
+	}
+	for _, col := range extraColumns {
+		addColumn(col)
+	}
+	if table.GetColumn("peer_key") != nil {
+		addColumn("peer_key")
+	}
+	if len(columns) == 0 {
+		addColumn(table.Columns[0].Name)
+	}
+
+	return columns
+}
+
+// gqlExecutorFromContext returns the executor of the current request.
+func gqlExecutorFromContext(ctx context.Context) (*gqlExecutor, error) {
+	exec, ok := ctx.Value(CtxGraphQL).(*gqlExecutor)
+	if !ok {
+		return nil, fmt.Errorf("no graphql request in context")
+	}
+
+	return exec, nil
+}
+
+// gqlRootResolver returns the resolver of root fields, which list a table or return a single object by its primary key.
+func gqlRootResolver(table *Table, single bool) graphql.FieldResolveFn {
+	return func(params graphql.ResolveParams) (interface{}, error) {
+		exec, err := gqlExecutorFromContext(params.Context)
+		if err != nil {
+			return nil, err
+		}
+
+		return exec.resolveRoot(table, single, params)
+	}
+}
+
+// gqlColumnResolver returns the resolver of a column field.
+func gqlColumnResolver(col *Column) graphql.FieldResolveFn {
+	return func(params graphql.ResolveParams) (interface{}, error) {
+		row, ok := params.Source.(*gqlRow)
+		if !ok {
+			return nil, nil
+		}
+
+		return gqlColumnValue(col, row.values[col.Name])
+	}
+}
+
+func (exec *gqlExecutor) resolveRoot(table *Table, single bool, params graphql.ResolveParams) (interface{}, error) {
+	requestData := map[string]interface{}{"table": table.Name.String()}
+	if err := gqlScopeRequestData(params.Args, requestData); err != nil {
+		return nil, err
+	}
+	if single {
+		filter := strings.Builder{}
+		for _, key := range table.PrimaryKey {
+			value := interface2stringNoDedup(params.Args[key])
+			if strings.ContainsAny(value, "\r\n") {
+				return nil, fmt.Errorf("argument %s must not contain newlines", key)
+			}
+			filter.WriteString(fmt.Sprintf("Filter: %s = %s\n", key, value))
+		}
+		requestData["filter"] = filter.String()
+		requestData["limit"] = 1
+	} else if err := gqlListRequestData(params.Args, requestData); err != nil {
+		return nil, err
+	}
+
+	rows, err := exec.queryRows(requestData, exec.schema.selectedColumns(table, params.Info, nil))
+	if err != nil {
+		return nil, err
+	}
+	authUser, _ := requestData["authuser"].(string)
+	objects := make([]*gqlRow, 0, len(rows))
+	for _, row := range rows {
+		objects = append(objects, &gqlRow{values: row, authUser: authUser})
+	}
+	if single {
+		if len(objects) == 0 {
+			return nil, nil
+		}
+
+		return objects[0], nil
+	}
+
+	return objects, nil
+}
+
+// resolveRelation registers the parent with the loader of the relation field and returns a thunk.
+// The executor runs all resolvers of a level before the thunks, so the children of all parents are fetched at once.
+func (exec *gqlExecutor) resolveRelation(relation *gqlRelation, params graphql.ResolveParams) (interface{}, error) {
+	parent, ok := params.Source.(*gqlRow)
+	if !ok {
+		return nil, nil
+	}
+	key := gqlParentKey{peerKey: gqlRawString(parent.values["peer_key"])}
+	for _, col := range relation.parentColumns {
+		value := gqlRawString(parent.values[col])
+		if value == "" || strings.ContainsAny(value, "\r\n") {
+			if relation.list {
+				return []*gqlRow{}, nil
+			}
+
+			return nil, nil
+		}
+		key.values = append(key.values, value)
+	}
+
+	loader, err := exec.loader(relation, params, parent.authUser)
+	if err != nil {
+		return nil, err
+	}
+	matchKey := gqlMatchKey(key.peerKey, key.values)
+	if !loader.seen[matchKey] {
+		loader.seen[matchKey] = true
+		loader.pending = append(loader.pending, key)
+	}
+
+	return func() (interface{}, error) {
+		if len(loader.pending) > 0 && loader.err == nil {
+			pending := loader.pending
+			loader.pending = nil
+			loader.err = exec.fetchChildren(loader, pending)
+		}
+		if loader.err != nil {
+			return nil, loader.err
+		}
+		list := loader.children[matchKey]
+		if !relation.list {
+			if len(list) == 0 {
+				return nil, nil
+			}
+
+			return list[0], nil
+		}
+
+		// limit and offset apply to the list of each parent
+		offset, _ := loader.listData["offset"].(int)
+		list = list[min(offset, len(list)):]
+		if limit, ok := loader.listData["limit"].(int); ok {
+			list = list[:min(limit, len(list))]
+		}
+
+		return list, nil
+	}, nil
+}
+
+// loader returns the loader of the relation field, it is shared by all parents with the same authuser.
+func (exec *gqlExecutor) loader(relation *gqlRelation, params graphql.ResolveParams, authUser string) (*gqlLoader, error) {
+	id := fmt.Sprintf("%p\x00%s", params.Info.FieldASTs[0], authUser)
+	if loader, ok := exec.loaders[id]; ok {
+		return loader, nil
+	}
+
+	listData := map[string]interface{}{}
+	if err := gqlListRequestData(params.Args, listData); err != nil {
+		return nil, err
+	}
+	loader := &gqlLoader{
+		relation: relation,
+		listData: listData,
+		authUser: authUser,
+		columns:  exec.schema.selectedColumns(relation.table, params.Info, relation.childColumns),
+		children: make(map[string][]*gqlRow),
+		seen:     make(map[string]bool),
+	}
+	exec.loaders[id] = loader
+
+	return loader, nil
+}
+
+// fetchChildren fetches the related objects for all given parents with as few requests as possible.
+// The filter is pushed down to the referenced table, so the hosts and services indexes are used.
+func (exec *gqlExecutor) fetchChildren(loader *gqlLoader, keys []gqlParentKey) error {
+	relation := loader.relation
+	userFilter, _ := loader.listData["filter"].(string)
+	batchSize := GraphQLBatchSize
+	if maxFilter := exec.controller.lmd.Config.MaxQueryFilter; maxFilter > 0 {
+		batchSize = max(1, min(batchSize, (maxFilter-strings.Count(userFilter, "\n"))/len(relation.childColumns)))
+	}
+	for start := 0; start < len(keys); start += batchSize {
+		batch := keys[start:min(start+batchSize, len(keys))]
+		filter := strings.Builder{}
+		filter.WriteString(userFilter)
+		backends := []interface{}{}
+		peers := make(map[string]bool)
+		for _, key := range batch {
+			for i, col := range relation.childColumns {
+				filter.WriteString(fmt.Sprintf("Filter: %s = %s\n", col, key.values[i]))
+			}
+			if len(relation.childColumns) > 1 {
+				filter.WriteString(fmt.Sprintf("And: %d\n", len(relation.childColumns)))
+			}
+			if key.peerKey != "" && !peers[key.peerKey] {
+				peers[key.peerKey] = true
+				backends = append(backends, key.peerKey)
+			}
+		}
+		if len(batch) > 1 {
+			filter.WriteString(fmt.Sprintf("Or: %d\n", len(batch)))
+		}
+
+		requestData := map[string]interface{}{
+			"table":  relation.table.Name.String(),
+			"filter": filter.String(),
+		}
+		if len(backends) > 0 {
+			requestData["backends"] = backends
+		}
+		if loader.authUser != "" {
+			requestData["authuser"] = loader.authUser
+		}
+		if sortLines, ok := loader.listData["sort"]; ok {
+			requestData["sort"] = sortLines
+		}
+		rows, err := exec.queryRows(requestData, loader.columns)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			values := make([]string, 0, len(relation.childColumns))
+			for _, col := range relation.childColumns {
+				values = append(values, gqlRawString(row[col]))
+			}
+			key := gqlMatchKey(gqlRawString(row["peer_key"]), values)
+			loader.children[key] = append(loader.children[key], &gqlRow{values: row, authUser: loader.authUser})
+		}
+	}
+
+	return nil
+}
+
+// queryRows runs the table request, failed backends are reported once per request.
+func (exec *gqlExecutor) queryRows(requestData map[string]interface{}, columns []interface{}) ([]map[string]json.RawMessage, error) {
+	requestData["columns"] = columns
+	result, _, _, err := exec.controller.restQuery(exec.ctx, requestData, "")
+	if err != nil {
+		return nil, err
+	}
+	for peerKey, msg := range result.Failed {
+		if !exec.failed[peerKey] {
+			exec.failed[peerKey] = true
+			exec.errors = append(exec.errors, gqlerrors.NewFormattedError(fmt.Sprintf("backend %s failed: %s", peerKey, msg)))
+		}
+	}
+
+	rows := make([]map[string]json.RawMessage, 0, len(result.Data))
+	for i := range result.Data {
+		rows = append(rows, result.object(i))
+	}
+
+	return rows, nil
+}
+
+// gqlArgs merges argument definitions.
+func gqlArgs(lists ...graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	args := graphql.FieldConfigArgument{}
+	for _, list := range lists {
+		maps.Copy(args, list)
+	}
+
+	return args
+}
+
+// gqlListArgs returns the arguments of fields returning lists of objects.
+func gqlListArgs() graphql.FieldConfigArgument {
+	stringList := graphql.NewList(graphql.NewNonNull(graphql.String))
+
+	return graphql.FieldConfigArgument{
+		"filter": {Type: stringList, Description: "livestatus filter expressions like \"state != 0\", multiple filters are combined with and. Header lines like \"Or: 2\" are passed through"},
+		"sort":   {Type: stringList, Description: "sort columns, prefix with - for descending order"},
+		"limit":  {Type: graphql.Int, Description: "maximum number of objects"},
+		"offset": {Type: graphql.Int, Description: "number of objects to skip"},
+	}
+}
+
+// gqlScopeArgs returns the arguments of root fields which apply to all nested relations as well.
+func gqlScopeArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"backends": {Type: graphql.NewList(graphql.NewNonNull(graphql.String)), Description: "list of backend ids"},
+		"authuser": {Type: graphql.String, Description: "return only objects visible for this contact"},
+	}
+}
+
+// gqlScopeRequestData adds the backends and authuser arguments to the request data.
+func gqlScopeRequestData(args, requestData map[string]interface{}) error {
+	backends, err := gqlArgStrings(args, "backends")
+	if err != nil {
+		return err
+	}
+	if len(backends) > 0 {
+		list := make([]interface{}, 0, len(backends))
+		for _, backend := range backends {
+			list = append(list, backend)
+		}
+		requestData["backends"] = list
+	}
+	if authUser, ok := args["authuser"]; ok {
+		name, ok := authUser.(string)
+		if !ok {
+			return fmt.Errorf("argument authuser must be a string")
+		}
+		if name != "" {
+			requestData["authuser"] = name
+		}
+	}
+
+	return nil
+}
+
+// gqlListRequestData adds the filter, sort, limit and offset arguments to the request data.
+func gqlListRequestData(args, requestData map[string]interface{}) error {
+	filters, err := gqlArgStrings(args, "filter")
+	if err != nil {
+		return err
+	}
+	filter := strings.Builder{}
+	for _, line := range filters {
+		if strings.ContainsAny(line, "\r\n") {
+			return fmt.Errorf("filter must not contain newlines")
+		}
+		line = strings.TrimSpace(line)
+		isHeader := false
+		for _, prefix := range graphQLFilterPrefixes {
+			if strings.HasPrefix(line, prefix) {
+				isHeader = true
+			}
+		}
+		if !isHeader {
+			line = "Filter: " + line
+		}
+		filter.WriteString(line + "\n")
+	}
+	if filter.Len() > 0 {
+		requestData["filter"] = filter.String()
+	}
+
+	sorts, err := gqlArgStrings(args, "sort")
+	if err != nil {
+		return err
+	}
+	sortLines := []interface{}{}
+	for _, name := range sorts {
+		switch {
+		case strings.Contains(name, " "):
+			sortLines = append(sortLines, name)
+		case strings.HasPrefix(name, "-"):
+			sortLines = append(sortLines, strings.TrimPrefix(name, "-")+" desc")
+		default:
+			sortLines = append(sortLines, strings.TrimPrefix(name, "+")+" asc")
+		}
+	}
+	if len(sortLines) > 0 {
+		requestData["sort"] = sortLines
+	}
+
+	for _, name := range []string{"limit", "offset"} {
+		value, ok := args[name]
+		if !ok {
+			continue
+		}
+		num, ok := gqlInt(value)
+		if !ok || num < 0 {
+			return fmt.Errorf("argument %s must be a positive number", name)
+		}
+		requestData[name] = num
+	}
+
+	return nil
+}
+
+// gqlArgStrings returns a list of strings argument, single values are accepted as list with one element.
+func gqlArgStrings(args map[string]interface{}, name string) ([]string, error) {
+	switch value := args[name].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{value}, nil
+	case []interface{}:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			str, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("argument %s must be a list of strings", name)
+			}
+			list = append(list, str)
+		}
+
+		return list, nil
+	}
+
+	return nil, fmt.Errorf("argument %s must be a list of strings", name)
+}
+
+// gqlInt converts integer arguments and json numbers.
+func gqlInt(value interface{}) (int, bool) {
+	switch num := value.(type) {
+	case int:
+		return num, true
+	case int64:
+		return int(num), true
+	case float64:
+		if num == float64(int(num)) {
+			return int(num), true
+		}
+	}
+
+	return 0, false
+}
+
+// gqlRawString returns json strings unquoted and all other values as is.
+func gqlRawString(raw json.RawMessage) string {
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return str
+	}
+
+	return string(raw)
+}
+
+// gqlMatchKey returns the key used to match child objects to their parents.
+func gqlMatchKey(peerKey string, values []string) string {
+	return peerKey + "\x00" + strings.Join(values, "\x00")
+}
+
+// gqlTypeName returns the object type name of a table, ex.: Hosts.
+func gqlTypeName(table *Table) string {
+	name := table.Name.String()
+
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// gqlSingularName returns the field name used for single objects of a table, ex.: host.
+func gqlSingularName(table *Table) string {
+	return strings.TrimSuffix(table.Name.String(), "s")
+}
+
+// gqlColumnType returns the graphql type of a column.
+func gqlColumnType(col *Column, int64Type, jsonType *graphql.Scalar) graphql.Output {
+	switch col.DataType {
+	case StringCol, StringLargeCol, JSONCol:
+		return graphql.String
+	case IntCol:
+		return graphql.Int
+	case Int64Col:
+		return int64Type
+	case FloatCol:
+		return graphql.Float
+	case StringListCol:
+		return graphql.NewList(graphql.NewNonNull(graphql.String))
+	case Int64ListCol:
+		return graphql.NewList(graphql.NewNonNull(int64Type))
+	case CustomVarCol, ServiceMemberListCol, InterfaceListCol:
+		return jsonType
+	default:
+		log.Panicf("type %s not supported", col.DataType)
+	}
+
+	return nil
+}
+
+// gqlColumnValue decodes the json value of a column according to its graphql type.
+func gqlColumnValue(col *Column, raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var value interface{}
+	var err error
+	switch col.DataType {
+	case StringCol, StringLargeCol, JSONCol:
+		return gqlRawString(raw), nil
+	case IntCol, Int64Col:
+		value, err = gqlDecode[int64](raw)
+	case FloatCol:
+		value, err = gqlDecode[float64](raw)
+	case StringListCol:
+		value, err = gqlDecode[[]string](raw)
+	case Int64ListCol:
+		value, err = gqlDecode[[]int64](raw)
+	default:
+		return raw, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("column %s: %s", col.Name, err.Error())
+	}
+
+	return value, nil
+}
+
+func gqlDecode[T any](raw json.RawMessage) (T, error) {
+	var value T
+	err := json.Unmarshal(raw, &value)
+
+	return value, err
+}
@@ -0,0 +1,177 @@
+package lmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphQLSchema(t *testing.T) {
+	schema := getGraphQLSchema()
+
+	hosts, ok := schema.schema.Type("Hosts").(*graphql.Object)
+	require.True(t, ok)
+	assert.Equal(t, "[Services!]", hosts.Fields()["services"].Type.String())
+	relation := schema.relations["Hosts"]["services"]
+	require.NotNil(t, relation)
+	assert.Equal(t, TableServices, relation.table.Name)
+	assert.Equal(t, []string{"name"}, relation.parentColumns)
+	assert.Equal(t, []string{"host_name"}, relation.childColumns)
+	assert.True(t, relation.list)
+
+	relation = schema.relations["Services"]["host"]
+	require.NotNil(t, relation)
+	assert.Equal(t, TableHosts, relation.table.Name)
+	assert.False(t, relation.list)
+	assert.Equal(t, []string{"host_name", "description"}, schema.relations["Services"]["comments"].parentColumns)
+	assert.Equal(t, []string{"host_name", "service_description"}, schema.relations["Services"]["comments"].childColumns)
+
+	query := schema.schema.QueryType().Fields()
+	assert.Contains(t, query, "hosts")
+	assert.Contains(t, query, "log")
+	assert.Equal(t, "Services", query["service"].Type.String())
+	hostsByGroup, ok := schema.schema.Type("Hostsbygroup").(*graphql.Object)
+	require.True(t, ok)
+	assert.NotContains(t, hostsByGroup.Fields(), "host")
+}
+
+func TestGraphQLEndpoint(t *testing.T) {
+	_, cleanup, _, client := StartTestHTTPPeer(t, 2, 10, 10, "")
+	post := func(query string, variables map[string]interface{}) (int, map[string]interface{}) {
+		body, err := json.Marshal(&GraphQLRequest{Query: query, Variables: variables})
+		require.NoError(t, err)
+		res := map[string]interface{}{}
+		recorder := client.SendJSON(http.MethodPost, "/graphql", string(body), &res)
+
+		return recorder.Code, res
+	}
+
+	// nested relations are resolved per backend
+	code, res := post(`{ hosts(filter: ["name = testhost_1"], sort: ["peer_key"]) {
+		name peer_key
+		services { description host { name } comments { id } }
+	} }`, nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Nil(t, res["errors"])
+	hosts := res["data"].(map[string]interface{})["hosts"].([]interface{})
+	require.Len(t, hosts, 2)
+	for i, host := range hosts {
+		obj := host.(map[string]interface{})
+		assert.Equal(t, []string{"mockid0", "mockid1"}[i], obj["peer_key"])
+		services := obj["services"].([]interface{})
+		require.NotEmpty(t, services)
+		for _, svc := range services {
+			assert.Equal(t, "testhost_1", svc.(map[string]interface{})["host"].(map[string]interface{})["name"])
+		}
+	}
+
+	// single objects by primary key
+	recorder := client.Send(http.MethodGet, "/graphql?query="+url.QueryEscape(`{ host(name: "testhost_2", backends: ["mockid0"]) { state name } }`), "")
+	assert.JSONEq(t, `{"data":{"host":{"state":0,"name":"testhost_2"}}}`, recorder.Body.String())
+
+	// variables, fragments and directives
+	code, res = post(`query($filter: [String!], $skip: Boolean!) {
+		unknown: host(name: "nonexisting") { name }
+		hosts(filter: $filter, limit: 1) { ...names state @skip(if: $skip) __typename }
+	}
+	fragment names on Hosts { name alias }`, map[string]interface{}{"filter": []string{"name = testhost_2"}, "skip": true})
+	require.Equal(t, http.StatusOK, code)
+	data := res["data"].(map[string]interface{})
+	assert.Nil(t, data["unknown"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "testhost_2", "alias": "testhost_2_ALIAS", "__typename": "Hosts"}}, data["hosts"])
+
+	// authuser applies to nested relations as well
+	code, res = post(`{ comments(authuser: "authuser") { host { name } } }`, nil)
+	require.Equal(t, http.StatusOK, code)
+	for _, comment := range res["data"].(map[string]interface{})["comments"].([]interface{}) {
+		assert.Equal(t, "testhost_2", comment.(map[string]interface{})["host"].(map[string]interface{})["name"])
+	}
+
+	// introspection
+	code, res = post(`{ __schema { queryType { name } } __type(name: "Services") { kind fields { name type { kind ofType { name } } } } }`, nil)
+	require.Equal(t, http.StatusOK, code)
+	data = res["data"].(map[string]interface{})
+	assert.Equal(t, "Query", data["__schema"].(map[string]interface{})["queryType"].(map[string]interface{})["name"])
+	typ := data["__type"].(map[string]interface{})
+	assert.Equal(t, "OBJECT", typ["kind"])
+	assert.Contains(t, typ["fields"], map[string]interface{}{"name": "comments", "type": map[string]interface{}{"kind": "LIST", "ofType": map[string]interface{}{"name": nil}}})
+
+	// invalid requests
+	for _, query := range []string{
+		`{ hosts { unknown } }`,
+		`{ hosts }`,
+		`{ hosts(unknown: 1) { name } }`,
+		`{ host { name } }`,
+		`{ hosts { name { x } } }`,
+		`{ hosts { ...missing } }`,
+		`{ hosts(filter: $undefined) { name } }`,
+		`mutation { hosts { name } }`,
+		`{ hosts { name`,
+	} {
+		code, res = post(query, nil)
+		assert.Equalf(t, http.StatusBadRequest, code, "query: %s", query)
+		assert.NotEmptyf(t, res["errors"], "query: %s", query)
+	}
+
+	code, res = post(`{ hosts(filter: ["name = x\nAuthUser: admin"]) { name } }`, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, res["data"].(map[string]interface{})["hosts"])
+	assert.Len(t, res["errors"], 1)
+
+	err := cleanup()
+	require.NoError(t, err)
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	_, cleanup, _, client := StartTestHTTPPeer(t, 1, 10, 10, "")
+	post := func(contentType, body string) (int, map[string]interface{}) {
+		res := map[string]interface{}{}
+		recorder := client.SendJSON(http.MethodPost, "/graphql", body, &res, "Content-Type: "+contentType)
+
+		return recorder.Code, res
+	}
+
+	// fragment cycles are rejected
+	code, res := post("application/graphql", `{ hosts { ...a } }
+	fragment a on Hosts { name ...b }
+	fragment b on Hosts { alias ...a }`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, fmt.Sprintf("%v", res["errors"]), "fragment a cannot spread itself")
+
+	// fragments spread repeatedly count with all their fields
+	spread := func(name string) string {
+		return strings.Repeat(" ..."+name, 10)
+	}
+	fanout := `{ hosts { ...a } }
+	fragment a on Hosts {` + spread("b") + ` }
+	fragment b on Hosts {` + spread("c") + ` }
+	fragment c on Hosts { name alias address state display_name notes notes_url action_url icon_image plugin_output long_plugin_output }`
+	code, res = post("application/graphql", fanout)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, fmt.Sprintf("%v", res["errors"]), "maximum of 1000 fields")
+
+	code, res = post("application/graphql", `{ hosts(limit: 1) { ...a } }
+	fragment a on Hosts {`+spread("b")+` }
+	fragment b on Hosts { name alias }`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, res["errors"])
+
+	// request bodies are limited in size
+	large := "{ hosts { name } }" + strings.Repeat(" ", GraphQLMaxBodySize)
+	code, _ = post("application/graphql", large)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+	body, err := json.Marshal(&GraphQLRequest{Query: large})
+	require.NoError(t, err)
+	code, _ = post("application/json", string(body))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+
+	err = cleanup()
+	require.NoError(t, err)
+}
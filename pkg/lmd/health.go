@@ -0,0 +1,291 @@
+package lmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/sasha-s/go-deadlock"
+)
+
+const (
+	// HealthLockTimeout sets the time after which a lock is considered deadlocked by the liveness check.
+	HealthLockTimeout = 5 * time.Second
+
+	// HealthLockProbeInterval sets the interval to retry busy locks during the liveness check.
+	HealthLockProbeInterval = 10 * time.Millisecond
+)
+
+// HealthStatus is the result of the liveness and readiness checks.
+type HealthStatus struct {
+	Peers      []*HealthPeer     `json:"peers"`
+	Listeners  []*HealthListener `json:"listeners"`
+	Errors     []string          `json:"errors,omitempty"`
+	Status     string            `json:"status"`
+	PeersUp    int               `json:"peers_up"`
+	PeersTotal int               `json:"peers_total"`
+	OK         bool              `json:"ok"`
+}
+
+// HealthPeer contains the health details of a single peer.
+type HealthPeer struct {
+	ID            string  `json:"id"`
+	Name          string  `json:"name"`
+	Status        string  `json:"status"`
+	Message       string  `json:"message,omitempty"`
+	LastUpdate    float64 `json:"last_update"`
+	LastUpdateAge float64 `json:"last_update_age"`
+	Paused        bool    `json:"paused"`
+	OK            bool    `json:"ok"`
+}
+
+// HealthListener contains the health details of a single listener.
+type HealthListener struct {
+	Listen          string `json:"listen"`
+	OpenConnections int64  `json:"open_connections"`
+	Listening       bool   `json:"listening"`
+}
+
+// healthz returns the liveness status. LMD is considered alive unless any update loop is stuck or any lock is deadlocked.
+func (c *HTTPServerController) healthz(wrt http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	status := c.lmd.checkLiveness()
+	sendHealthStatus(wrt, status)
+}
+
+// readyz returns the readiness status. LMD is ready once the initial sync has finished, all listeners are listening
+// and enough peers are up.
+func (c *HTTPServerController) readyz(wrt http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	status := c.lmd.checkReadiness()
+	sendHealthStatus(wrt, status)
+}
+
+// sendHealthStatus sends the status as json, failed checks are returned with status code 503.
+func sendHealthStatus(wrt http.ResponseWriter, status *HealthStatus) {
+	code := http.StatusOK
+	status.Status = "ok"
+	if !status.OK {
+		code = http.StatusServiceUnavailable
+		status.Status = "fail"
+	}
+	wrt.Header().Set("Content-Type", "application/json")
+	wrt.WriteHeader(code)
+	err := json.NewEncoder(wrt).Encode(status)
+	if err != nil {
+		log.Debugf("sending health status failed: %e", err)
+	}
+}
+
+// checkLiveness checks all update loops for progress and all central locks for deadlocks.
+func (lmd *Daemon) checkLiveness() *HealthStatus {
+	// concurrent checks wait for each other, so there is only one prober at a time
+	lmd.healthLock.Lock()
+	defer lmd.healthLock.Unlock()
+
+	status := &HealthStatus{OK: true}
+	blocked := probeLocks(map[string]*deadlock.RWMutex{"PeerMapLock": lmd.PeerMapLock, "ListenersLock": lmd.ListenersLock}, HealthLockTimeout)
+	if len(blocked) > 0 {
+		status.OK = false
+		for _, name := range blocked {
+			status.Errors = append(status.Errors, fmt.Sprintf("lock %s blocked for more than %s", name, HealthLockTimeout))
+		}
+
+		return status
+	}
+
+	peers := lmd.healthPeers()
+	locks := make(map[string]*deadlock.RWMutex, len(peers))
+	for _, peer := range peers {
+		locks[peer.ID] = peer.lock
+	}
+	blockedPeers := make(map[string]bool)
+	for _, id := range probeLocks(locks, HealthLockTimeout) {
+		blockedPeers[id] = true
+	}
+
+	// data locks can only be fetched from peers with working lock
+	locks = make(map[string]*deadlock.RWMutex, len(peers))
+	for _, peer := range peers {
+		if blockedPeers[peer.ID] {
+			continue
+		}
+		peer.lock.RLock()
+		data := peer.data
+		peer.lock.RUnlock()
+		if data != nil {
+			locks[peer.ID] = data.lock
+		}
+	}
+	blockedData := make(map[string]bool)
+	for _, id := range probeLocks(locks, HealthLockTimeout) {
+		blockedData[id] = true
+	}
+
+	now := currentUnixTime()
+	for _, peer := range peers {
+		detail := &HealthPeer{ID: peer.ID, Name: peer.Name, OK: true}
+		status.Peers = append(status.Peers, detail)
+		switch {
+		case blockedPeers[peer.ID]:
+			detail.Message = fmt.Sprintf("peer lock blocked for more than %s", HealthLockTimeout)
+		case blockedData[peer.ID]:
+			detail.Message = fmt.Sprintf("data lock blocked for more than %s", HealthLockTimeout)
+		default:
+			detail.Message = lmd.checkPeerUpdateLoop(peer, detail, now)
+		}
+		if detail.Message != "" {
+			detail.OK = false
+			status.OK = false
+		}
+	}
+	status.Listeners = lmd.healthListeners()
+
+	return status
+}
+
+// checkPeerUpdateLoop fills in the peer details and returns an error message if the update loop made no progress.
+// Sub peers are updated by their parent and paused peers have no running update loop, so both are not checked.
+func (lmd *Daemon) checkPeerUpdateLoop(peer *Peer, detail *HealthPeer, now float64) string {
+	peer.lock.RLock()
+	state := peer.PeerState
+	detail.Status = state.String()
+	detail.LastUpdate = peer.LastUpdate
+	detail.Paused = peer.Paused
+	idling := peer.Idling
+	parentID := peer.ParentID
+	peer.lock.RUnlock()
+
+	lastUpdate := max(detail.LastUpdate, lmd.lastMainRestart)
+	detail.LastUpdateAge = now - lastUpdate
+	if detail.Paused || parentID != "" || lmd.Config.LivenessUpdateTimeout == 0 {
+		return ""
+	}
+
+	interval := lmd.Config.UpdateInterval
+	if idling {
+		interval = lmd.Config.IdleInterval
+	}
+	maxAge := float64(interval + lmd.Config.LivenessUpdateTimeout)
+	if detail.LastUpdateAge > maxAge {
+		return fmt.Sprintf("update loop stuck, no update for %.0f seconds", detail.LastUpdateAge)
+	}
+
+	return ""
+}
+
+// checkReadiness checks the initial sync, all listeners and the fraction of peers which are up.
+func (lmd *Daemon) checkReadiness() *HealthStatus {
+	status := &HealthStatus{OK: true}
+	if !lmd.initialized.Load() {
+		status.OK = false
+		status.Errors = append(status.Errors, "initial sync not finished")
+	}
+
+	for _, listener := range lmd.healthListeners() {
+		status.Listeners = append(status.Listeners, listener)
+		if !listener.Listening {
+			status.OK = false
+			status.Errors = append(status.Errors, fmt.Sprintf("listener %s not listening", listener.Listen))
+		}
+	}
+
+	now := currentUnixTime()
+	for _, peer := range lmd.healthPeers() {
+		peer.lock.RLock()
+		detail := &HealthPeer{
+			ID:         peer.ID,
+			Name:       peer.Name,
+			Status:     peer.PeerState.String(),
+			Message:    peer.LastError,
+			LastUpdate: peer.LastUpdate,
+			Paused:     peer.Paused,
+		}
+		peer.lock.RUnlock()
+		detail.LastUpdateAge = now - max(detail.LastUpdate, lmd.lastMainRestart)
+		status.Peers = append(status.Peers, detail)
+
+		// paused peers are served by other cluster nodes
+		if detail.Paused {
+			detail.OK = true
+
+			continue
+		}
+		status.PeersTotal++
+		if peer.hasPeerState([]PeerStatus{PeerStatusUp}) {
+			detail.OK = true
+			status.PeersUp++
+		}
+	}
+
+	if status.PeersTotal > 0 && float64(status.PeersUp)*100 < lmd.Config.ReadinessPeersUp*float64(status.PeersTotal) {
+		status.OK = false
+		status.Errors = append(status.Errors, fmt.Sprintf("only %d of %d peers up, required: %.0f%%", status.PeersUp, status.PeersTotal, lmd.Config.ReadinessPeersUp))
+	}
+
+	return status
+}
+
+// healthPeers returns all peers sorted by id.
+func (lmd *Daemon) healthPeers() (peers []*Peer) {
+	lmd.PeerMapLock.RLock()
+	for _, peer := range lmd.PeerMap {
+		peers = append(peers, peer)
+	}
+	lmd.PeerMapLock.RUnlock()
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+
+	return peers
+}
+
+// healthListeners returns the details of all listeners sorted by address.
+func (lmd *Daemon) healthListeners() (listeners []*HealthListener) {
+	lmd.ListenersLock.RLock()
+	for _, listener := range lmd.Listeners {
+		listener.Lock.RLock()
+		listeners = append(listeners, &HealthListener{
+			Listen:          listener.connectionString,
+			Listening:       listener.Connection != nil,
+			OpenConnections: listener.openConnections,
+		})
+		listener.Lock.RUnlock()
+	}
+	lmd.ListenersLock.RUnlock()
+	sort.Slice(listeners, func(i, j int) bool { return listeners[i].Listen < listeners[j].Listen })
+
+	return listeners
+}
+
+// probeLocks tries to read lock all given locks without blocking and returns the sorted names of all locks
+// which could not be acquired at any time within the timeout. Busy locks, ex. with a waiting writer,
+// are retried until the timeout, so only locks which stay blocked are reported.
+func probeLocks(locks map[string]*deadlock.RWMutex, timeout time.Duration) (blocked []string) {
+	pending := make(map[string]*deadlock.RWMutex, len(locks))
+	for name, lock := range locks {
+		pending[name] = lock
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		for name, lock := range pending {
+			if lock.TryRLock() {
+				lock.RUnlock()
+				delete(pending, name)
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(HealthLockProbeInterval)
+	}
+
+	for name := range pending {
+		blocked = append(blocked, name)
+	}
+	sort.Strings(blocked)
+
+	return blocked
+}
@@ -0,0 +1,95 @@
+package lmd
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	_, cleanup, mocklmd, client := StartTestHTTPPeer(t, 2, 10, 10, "")
+	get := func(path string) (int, *HealthStatus) {
+		status := &HealthStatus{}
+		recorder := client.SendJSON(http.MethodGet, path, "", status)
+
+		return recorder.Code, status
+	}
+
+	code, status := get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", status.Status)
+	assert.Equal(t, 2, status.PeersUp)
+	assert.Equal(t, 2, status.PeersTotal)
+	require.Len(t, status.Listeners, 1)
+	assert.True(t, status.Listeners[0].Listening)
+
+	code, status = get("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, status.Peers, 2)
+
+	// peers which are down reduce readiness
+	mocklmd.PeerMap["mockid0"].setBroken("test")
+	mocklmd.Config.ReadinessPeersUp = 100
+	code, status = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, 1, status.PeersUp)
+	mocklmd.Config.ReadinessPeersUp = 50
+	code, _ = get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+
+	// peers without update progress fail the liveness check
+	lastMainRestart := mocklmd.lastMainRestart
+	mocklmd.lastMainRestart = currentUnixTime() - 1000
+	mocklmd.PeerMap["mockid1"].statusSetLocked(LastUpdate, currentUnixTime()-1000)
+	code, status = get("/healthz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "fail", status.Status)
+	for _, detail := range status.Peers {
+		assert.Equalf(t, detail.ID != "mockid1", detail.OK, "peer %s", detail.ID)
+	}
+	mocklmd.lastMainRestart = lastMainRestart
+
+	err := cleanup()
+	require.NoError(t, err)
+}
+
+func TestHealthProbeLocks(t *testing.T) {
+	free := new(deadlock.RWMutex)
+	locked := new(deadlock.RWMutex)
+	// the lock is held by another goroutine, like a deadlocked update loop
+	isLocked := make(chan bool)
+	unlock := make(chan bool)
+	go func() {
+		locked.Lock()
+		isLocked <- true
+		<-unlock
+		locked.Unlock()
+	}()
+	<-isLocked
+	defer close(unlock)
+
+	blocked := probeLocks(map[string]*deadlock.RWMutex{"free": free, "locked": locked}, 50*time.Millisecond)
+	assert.Equal(t, []string{"locked"}, blocked)
+
+	assert.Empty(t, probeLocks(map[string]*deadlock.RWMutex{"free": free}, 50*time.Millisecond))
+
+	// locks released within the timeout are not reported, even with a waiting writer
+	busy := new(deadlock.RWMutex)
+	go func() {
+		busy.RLock()
+		isLocked <- true
+		time.Sleep(20 * time.Millisecond)
+		busy.RUnlock()
+	}()
+	<-isLocked
+	go func() {
+		busy.Lock()
+		time.Sleep(20 * time.Millisecond)
+		busy.Unlock()
+	}()
+	assert.Empty(t, probeLocks(map[string]*deadlock.RWMutex{"busy": busy}, time.Second))
+}
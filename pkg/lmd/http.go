@@ -1,6 +1,7 @@
 package lmd
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -16,10 +17,15 @@ type HTTPServerController struct {
 }
 
 func (c *HTTPServerController) errorOutput(err error, wrt http.ResponseWriter) {
+	httpErrorOutput(err, wrt, http.StatusBadRequest)
+}
+
+// httpErrorOutput sends the error as json with given status code.
+func httpErrorOutput(err error, wrt http.ResponseWriter, status int) {
 	j := make(map[string]interface{})
 	j["error"] = err.Error()
 	wrt.Header().Set("Content-Type", "application/json")
-	wrt.WriteHeader(http.StatusBadRequest)
+	wrt.WriteHeader(status)
 	err = json.NewEncoder(wrt).Encode(j)
 	if err != nil {
 		log.Debugf("encoder failed: %e", err)
@@ -30,31 +36,78 @@ func (c *HTTPServerController) index(w http.ResponseWriter, _ *http.Request, _ h
 	fmt.Fprintf(w, "LMD %s\n", VERSION)
 }
 
-func (c *HTTPServerController) queryTable(ctx context.Context, wrt http.ResponseWriter, requestData map[string]interface{}) {
+func (c *HTTPServerController) queryTable(ctx context.Context, wrt http.ResponseWriter, request *http.Request, requestData map[string]interface{}) {
 	wrt.Header().Set("Content-Type", "application/json")
 
-	// Requested table (name)
-	_, err := NewTableName(interface2stringNoDedup(requestData["table"]))
-	// Check if table exists
+	buf, etag, status, err := c.executeTableQuery(ctx, requestData, request.Header.Get("If-None-Match"))
 	if err != nil {
-		c.errorOutput(err, wrt)
+		if status == http.StatusTooManyRequests {
+			wrt.Header().Set("Retry-After", "1")
+		}
+		httpErrorOutput(err, wrt, status)
 
 		return
 	}
+	if httpNotModified(wrt, etag, status) {
+		return
+	}
+
+	_, err = buf.WriteTo(wrt)
+	if err != nil {
+		log.Debugf("writeto failed: %e", err)
+	}
+}
+
+// executeTableQuery parses, authorizes and runs the table request.
+// It returns the json result and its entity tag or an error along with the http status code.
+// If the entity tag matches ifNoneMatch, the response is not built and http.StatusNotModified is returned.
+func (c *HTTPServerController) executeTableQuery(ctx context.Context, requestData map[string]interface{}, ifNoneMatch string) (buf *bytes.Buffer, etag string, status int, err error) {
+	// Requested table (name)
+	_, err = NewTableName(interface2stringNoDedup(requestData["table"]))
+	// Check if table exists
+	if err != nil {
+		return nil, "", http.StatusBadRequest, err
+	}
 
 	req, err := parseRequestDataToRequest(requestData)
 	if err != nil {
-		c.errorOutput(err, wrt)
+		return nil, "", http.StatusBadRequest, err
+	}
+	req.lmd = c.lmd
 
-		return
+	err = applyHTTPAuth(ctx, c.lmd, req)
+	if err == nil {
+		err = applyForwardedACL(ctx, c.lmd, req, requestData)
+	}
+	if err == nil {
+		err = req.SetRequestColumns()
+	}
+	if err == nil {
+		err = req.SetSortColumns()
 	}
+	if err != nil {
+		return nil, "", http.StatusBadRequest, err
+	}
+
+	remoteAddr, _ := ctx.Value(CtxRemoteAddr).(string)
+	listen, _ := ctx.Value(CtxListener).(string)
+	release, err := c.lmd.admitRequest(remoteAddr, req.AuthUser, listen)
+	if err != nil {
+		log.Warnf("rejected http request from %s: %s", remoteAddr, err.Error())
+
+		return nil, "", http.StatusTooManyRequests, err
+	}
+	defer release()
 
 	// Fetch backend data
 	err = req.ExpandRequestedBackends()
 	if err != nil {
-		c.errorOutput(err, wrt)
-
-		return
+		return nil, "", http.StatusBadRequest, err
+	}
+	req.changeToken = req.ChangeToken()
+	etag = httpETag(req.changeToken)
+	if httpETagMatch(ifNoneMatch, etag) {
+		return nil, etag, http.StatusNotModified, nil
 	}
 
 	var res *Response
@@ -66,22 +119,16 @@ func (c *HTTPServerController) queryTable(ctx context.Context, wrt http.Response
 		res, err = req.BuildResponse(ctx)
 	}
 	if err != nil {
-		c.errorOutput(err, wrt)
-
-		return
+		return nil, "", http.StatusBadRequest, err
 	}
 
 	// Send JSON
-	buf, err := res.Buffer()
+	buf, err = res.Buffer()
 	if err != nil {
-		c.errorOutput(err, wrt)
-
-		return
-	}
-	_, err = buf.WriteTo(wrt)
-	if err != nil {
-		log.Debugf("writeto failed: %e", err)
+		return nil, "", http.StatusBadRequest, err
 	}
+
+	return buf, etag, http.StatusOK, nil
 }
 
 func (c *HTTPServerController) table(wrt http.ResponseWriter, request *http.Request, params httprouter.Params) {
@@ -100,7 +147,7 @@ func (c *HTTPServerController) table(wrt http.ResponseWriter, request *http.Requ
 		requestData["table"] = tableName
 	}
 
-	c.queryTable(request.Context(), wrt, requestData)
+	c.queryTable(request.Context(), wrt, request, requestData)
 }
 
 func (c *HTTPServerController) ping(wrt http.ResponseWriter, request *http.Request, _ httprouter.Params) {
@@ -154,7 +201,11 @@ func (c *HTTPServerController) query(wrt http.ResponseWriter, request *http.Requ
 	case "ping":
 		c.queryPing(wrt, requestData)
 	case "table":
-		c.queryTable(request.Context(), wrt, requestData)
+		c.queryTable(request.Context(), wrt, request, requestData)
+	case "commands":
+		c.queryCommands(request.Context(), wrt, requestData)
+	case "peeradmin":
+		c.queryPeerAdmin(request.Context(), wrt, requestData)
 	default:
 		c.errorOutput(fmt.Errorf("unknown request: %s", requestedFunction), wrt)
 	}
@@ -169,6 +220,11 @@ func parseRequestDataToRequest(requestData map[string]interface{}) (req *Request
 	}
 	req.Table = table
 
+	// AuthUser
+	if val, ok := requestData["authuser"]; ok {
+		req.AuthUser = interface2stringNoDedup(val)
+	}
+
 	// Send header row by default
 	req.ColumnsHeaders = true
 	if val, ok := requestData["sendcolumnsheader"]; ok {
@@ -291,9 +347,23 @@ func initializeHTTPRouter(lmd *Daemon) (handler http.Handler) {
 	router.GET("/table/:name", controller.table)
 	router.POST("/table/:name", controller.table)
 	router.POST("/ping", controller.ping)
+	router.GET("/healthz", controller.healthz)
+	router.GET("/readyz", controller.readyz)
 	router.POST("/query", controller.query)
-
-	handler = router
+	router.POST("/livestatus", controller.livestatus)
+	router.POST("/commands", controller.commands)
+	router.POST("/admin/peers", controller.addPeerAdmin)
+	router.DELETE("/admin/peers/:id", controller.removePeerAdmin)
+	router.POST("/admin/peers/:id/:action", controller.actionPeerAdmin)
+	router.GET("/stream", controller.stream)
+	router.GET("/events", controller.events)
+	router.GET("/openapi.json", controller.openapi)
+	router.GET("/graphql", controller.graphql)
+	router.POST("/graphql", controller.graphql)
+	router.GET("/websocket", controller.websocket)
+	registerRESTRoutes(router, controller)
+
+	handler = authenticateHTTP(lmd, router)
 
 	return
 }
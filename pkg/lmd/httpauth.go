@@ -0,0 +1,167 @@
+package lmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// unauthenticatedPaths can be requested without api token or client certificate, ex. by liveness and readiness probes.
+var unauthenticatedPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// authenticateHTTP wraps the handler and rejects all requests without a valid api token.
+// Token authentication is disabled unless api tokens are configured. Requests with the NodeToken
+// are accepted in any case and marked as sent by another cluster node. On https listeners the
+// AuthUser is taken from the client certificate if TLSClientAuthUser is set.
+func authenticateHTTP(lmd *Daemon, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(wrt http.ResponseWriter, request *http.Request) {
+		if unauthenticatedPaths[request.URL.Path] {
+			next.ServeHTTP(wrt, request)
+
+			return
+		}
+		ctx := request.Context()
+		if source := lmd.Config.TLSClientAuthUser; source != "" && request.TLS != nil {
+			authUser, err := tlsClientAuthUser(request.TLS, source)
+			if err != nil {
+				log.Warnf("http request %s %s from %s rejected: %s", request.Method, request.URL.Path, request.RemoteAddr, err.Error())
+				httpErrorOutput(fmt.Errorf("unauthorized"), wrt, http.StatusUnauthorized)
+
+				return
+			}
+			log.Debugf("http request %s %s from %s authenticated by client certificate as %s", request.Method, request.URL.Path, request.RemoteAddr, authUser)
+			ctx = context.WithValue(ctx, CtxAuthUser, authUser)
+		}
+
+		if nodeToken := lmd.Config.NodeToken; nodeToken != "" {
+			if subtle.ConstantTimeCompare([]byte(extractAPIToken(request)), []byte(nodeToken)) == 1 {
+				log.Debugf("http request %s %s from %s authenticated by NodeToken", request.Method, request.URL.Path, request.RemoteAddr)
+				next.ServeHTTP(wrt, request.WithContext(context.WithValue(ctx, CtxNodeAuth, true)))
+
+				return
+			}
+		}
+
+		tokens := lmd.Config.APITokens
+		if len(tokens) == 0 {
+			next.ServeHTTP(wrt, request.WithContext(ctx))
+
+			return
+		}
+
+		token := lookupAPIToken(tokens, extractAPIToken(request))
+		if token == nil {
+			log.Warnf("http request %s %s from %s rejected: invalid or missing api token", request.Method, request.URL.Path, request.RemoteAddr)
+			wrt.Header().Set("WWW-Authenticate", `Bearer realm="lmd"`)
+			httpErrorOutput(fmt.Errorf("unauthorized"), wrt, http.StatusUnauthorized)
+
+			return
+		}
+
+		log.Infof("http request %s %s from %s with token %s", request.Method, request.URL.Path, request.RemoteAddr, token.Name)
+		ctx = context.WithValue(ctx, CtxAPIToken, token)
+		next.ServeHTTP(wrt, request.WithContext(ctx))
+	})
+}
+
+// extractAPIToken returns the token from either the Authorization or the X-API-Key header.
+func extractAPIToken(request *http.Request) string {
+	if auth := request.Header.Get("Authorization"); auth != "" {
+		scheme, token, ok := strings.Cut(auth, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+
+		return ""
+	}
+
+	return request.Header.Get("X-API-Key")
+}
+
+// lookupAPIToken returns the configured token matching the given value or nil.
+// All tokens are compared in constant time to not leak which token matched.
+func lookupAPIToken(tokens []APIToken, value string) (match *APIToken) {
+	if value == "" {
+		return nil
+	}
+	for i := range tokens {
+		token := &tokens[i]
+		if token.Token == "" {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(token.Token), []byte(value)) == 1 && match == nil {
+			match = token
+		}
+	}
+
+	return match
+}
+
+// applyHTTPAuth restricts the request to the AuthUser and ACL of the api token or client certificate used for this http request.
+func applyHTTPAuth(ctx context.Context, lmd *Daemon, req *Request) error {
+	if token, ok := ctx.Value(CtxAPIToken).(*APIToken); ok {
+		if token.AuthUser != "" {
+			req.AuthUser = token.AuthUser
+		}
+		if token.ACL != "" {
+			acl := NewRequestACLByName(lmd, token.ACL)
+			if acl == nil {
+				return fmt.Errorf("bad request: unknown acl %s", token.ACL)
+			}
+			req.SetACL(acl)
+		}
+	}
+	// the AuthUser from client certificates cannot be changed by the client
+	if authUser, ok := ctx.Value(CtxAuthUser).(string); ok && authUser != "" {
+		if req.AuthUser != "" && req.AuthUser != authUser {
+			logWith(ctx).Debugf("replacing requested AuthUser %s with %s from client certificate", req.AuthUser, authUser)
+		}
+		req.AuthUser = authUser
+	}
+
+	return nil
+}
+
+// applyForwardedACL restricts the request to the ACL forwarded by another cluster node.
+// Only unrestricted clients, like other nodes using a NodeToken, may select an ACL by name.
+func applyForwardedACL(ctx context.Context, lmd *Daemon, req *Request, requestData map[string]interface{}) error {
+	val, ok := requestData["acl"]
+	if !ok {
+		return nil
+	}
+	if isRestrictedHTTPAuth(ctx) {
+		return fmt.Errorf("bad request: acl cannot be selected with a restricted api token or client certificate")
+	}
+	name := interface2stringNoDedup(val)
+	acl := NewRequestACLByName(lmd, name)
+	if acl == nil {
+		return fmt.Errorf("bad request: unknown acl %s", name)
+	}
+	req.SetACL(acl)
+
+	return nil
+}
+
+// isRestrictedHTTPAuth returns true if the api token or client certificate of this http request limits it to an AuthUser or ACL.
+func isRestrictedHTTPAuth(ctx context.Context) bool {
+	if token, ok := ctx.Value(CtxAPIToken).(*APIToken); ok && (token.AuthUser != "" || token.ACL != "") {
+		return true
+	}
+	if authUser, ok := ctx.Value(CtxAuthUser).(string); ok && authUser != "" {
+		return true
+	}
+
+	return false
+}
+
+// isNodeHTTPAuth returns true if this http request is authenticated with the NodeToken used by other cluster nodes.
+func isNodeHTTPAuth(ctx context.Context) bool {
+	nodeAuth, _ := ctx.Value(CtxNodeAuth).(bool)
+
+	return nodeAuth
+}
@@ -0,0 +1,119 @@
+package lmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupAPIToken(t *testing.T) {
+	tokens := []APIToken{
+		{Name: "empty"},
+		{Name: "first", Token: "secret1"},
+		{Name: "second", Token: "secret2"},
+	}
+	assert.Nil(t, lookupAPIToken(tokens, ""))
+	assert.Nil(t, lookupAPIToken(tokens, "secret"))
+	assert.Nil(t, lookupAPIToken(tokens, "secret10"))
+	require.NotNil(t, lookupAPIToken(tokens, "secret2"))
+	assert.Equal(t, "second", lookupAPIToken(tokens, "secret2").Name)
+}
+
+func TestHTTPTokenAuth(t *testing.T) {
+	_, cleanup, mocklmd, client := StartTestHTTPPeer(t, 1, 2, 2, "")
+
+	mocklmd.Config.ACL = []ACL{{Name: "nohosts", Tables: []string{"services"}}}
+	mocklmd.Config.APITokens = []APIToken{
+		{Name: "admin", Token: "admintoken"},
+		{Name: "user", Token: "usertoken", AuthUser: "authuser"},
+		{Name: "restricted", Token: "restrictedtoken", ACL: "nohosts"},
+	}
+	query := func(headers ...string) (int, []interface{}) {
+		var result []interface{}
+		recorder := client.SendJSON(http.MethodPost, "/table/hosts", `{"columns":["name"],"authuser":"nobody"}`, &result, headers...)
+
+		return recorder.Code, result
+	}
+
+	code, _ := query()
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = query("Authorization: Bearer wrongtoken")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = query("Authorization: Basic admintoken")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// token without authuser keeps the authuser from the request
+	code, result := query("Authorization: Bearer admintoken")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, result, 1) // column header only
+
+	// token authuser overrides the authuser from the request
+	code, result = query("X-API-Key: usertoken")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, result, 2)
+
+	// acl from token
+	code, _ = query("Authorization: Bearer restrictedtoken")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// health checks do not require a token
+	for _, path := range []string{"/healthz", "/readyz"} {
+		recorder := client.Send(http.MethodGet, path, "")
+		assert.NotEqualf(t, http.StatusUnauthorized, recorder.Code, "path: %s", path)
+	}
+
+	err := cleanup()
+	require.NoError(t, err)
+}
+
+func TestTLSClientAuthUser(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "certuser"},
+		EmailAddresses: []string{"certuser@example.com"},
+	}
+	state := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	authUser, err := tlsClientAuthUser(state, TLSClientAuthUserCN)
+	require.NoError(t, err)
+	assert.Equal(t, "certuser", authUser)
+
+	authUser, err = tlsClientAuthUser(state, TLSClientAuthUserEmail)
+	require.NoError(t, err)
+	assert.Equal(t, "certuser@example.com", authUser)
+
+	_, err = tlsClientAuthUser(state, TLSClientAuthUserDNS)
+	require.ErrorContains(t, err, "no dns")
+
+	_, err = tlsClientAuthUser(&tls.ConnectionState{}, TLSClientAuthUserCN)
+	require.ErrorContains(t, err, "client certificate required")
+
+	// AuthUser header cannot override the certificate user
+	lmd := createTestLMDInstance()
+	ctx := context.WithValue(context.TODO(), CtxAuthUser, "certuser")
+	req, _, err := NewRequest(ctx, lmd, bufio.NewReader(bytes.NewBufferString("GET hosts\nAuthUser: admin\n\n")), ParseDefault)
+	require.NoError(t, err)
+	assert.Equal(t, "certuser", req.AuthUser)
+
+	// https requests without verified certificate are rejected
+	lmd.Config.TLSClientAuthUser = TLSClientAuthUserCN
+	client := NewTestHTTPClient(t, lmd)
+	request := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	request.TLS = &tls.ConnectionState{}
+	recorder := client.Do(request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	request.TLS = state
+	recorder = client.Do(request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,447 @@
+package lmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/sasha-s/go-deadlock"
+)
+
+var reCommandName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// CommandRequest is the json request to send an external command over the http api.
+type CommandRequest struct {
+	WaitCondition *CommandWaitCondition `json:"wait_condition,omitempty"`
+	Command       string                `json:"command"`
+	AuthUser      string                `json:"authuser,omitempty"`
+	Args          []string              `json:"args,omitempty"`
+	Backends      []string              `json:"backends,omitempty"`
+	Resolve       bool                  `json:"resolve,omitempty"`     // send to backends containing the target object only, default without backends
+	Distributed   bool                  `json:"distributed,omitempty"` // set by cluster nodes forwarding the command to the owning node, ignored on /commands
+}
+
+// CommandWaitCondition waits after sending the command till the condition matches, like WaitCondition headers in livestatus queries.
+type CommandWaitCondition struct {
+	Table      string   `json:"table,omitempty"`  // defaults to the table of the command target
+	Object     string   `json:"object,omitempty"` // defaults to the command target
+	Trigger    string   `json:"trigger,omitempty"`
+	Conditions []string `json:"conditions"`
+	Timeout    int      `json:"timeout,omitempty"` // milliseconds
+	Negate     bool     `json:"negate,omitempty"`
+}
+
+// CommandResponse contains the combined and the per backend results of a command request.
+type CommandResponse struct {
+	Results map[string]*CommandPeerResult `json:"results"`
+	Command string                        `json:"command"`
+	Message string                        `json:"message"`
+	Code    int                           `json:"code"`
+}
+
+// commands sends the external command from the json request to all selected backends.
+func (c *HTTPServerController) commands(wrt http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	cmdReq := &CommandRequest{}
+	defer request.Body.Close()
+	if err := json.NewDecoder(request.Body).Decode(cmdReq); err != nil {
+		c.errorOutput(fmt.Errorf("request not understood"), wrt)
+
+		return
+	}
+	// only commands forwarded by other cluster nodes are distributed already
+	cmdReq.Distributed = false
+	c.sendCommandRequest(request.Context(), wrt, cmdReq)
+}
+
+// queryCommands handles commands forwarded by other cluster nodes.
+// Only requests authenticated with the NodeToken may mark the command as distributed.
+func (c *HTTPServerController) queryCommands(ctx context.Context, wrt http.ResponseWriter, requestData map[string]interface{}) {
+	cmdReq := &CommandRequest{}
+	raw, err := json.Marshal(requestData)
+	if err == nil {
+		err = json.Unmarshal(raw, cmdReq)
+	}
+	if err != nil {
+		c.errorOutput(fmt.Errorf("request not understood"), wrt)
+
+		return
+	}
+	if cmdReq.Distributed && !isNodeHTTPAuth(ctx) {
+		log.Warnf("rejected distributed command %s: request not authenticated by NodeToken", cmdReq.Command)
+		httpErrorOutput(fmt.Errorf("forbidden: distributed commands require the NodeToken"), wrt, http.StatusForbidden)
+
+		return
+	}
+	c.sendCommandRequest(ctx, wrt, cmdReq)
+}
+
+// sendCommandRequest runs the command request and sends the response.
+// Forwarded requests always get a command response, so the forwarding node can report errors per backend.
+func (c *HTTPServerController) sendCommandRequest(ctx context.Context, wrt http.ResponseWriter, cmdReq *CommandRequest) {
+	res, status, err := c.lmd.executeCommandRequest(ctx, cmdReq)
+	if err != nil {
+		if !cmdReq.Distributed {
+			if status == http.StatusTooManyRequests {
+				wrt.Header().Set("Retry-After", "1")
+			}
+			httpErrorOutput(err, wrt, status)
+
+			return
+		}
+		res = &CommandResponse{Code: status, Message: err.Error(), Results: make(map[string]*CommandPeerResult)}
+		for _, peerKey := range cmdReq.Backends {
+			res.Results[peerKey] = &CommandPeerResult{Name: c.lmd.peerName(peerKey), Code: status, Message: err.Error()}
+		}
+	}
+
+	wrt.Header().Set("Content-Type", "application/json")
+	if cmdReq.Distributed {
+		wrt.WriteHeader(http.StatusOK)
+	} else {
+		wrt.WriteHeader(res.Code)
+	}
+	restWriteJSON(wrt, res)
+}
+
+// executeCommandRequest authorizes the command and sends it to the backends containing the target object.
+// Backends owned by other cluster nodes are forwarded to these nodes.
+// It returns the response or an error along with the status code.
+func (lmd *Daemon) executeCommandRequest(ctx context.Context, cmdReq *CommandRequest) (*CommandResponse, int, error) {
+	remoteAddr, _ := ctx.Value(CtxRemoteAddr).(string)
+	listen, _ := ctx.Value(CtxListener).(string)
+
+	line, err := cmdReq.commandLine()
+	if err != nil {
+		return nil, ReturnCodeBadRequest, err
+	}
+	req := &Request{lmd: lmd, Command: line, AuthUser: cmdReq.AuthUser, Backends: cmdReq.Backends}
+	if err = applyHTTPAuth(ctx, lmd, req); err != nil {
+		return nil, ReturnCodeBadRequest, err
+	}
+	if err = req.ExpandRequestedBackends(); err != nil {
+		return nil, ReturnCodeBadRequest, err
+	}
+	for _, peerKey := range cmdReq.Backends {
+		if msg, ok := req.BackendErrors[peerKey]; ok {
+			return nil, ReturnCodeBadRequest, errors.New(msg)
+		}
+	}
+
+	entry := &AuditEntry{Time: time.Now(), Action: AuditActionCommand, Client: remoteAddr, AuthUser: req.AuthUser, Command: line}
+	reject := func(err error, code int) (*CommandResponse, int, error) {
+		log.Warnf("rejected http command from %s: %s", remoteAddr, err.Error())
+		entry.Code = code
+		entry.Message = err.Error()
+		lmd.audit(entry)
+
+		return nil, code, err
+	}
+
+	// the request slot is held until the command is sent
+	release, err := lmd.admitRequest(remoteAddr, req.AuthUser, listen)
+	if err != nil {
+		return reject(err, ReturnCodeTooManyRequests)
+	}
+	defer release()
+
+	cmd, err := lmd.checkCommandAllowed(req, listen)
+	if err != nil {
+		var commandErr *CommandError
+		if errors.As(err, &commandErr) {
+			return reject(err, commandErr.code)
+		}
+
+		return reject(err, ReturnCodeInternalError)
+	}
+
+	waitReq, err := lmd.commandWaitRequest(ctx, cmd, cmdReq.WaitCondition)
+	if err != nil {
+		return reject(err, ReturnCodeBadRequest)
+	}
+
+	local, remote := lmd.splitCommandBackends(req, cmdReq.Distributed)
+	resolve := cmdReq.Resolve || len(cmdReq.Backends) == 0
+	if cmd.hasTarget() && (resolve || req.AuthUser != "") {
+		local = lmd.commandTargetBackends(cmd, local, req.AuthUser)
+	}
+	if len(local) == 0 && len(remote) == 0 && cmd.hasTarget() {
+		if req.AuthUser != "" {
+			return reject(fmt.Errorf("%s is not authorized for the target of command %s", req.AuthUser, cmd.Name), ReturnCodeForbidden)
+		}
+
+		return reject(fmt.Errorf("not found: target of command %s", cmd.Name), ReturnCodeNotFound)
+	}
+	if len(local) > 0 && lmd.flags.flagImport != "" {
+		return reject(fmt.Errorf("lmd started with -import from file, cannot send commands without real backend connection"), ReturnCodeInternalError)
+	}
+
+	res := &CommandResponse{Command: line, Results: make(map[string]*CommandPeerResult)}
+	lock := new(deadlock.Mutex)
+	wgroup := &sync.WaitGroup{}
+	for nodeID, backends := range remote {
+		wgroup.Add(1)
+		go func(nodeID string, backends []string) {
+			defer lmd.logPanicExit()
+			defer wgroup.Done()
+			results := lmd.forwardCommandRequest(ctx, nodeID, backends, cmdReq, req.AuthUser, resolve)
+			lock.Lock()
+			for peerKey, result := range results {
+				res.Results[peerKey] = result
+			}
+			lock.Unlock()
+		}(nodeID, backends)
+	}
+
+	if len(local) > 0 {
+		commandsByPeer := make(map[string][]string, len(local))
+		for _, peerKey := range local {
+			commandsByPeer[peerKey] = []string{line}
+		}
+		results := lmd.sendPeerCommands(ctx, commandsByPeer)
+		if waitReq != nil {
+			lmd.waitCommandCondition(ctx, waitReq, results)
+		}
+		entry.Peers = local
+		entry.setCommandResults(results)
+		entry.Duration = time.Since(entry.Time).Seconds()
+		lmd.audit(entry)
+		lock.Lock()
+		for peerKey, result := range results {
+			res.Results[peerKey] = result
+		}
+		lock.Unlock()
+	}
+	wgroup.Wait()
+
+	res.Code, res.Message = aggregateCommandResults(res.Results)
+	if len(res.Results) == 0 {
+		res.Message = "no backends selected"
+	}
+
+	return res, res.Code, nil
+}
+
+// commandLine returns the livestatus command line for this request.
+func (cmdReq *CommandRequest) commandLine() (string, error) {
+	if !reCommandName.MatchString(cmdReq.Command) {
+		return "", fmt.Errorf("bad request: invalid command name: %s", cmdReq.Command)
+	}
+	for _, arg := range cmdReq.Args {
+		if strings.ContainsAny(arg, "\r\n") {
+			return "", fmt.Errorf("bad request: command arguments must not contain newlines")
+		}
+	}
+	fields := append([]string{strings.ToUpper(cmdReq.Command)}, cmdReq.Args...)
+
+	return fmt.Sprintf("COMMAND [%d] %s", time.Now().Unix(), strings.Join(fields, ";")), nil
+}
+
+// splitCommandBackends returns the backends of the request handled by this node and the backends
+// of other cluster nodes grouped by node id.
+func (lmd *Daemon) splitCommandBackends(req *Request, distributed bool) (local []string, remote map[string][]string) {
+	remote = make(map[string][]string)
+	backends := make([]string, 0, len(req.BackendsMap))
+	for peerKey := range req.BackendsMap {
+		backends = append(backends, peerKey)
+	}
+	sort.Strings(backends)
+
+	for _, peerKey := range backends {
+		if distributed || lmd.nodeAccessor == nil || lmd.nodeAccessor.IsOurBackend(peerKey) {
+			local = append(local, peerKey)
+
+			continue
+		}
+		nodeID := ""
+		for id, nodeBackends := range lmd.nodeAccessor.nodeBackends {
+			for _, backend := range nodeBackends {
+				if backend == peerKey {
+					nodeID = id
+				}
+			}
+		}
+		remote[nodeID] = append(remote[nodeID], peerKey)
+	}
+
+	return local, remote
+}
+
+// forwardCommandRequest sends the command to the cluster node owning the given backends.
+func (lmd *Daemon) forwardCommandRequest(ctx context.Context, nodeID string, backends []string, cmdReq *CommandRequest, authUser string, resolve bool) map[string]*CommandPeerResult {
+	failed := func(err error) map[string]*CommandPeerResult {
+		results := make(map[string]*CommandPeerResult, len(backends))
+		for _, peerKey := range backends {
+			results[peerKey] = &CommandPeerResult{Name: lmd.peerName(peerKey), Node: nodeID, Code: ReturnCodeConnectionError, Message: err.Error()}
+		}
+
+		return results
+	}
+
+	node := lmd.nodeAccessor.Node(nodeID)
+	if node == nil {
+		return failed(fmt.Errorf("no cluster node available for this backend"))
+	}
+
+	forward := *cmdReq
+	forward.Backends = backends
+	forward.AuthUser = authUser
+	forward.Resolve = resolve
+	forward.Distributed = true
+	parameters := make(map[string]interface{})
+	raw, err := json.Marshal(&forward)
+	if err == nil {
+		err = json.Unmarshal(raw, &parameters)
+	}
+	if err != nil {
+		return failed(err)
+	}
+
+	done := make(chan interface{}, 1)
+	err = lmd.nodeAccessor.SendQuery(ctx, node, "commands", parameters, func(data interface{}) {
+		done <- data
+	})
+	if err != nil {
+		return failed(err)
+	}
+
+	res := &CommandResponse{}
+	select {
+	case data := <-done:
+		raw, err = json.Marshal(data)
+		if err == nil {
+			err = json.Unmarshal(raw, res)
+		}
+		if err != nil {
+			return failed(err)
+		}
+	case <-ctx.Done():
+		return failed(ctx.Err())
+	}
+	for _, result := range res.Results {
+		result.Node = nodeID
+	}
+
+	return res.Results
+}
+
+// commandWaitRequest returns the livestatus request used to wait for the condition after sending the command.
+// The table and object default to the target of the command.
+func (lmd *Daemon) commandWaitRequest(ctx context.Context, cmd *ExternalCommand, cond *CommandWaitCondition) (*Request, error) {
+	if cond == nil {
+		return nil, nil
+	}
+
+	var table TableName
+	object := cond.Object
+	if cond.Table != "" {
+		var err error
+		table, err = NewTableName(cond.Table)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		switch cmd.Target {
+		case CommandTargetHost:
+			table = TableHosts
+		case CommandTargetService:
+			table = TableServices
+		case CommandTargetHostgroup:
+			table = TableHostgroups
+		case CommandTargetServicegroup:
+			table = TableServicegroups
+		case CommandTargetContact:
+			table = TableContacts
+		case CommandTargetContactgroup:
+			table = TableContactgroups
+		default:
+			return nil, fmt.Errorf("bad request: wait_condition requires a table for command %s", cmd.Name)
+		}
+		if object == "" && len(cmd.Args) > 0 {
+			object = cmd.Args[0]
+			if cmd.Target == CommandTargetService && len(cmd.Args) > 1 {
+				object += ";" + cmd.Args[1]
+			}
+		}
+	}
+	if table == TableServices && object != "" && !strings.Contains(object, ";") {
+		return nil, fmt.Errorf("bad request: wait_condition object for services must be host_name;description")
+	}
+	for _, field := range append([]string{object, cond.Trigger}, cond.Conditions...) {
+		if strings.ContainsAny(field, "\r\n") {
+			return nil, fmt.Errorf("bad request: wait_condition must not contain newlines")
+		}
+	}
+
+	query := strings.Builder{}
+	query.WriteString(fmt.Sprintf("GET %s\n", table.String()))
+	if object != "" {
+		query.WriteString(fmt.Sprintf("WaitObject: %s\n", object))
+	}
+	for _, condition := range cond.Conditions {
+		query.WriteString(fmt.Sprintf("WaitCondition: %s\n", condition))
+	}
+	if cond.Negate {
+		query.WriteString("WaitConditionNegate\n")
+	}
+	if cond.Trigger != "" {
+		query.WriteString(fmt.Sprintf("WaitTrigger: %s\n", cond.Trigger))
+	}
+	if cond.Timeout > 0 {
+		query.WriteString(fmt.Sprintf("WaitTimeout: %d\n", cond.Timeout))
+	}
+	req, _, err := NewRequest(ctx, lmd, bufio.NewReader(strings.NewReader(query.String()+"\n")), lmd.defaultReqestParseOption)
+	if err != nil {
+		return nil, err
+	}
+	if req.WaitTimeout <= 0 {
+		req.WaitTimeout = WaitTimeoutDefault
+	}
+
+	return req, nil
+}
+
+// waitCommandCondition waits on all backends which accepted the command till the wait condition matches
+// and stores whether it did in the results.
+func (lmd *Daemon) waitCommandCondition(ctx context.Context, waitReq *Request, results map[string]*CommandPeerResult) {
+	wgroup := &sync.WaitGroup{}
+	for peerKey, result := range results {
+		if result.Code != ReturnCodeOK {
+			continue
+		}
+		lmd.PeerMapLock.RLock()
+		peer := lmd.PeerMap[peerKey]
+		lmd.PeerMapLock.RUnlock()
+		if peer == nil {
+			continue
+		}
+		wgroup.Add(1)
+		go func(peer *Peer, result *CommandPeerResult) {
+			defer logPanicExitPeer(peer)
+			defer wgroup.Done()
+			peer.WaitCondition(ctx, waitReq)
+			met := peer.WaitConditionMet(waitReq)
+			result.WaitConditionMet = &met
+		}(peer, result)
+	}
+	wgroup.Wait()
+}
+
+// peerName returns the name of the backend or its id if it does not exist.
+func (lmd *Daemon) peerName(peerKey string) string {
+	lmd.PeerMapLock.RLock()
+	defer lmd.PeerMapLock.RUnlock()
+	if peer, ok := lmd.PeerMap[peerKey]; ok {
+		return peer.Name
+	}
+
+	return peerKey
+}
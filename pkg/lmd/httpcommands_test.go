@@ -0,0 +1,100 @@
+package lmd
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPCommandEndpoint(t *testing.T) {
+	peer, cleanup, _, client := StartTestHTTPPeer(t, 2, 10, 10, "")
+	post := func(body string) (int, *CommandResponse) {
+		res := &CommandResponse{}
+		recorder := client.SendJSON(http.MethodPost, "/commands", body, res)
+
+		return recorder.Code, res
+	}
+
+	// targets are resolved to all backends containing the host
+	code, res := post(`{"command":"SCHEDULE_FORCED_HOST_CHECK","args":["testhost_1","0"]}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, ReturnCodeOK, res.Code)
+	assert.Contains(t, res.Command, "] SCHEDULE_FORCED_HOST_CHECK;testhost_1;0")
+	require.Len(t, res.Results, 2)
+	assert.Equal(t, ReturnCodeOK, res.Results["mockid0"].Code)
+	assert.Nil(t, res.Results["mockid0"].WaitConditionMet)
+
+	code, res = post(`{"command":"SCHEDULE_FORCED_HOST_CHECK","args":["testhost_1","0"],"backends":["mockid1"]}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, res.Results, 1)
+	assert.Contains(t, res.Results, "mockid1")
+
+	code, _ = post(`{"command":"SCHEDULE_FORCED_HOST_CHECK","args":["unknown","0"]}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// only cluster nodes may mark commands as distributed
+	code, _ = post(`{"command":"SCHEDULE_FORCED_HOST_CHECK","args":["unknown","0"],"distributed":true}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = post(`{"command":"SCHEDULE_FORCED_HOST_CHECK;testhost_1","args":["0"]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = post(`{"command":"SCHEDULE_FORCED_HOST_CHECK","args":["testhost_1","0"],"backends":["unknown"]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// global commands are sent to all backends
+	code, res = post(`{"command":"DISABLE_NOTIFICATIONS"}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Len(t, res.Results, 2)
+
+	// wait condition
+	code, res = post(`{"command":"SCHEDULE_FORCED_HOST_CHECK","args":["testhost_1","0"],"backends":["mockid0"],"wait_condition":{"conditions":["name = testhost_1"],"timeout":1000}}`)
+	require.Equal(t, http.StatusOK, code)
+	require.NotNil(t, res.Results["mockid0"].WaitConditionMet)
+	assert.True(t, *res.Results["mockid0"].WaitConditionMet)
+
+	code, _ = post(`{"command":"DISABLE_NOTIFICATIONS","wait_condition":{"conditions":["name = x"]}}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// users may only send commands for objects they can see
+	visible, _, err := peer.QueryString("GET hosts\nColumns: name\nAuthUser: authuser\n\n")
+	require.NoError(t, err)
+	assert.NotContains(t, visible, []interface{}{"testhost_1"})
+	assert.Contains(t, visible, []interface{}{"testhost_2"})
+
+	code, _ = post(`{"command":"SCHEDULE_FORCED_HOST_CHECK","args":["testhost_1","0"],"authuser":"authuser"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, _ = post(`{"command":"SCHEDULE_FORCED_HOST_CHECK","args":["testhost_2","0"],"authuser":"authuser"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	err = cleanup()
+	require.NoError(t, err)
+}
+
+func TestHTTPCommandDistributed(t *testing.T) {
+	_, cleanup, mocklmd, client := StartTestHTTPPeer(t, 2, 10, 10, "")
+
+	// the NodeToken does not need to be an api token
+	mocklmd.Config.NodeToken = "node-secret"
+	mocklmd.Config.APITokens = []APIToken{
+		{Name: "client", Token: "client-secret"},
+	}
+
+	send := func(token, body string) int {
+		return client.Send(http.MethodPost, "/query", body, "Content-Type: application/json", "Authorization: Bearer "+token).Code
+	}
+
+	// ordinary clients cannot mark commands as distributed
+	distributed := `{"_name":"commands","command":"SCHEDULE_FORCED_HOST_CHECK","args":["testhost_1","0"],"backends":["mockid0"],"distributed":true}`
+	assert.Equal(t, http.StatusForbidden, send("client-secret", distributed))
+	assert.Equal(t, http.StatusOK, send("node-secret", distributed))
+
+	// without distributed flag, the command is a regular request
+	assert.Equal(t, http.StatusOK, send("client-secret", `{"_name":"commands","command":"SCHEDULE_FORCED_HOST_CHECK","args":["testhost_1","0"]}`))
+
+	err := cleanup()
+	require.NoError(t, err)
+}
@@ -0,0 +1,167 @@
+package lmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// httpLivestatusConn lets a ClientConnection read requests from the http request body and write the answers to the http response.
+type httpLivestatusConn struct {
+	body       io.Reader
+	wrt        http.ResponseWriter
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	written    bool
+}
+
+// httpAddr is the address of a http client.
+type httpAddr string
+
+// Network returns the network name of the address.
+func (a httpAddr) Network() string {
+	return "tcp"
+}
+
+// String returns the address as host:port.
+func (a httpAddr) String() string {
+	return string(a)
+}
+
+// Read reads from the request body.
+func (c *httpLivestatusConn) Read(b []byte) (int, error) {
+	return c.body.Read(b)
+}
+
+// Write writes to the http response.
+func (c *httpLivestatusConn) Write(b []byte) (int, error) {
+	c.written = true
+
+	return c.wrt.Write(b)
+}
+
+// Close does nothing, the http server closes the connection.
+func (c *httpLivestatusConn) Close() error {
+	return nil
+}
+
+// LocalAddr returns the address of the http listener.
+func (c *httpLivestatusConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+// RemoteAddr returns the address of the http client.
+func (c *httpLivestatusConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// SetDeadline does nothing, timeouts are handled by the http server.
+func (c *httpLivestatusConn) SetDeadline(time.Time) error {
+	return nil
+}
+
+// SetReadDeadline does nothing, timeouts are handled by the http server.
+func (c *httpLivestatusConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline does nothing, timeouts are handled by the http server.
+func (c *httpLivestatusConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// livestatus answers raw livestatus requests from the request body like the livestatus listeners.
+// The body may contain multiple requests separated by empty lines, they are answered in order without KeepAlive.
+func (c *HTTPServerController) livestatus(wrt http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	defer request.Body.Close()
+	ctx := context.WithValue(request.Context(), CtxClient, request.RemoteAddr)
+
+	listen, _ := ctx.Value(CtxListener).(string)
+	localAddr, ok := ctx.Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		localAddr = httpAddr(listen)
+	}
+	conn := &httpLivestatusConn{
+		body:       request.Body,
+		wrt:        wrt,
+		localAddr:  localAddr,
+		remoteAddr: httpAddr(request.RemoteAddr),
+	}
+	cl := NewClientConnection(c.lmd, conn, listen, c.lmd.Config.ListenTimeout, c.lmd.Config.LogSlowQueryThreshold, c.lmd.Config.LogHugeQueryThreshold, nil)
+
+	wrt.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	promFrontendConnections.WithLabelValues(cl.localAddr).Inc()
+	logWith(ctx).Debugf("new http livestatus request")
+
+	err := cl.answerHTTP(ctx, conn)
+	if err != nil {
+		logWith(ctx).Debugf("http livestatus request failed: %s", err.Error())
+	}
+}
+
+// answerHTTP reads and answers all requests from the http body.
+// Commands are collected until the next query, just like multiple commands sent on a single connection.
+func (cl *ClientConnection) answerHTTP(ctx context.Context, conn *httpLivestatusConn) error {
+	buf := bufio.NewReader(conn)
+	reqs := []*Request{}
+	numRequests := 0
+	sendError := func(err error) error {
+		if !conn.written {
+			conn.wrt.WriteHeader(http.StatusBadRequest)
+		}
+		LogErrors((&Response{Code: ReturnCodeBadRequest, Request: &Request{}, Error: err}).Send(cl))
+
+		return err
+	}
+	for {
+		req, size, err := NewRequest(ctx, cl.lmd, buf, cl.lmd.defaultReqestParseOption)
+		promFrontendBytesReceived.WithLabelValues(cl.localAddr).Add(float64(size))
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return sendError(err)
+		}
+		if req == nil {
+			// skip empty lines between requests
+			continue
+		}
+		err = req.ExpandRequestedBackends()
+		if err != nil {
+			return sendError(err)
+		}
+		numRequests++
+		reqs = append(reqs, req)
+		if req.Command != "" {
+			continue
+		}
+
+		promFrontendQueries.WithLabelValues(cl.localAddr).Add(float64(len(reqs)))
+		err = cl.processRequests(ctx, reqs)
+		if err != nil {
+			return err
+		}
+		if flusher, ok := conn.wrt.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		reqs = []*Request{}
+	}
+
+	if numRequests == 0 {
+		return sendError(errors.New("bad request: empty request"))
+	}
+	if len(reqs) > 0 {
+		promFrontendQueries.WithLabelValues(cl.localAddr).Add(float64(len(reqs)))
+
+		return cl.processRequests(ctx, reqs)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package lmd
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPLivestatus(t *testing.T) {
+	_, cleanup, _, client := StartTestHTTPPeer(t, 2, 10, 10, "")
+	post := func(body string) (int, string) {
+		recorder := client.Send(http.MethodPost, "/livestatus", body, "Content-Type: text/plain")
+
+		return recorder.Code, recorder.Body.String()
+	}
+
+	// single request, same answer as the livestatus listener
+	query := "GET hosts\nColumns: name\nFilter: name = testhost_1\nOutputFormat: json\n\n"
+	code, body := post(query)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "[[\"testhost_1\"],\n[\"testhost_1\"]]\n", body)
+
+	// multiple requests and commands in one body without KeepAlive
+	code, body = post("COMMAND [0] SCHEDULE_FORCED_HOST_CHECK;testhost_1;0\n\n" +
+		"GET hosts\nColumns: name\nFilter: name = testhost_2\nBackends: mockid0\nResponseHeader: fixed16\n\n" +
+		"\n" +
+		"GET services\nStats: state = 0\nAuthUser: authuser\nFilter: host_name = testhost_1\nResponseHeader: fixed16\n\n" +
+		"COMMAND [0] DISABLE_NOTIFICATIONS\n")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "200          17\n[[\"testhost_2\"]]\n200           6\n[[0]]\n", body)
+
+	// headers which are not available in json requests
+	code, body = post("GET hosts\nFilter: name = testhost_1\nFilter: name = testhost_2\nOr: 2\nNegate:\nStats: state = 0\nStats: name ~ ^testhost\nStatsAnd: 2\n\n")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "[[14]]\n", body)
+
+	// errors
+	code, body = post("")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, body, "empty request")
+
+	code, body = post("GET unknown\n\n")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, body, "bad request")
+
+	code, body = post("GET hosts\nColumns: name\nFilter: name = testhost_1\nBackends: mockid0\nResponseHeader: fixed16\n\nGET unknown\nResponseHeader: fixed16\n\n")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "200          17\n[[\"testhost_1\"]]\nbad request: table unknown does not exist\n", body)
+
+	err := cleanup()
+	require.NoError(t, err)
+}
@@ -0,0 +1,407 @@
+package lmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// restReservedParams contains query parameters with special meaning, all other parameters are used as filter.
+var restReservedParams = map[string]bool{
+	"columns":  true,
+	"sort":     true,
+	"limit":    true,
+	"offset":   true,
+	"backends": true,
+	"authuser": true,
+}
+
+// restFilterOperators maps the operators of filter parameters like "state[gte]=1" to livestatus operators.
+// The contains operator matches substrings of string columns and elements of list columns.
+var restFilterOperators = map[string]string{
+	"eq":       "=",
+	"ne":       "!=",
+	"lt":       "<",
+	"lte":      "<=",
+	"gt":       ">",
+	"gte":      ">=",
+	"re":       "~",
+	"ire":      "~~",
+	"contains": "like", // list columns use ">=" instead
+}
+
+// restMemberTables maps group tables to the table of their members.
+var restMemberTables = map[TableName]TableName{
+	TableHostgroups:    TableHosts,
+	TableServicegroups: TableServices,
+}
+
+// restResult contains the decoded wrapped json result of a table query.
+type restResult struct {
+	Failed     map[string]string   `json:"failed"`
+	Columns    []string            `json:"columns"`
+	Data       [][]json.RawMessage `json:"data"`
+	TotalCount int                 `json:"total_count"`
+}
+
+// registerRESTRoutes adds the object and collection endpoints for all tables:
+//
+//	GET /<table>                          list of objects, query parameters are used as filter
+//	GET /<table>/<name>                   single object by its primary key
+//	GET /services/<host>/<description>    single service
+//	GET /hostgroups/<name>/members        members of a host or service group
+//
+// Keys containing slashes must be escaped as %2F.
+func registerRESTRoutes(router *httprouter.Router, controller *HTTPServerController) {
+	for name, table := range Objects.Tables {
+		router.GET("/"+name.String(), controller.restCollection(name))
+		if len(table.PrimaryKey) > 0 {
+			router.GET("/"+name.String()+"/*keys", controller.restPath(name))
+		}
+	}
+}
+
+// restPath returns the handler for single objects and group members. The path is split on the
+// escaped path, since httprouter path parameters cannot contain escaped slashes.
+func (c *HTTPServerController) restPath(table TableName) httprouter.Handle {
+	numKeys := len(Objects.Tables[table].PrimaryKey)
+	_, hasMembers := restMemberTables[table]
+
+	return func(wrt http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+		keys, err := restPathKeys(table, request.URL)
+		if err != nil {
+			c.errorOutput(err, wrt)
+
+			return
+		}
+		switch {
+		case len(keys) == numKeys:
+			c.restObject(wrt, request, table, keys)
+		case hasMembers && len(keys) == numKeys+1 && keys[numKeys] == "members":
+			c.restMembers(wrt, request, table, keys[:numKeys])
+		default:
+			httpErrorOutput(fmt.Errorf("not found: %s", request.URL.Path), wrt, http.StatusNotFound)
+		}
+	}
+}
+
+// restPathKeys returns the unescaped path segments following the table name.
+func restPathKeys(table TableName, requestURL *url.URL) (keys []string, err error) {
+	path := strings.TrimPrefix(requestURL.EscapedPath(), "/"+table.String()+"/")
+	for _, segment := range strings.Split(path, "/") {
+		key, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, fmt.Errorf("bad request: %s", err.Error())
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// restCollection returns the handler for the list of objects of a table.
+func (c *HTTPServerController) restCollection(table TableName) httprouter.Handle {
+	return func(wrt http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+		requestData, err := restRequestData(table, request.URL.Query())
+		if err != nil {
+			c.errorOutput(err, wrt)
+
+			return
+		}
+		c.restQueryCollection(request.Context(), wrt, request, requestData)
+	}
+}
+
+// restObject sends a single object identified by its primary key.
+func (c *HTTPServerController) restObject(wrt http.ResponseWriter, request *http.Request, table TableName, keys []string) {
+	requestData, err := restRequestData(table, request.URL.Query())
+	if err != nil {
+		c.errorOutput(err, wrt)
+
+		return
+	}
+	err = restPrimaryKeyFilter(table, keys, requestData)
+	if err != nil {
+		c.errorOutput(err, wrt)
+
+		return
+	}
+	result, etag, status, err := c.restQuery(request.Context(), requestData, request.Header.Get("If-None-Match"))
+	if err != nil {
+		httpErrorOutput(err, wrt, status)
+
+		return
+	}
+	if httpNotModified(wrt, etag, status) {
+		return
+	}
+	if len(result.Data) == 0 {
+		httpErrorOutput(fmt.Errorf("not found: %s %s", table.String(), strings.Join(keys, ";")), wrt, http.StatusNotFound)
+
+		return
+	}
+	wrt.Header().Set("Content-Type", "application/json")
+	restWriteJSON(wrt, result.object(0))
+}
+
+// restMembers sends the members of a group.
+func (c *HTTPServerController) restMembers(wrt http.ResponseWriter, request *http.Request, table TableName, keys []string) {
+	// make sure the group exists and is visible
+	groupData := map[string]interface{}{"columns": []interface{}{"name"}}
+	if authUser := request.URL.Query().Get("authuser"); authUser != "" {
+		groupData["authuser"] = authUser
+	}
+	groupData["table"] = table.String()
+	err := restPrimaryKeyFilter(table, keys, groupData)
+	if err != nil {
+		c.errorOutput(err, wrt)
+
+		return
+	}
+	group, _, status, err := c.restQuery(request.Context(), groupData, "")
+	if err != nil {
+		httpErrorOutput(err, wrt, status)
+
+		return
+	}
+	if len(group.Data) == 0 {
+		httpErrorOutput(fmt.Errorf("not found: %s %s", table.String(), strings.Join(keys, ";")), wrt, http.StatusNotFound)
+
+		return
+	}
+
+	requestData, err := restRequestData(restMemberTables[table], request.URL.Query())
+	if err != nil {
+		c.errorOutput(err, wrt)
+
+		return
+	}
+	filter, _ := requestData["filter"].(string)
+	requestData["filter"] = filter + fmt.Sprintf("Filter: groups >= %s\n", keys[0])
+	c.restQueryCollection(request.Context(), wrt, request, requestData)
+}
+
+// restQueryCollection runs the request and sends the list of objects along with pagination links.
+func (c *HTTPServerController) restQueryCollection(ctx context.Context, wrt http.ResponseWriter, request *http.Request, requestData map[string]interface{}) {
+	result, etag, status, err := c.restQuery(ctx, requestData, request.Header.Get("If-None-Match"))
+	if err != nil {
+		httpErrorOutput(err, wrt, status)
+
+		return
+	}
+	if httpNotModified(wrt, etag, status) {
+		return
+	}
+
+	objects := make([]map[string]json.RawMessage, 0, len(result.Data))
+	for i := range result.Data {
+		objects = append(objects, result.object(i))
+	}
+
+	wrt.Header().Set("Content-Type", "application/json")
+	wrt.Header().Set("X-Total-Count", strconv.Itoa(result.TotalCount))
+	if links := restPaginationLinks(request.URL, requestData, result.TotalCount); len(links) > 0 {
+		wrt.Header().Set("Link", strings.Join(links, ", "))
+	}
+	restWriteJSON(wrt, objects)
+}
+
+// restQuery runs the table request and returns the decoded result along with its entity tag.
+// The result is nil if the entity tag matches ifNoneMatch and http.StatusNotModified is returned.
+func (c *HTTPServerController) restQuery(ctx context.Context, requestData map[string]interface{}, ifNoneMatch string) (*restResult, string, int, error) {
+	requestData["outputformat"] = "wrapped_json"
+	requestData["sendcolumnsheader"] = true
+	buf, etag, status, err := c.executeTableQuery(ctx, requestData, ifNoneMatch)
+	if err != nil || status == http.StatusNotModified {
+		return nil, etag, status, err
+	}
+
+	result := &restResult{}
+	if err := json.Unmarshal(buf.Bytes(), result); err != nil {
+		return nil, "", http.StatusInternalServerError, fmt.Errorf("failed to decode result: %s", err.Error())
+	}
+
+	return result, etag, http.StatusOK, nil
+}
+
+// object returns the row with given index as map of column names.
+func (res *restResult) object(index int) map[string]json.RawMessage {
+	row := res.Data[index]
+	obj := make(map[string]json.RawMessage, len(row))
+	for i, col := range res.Columns {
+		if i < len(row) {
+			obj[col] = row[i]
+		}
+	}
+
+	return obj
+}
+
+// restRequestData converts the query parameters into request data as used by parseRequestDataToRequest.
+func restRequestData(table TableName, query url.Values) (requestData map[string]interface{}, err error) {
+	requestData = map[string]interface{}{
+		"table": table.String(),
+	}
+	for name, values := range query {
+		if strings.ContainsAny(name, "\r\n") || slices.ContainsFunc(values, func(value string) bool { return strings.ContainsAny(value, "\r\n") }) {
+			return nil, fmt.Errorf("bad request: parameters must not contain newlines")
+		}
+	}
+
+	if columns := restListParam(query, "columns"); len(columns) > 0 {
+		requestData["columns"] = columns
+	}
+	if backends := restListParam(query, "backends"); len(backends) > 0 {
+		requestData["backends"] = backends
+	}
+	if authUser := query.Get("authuser"); authUser != "" {
+		requestData["authuser"] = authUser
+	}
+	sortLines := []interface{}{}
+	for _, field := range restListParam(query, "sort") {
+		name := interface2stringNoDedup(field)
+		if after, ok := strings.CutPrefix(name, "-"); ok {
+			sortLines = append(sortLines, after+" desc")
+		} else {
+			sortLines = append(sortLines, strings.TrimPrefix(name, "+")+" asc")
+		}
+	}
+	if len(sortLines) > 0 {
+		requestData["sort"] = sortLines
+	}
+	for _, name := range []string{"limit", "offset"} {
+		if value := query.Get(name); value != "" {
+			num, err := strconv.Atoi(value)
+			if err != nil || num < 0 {
+				return nil, fmt.Errorf("bad request: %s must be a positive number", name)
+			}
+			requestData[name] = num
+		}
+	}
+
+	// remaining parameters are filters, multiple values of the same parameter are combined with or
+	names := make([]string, 0, len(query))
+	for name := range query {
+		if !restReservedParams[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	filter := strings.Builder{}
+	for _, name := range names {
+		column := name
+		opName := "eq"
+		operator := "="
+		if before, after, ok := strings.Cut(name, "["); ok {
+			opName = strings.TrimSuffix(after, "]")
+			op, found := restFilterOperators[opName]
+			if !found || !strings.HasSuffix(after, "]") {
+				return nil, fmt.Errorf("bad request: unknown filter operator in %s", name)
+			}
+			column = before
+			operator = op
+		}
+		// livestatus silently ignores unknown columns, which would turn a typo into an empty filter
+		col := Objects.Tables[table].GetColumnWithFallback(column)
+		if col.Name == "empty" {
+			return nil, fmt.Errorf("bad request: unknown column %s in table %s", column, table.String())
+		}
+		if opName == "contains" {
+			switch col.DataType {
+			case StringListCol, Int64ListCol, ServiceMemberListCol, InterfaceListCol:
+				operator = ">="
+			default:
+			}
+		}
+		values := query[name]
+		for _, value := range values {
+			filter.WriteString(fmt.Sprintf("Filter: %s %s %s\n", column, operator, value))
+		}
+		if len(values) > 1 {
+			filter.WriteString(fmt.Sprintf("Or: %d\n", len(values)))
+		}
+	}
+	if filter.Len() > 0 {
+		requestData["filter"] = filter.String()
+	}
+
+	return requestData, nil
+}
+
+// restListParam returns the comma separated values of all parameters with given name.
+func restListParam(query url.Values, name string) (list []interface{}) {
+	for _, value := range query[name] {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+
+	return list
+}
+
+// restPrimaryKeyFilter adds filters for the primary key values from the url path.
+func restPrimaryKeyFilter(table TableName, keys []string, requestData map[string]interface{}) error {
+	filter, _ := requestData["filter"].(string)
+	for i, column := range Objects.Tables[table].PrimaryKey {
+		value := keys[i]
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("bad request: %s must not contain newlines", column)
+		}
+		filter += fmt.Sprintf("Filter: %s = %s\n", column, value)
+	}
+	requestData["filter"] = filter
+	requestData["limit"] = 1
+
+	return nil
+}
+
+// restPaginationLinks returns the links to the first, previous, next and last page if a limit is set.
+func restPaginationLinks(requestURL *url.URL, requestData map[string]interface{}, total int) (links []string) {
+	limit, ok := requestData["limit"].(int)
+	if !ok || limit <= 0 {
+		return nil
+	}
+	offset, _ := requestData["offset"].(int)
+
+	link := func(rel string, offset int) string {
+		linkURL := *requestURL
+		query := linkURL.Query()
+		query.Set("offset", strconv.Itoa(offset))
+		linkURL.RawQuery = query.Encode()
+
+		return fmt.Sprintf("<%s>; rel=%q", linkURL.RequestURI(), rel)
+	}
+
+	lastOffset := 0
+	if total > 0 {
+		lastOffset = ((total - 1) / limit) * limit
+	}
+	links = append(links, link("first", 0))
+	if offset > 0 {
+		links = append(links, link("prev", max(offset-limit, 0)))
+	}
+	if offset+limit < total {
+		links = append(links, link("next", offset+limit))
+	}
+	links = append(links, link("last", lastOffset))
+
+	return links
+}
+
+// restWriteJSON sends the data as json.
+func restWriteJSON(wrt http.ResponseWriter, data interface{}) {
+	if err := json.NewEncoder(wrt).Encode(data); err != nil {
+		log.Debugf("encoder failed: %e", err)
+	}
+}
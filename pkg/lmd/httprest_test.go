@@ -0,0 +1,145 @@
+package lmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRESTRequestData(t *testing.T) {
+	query, err := url.ParseQuery("state=2&state=3&columns=name,state&sort=-last_check,name&limit=10&offset=20&plugin_output[re]=^OK")
+	require.NoError(t, err)
+	requestData, err := restRequestData(TableHosts, query)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"name", "state"}, requestData["columns"])
+	assert.Equal(t, []interface{}{"last_check desc", "name asc"}, requestData["sort"])
+	assert.Equal(t, 10, requestData["limit"])
+	assert.Equal(t, 20, requestData["offset"])
+	assert.Equal(t, "Filter: plugin_output ~ ^OK\nFilter: state = 2\nFilter: state = 3\nOr: 2\n", requestData["filter"])
+
+	req, err := parseRequestDataToRequest(requestData)
+	require.NoError(t, err)
+	assert.Len(t, req.Filter, 2)
+	assert.Len(t, req.Sort, 2)
+
+	// contains matches substrings of strings and elements of lists
+	query, err = url.ParseQuery("plugin_output[contains]=OK&groups[contains]=linux")
+	require.NoError(t, err)
+	containsData, err := restRequestData(TableHosts, query)
+	require.NoError(t, err)
+	assert.Equal(t, "Filter: groups >= linux\nFilter: plugin_output like OK\n", containsData["filter"])
+	req, err = parseRequestDataToRequest(containsData)
+	require.NoError(t, err)
+	require.Len(t, req.Filter, 2)
+	assert.Equal(t, Contains, req.Filter[1].Operator)
+
+	for _, invalid := range []string{"limit=-1", "state[unknown]=1", "unknown_column=1", "state=1%0AAuthUser:%20admin"} {
+		query, err = url.ParseQuery(invalid)
+		require.NoError(t, err)
+		_, err = restRequestData(TableHosts, query)
+		require.Errorf(t, err, "query: %s", invalid)
+	}
+
+	links := restPaginationLinks(&url.URL{Path: "/hosts", RawQuery: "limit=10&offset=20"}, requestData, 45)
+	assert.Equal(t, []string{
+		`</hosts?limit=10&offset=0>; rel="first"`,
+		`</hosts?limit=10&offset=10>; rel="prev"`,
+		`</hosts?limit=10&offset=30>; rel="next"`,
+		`</hosts?limit=10&offset=40>; rel="last"`,
+	}, links)
+}
+
+func TestRESTEndpoints(t *testing.T) {
+	peer, cleanup, _, client := StartTestHTTPPeer(t, 1, 10, 10, "")
+	get := func(path string, result interface{}) *httptest.ResponseRecorder {
+		if result == nil {
+			return client.Send(http.MethodGet, path, "")
+		}
+
+		return client.SendJSON(http.MethodGet, path, "", result)
+	}
+
+	// collection with pagination
+	var hosts []map[string]interface{}
+	recorder := get("/hosts?columns=name,state&sort=-name&limit=3", &hosts)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Len(t, hosts, 3)
+	assert.Equal(t, "10", recorder.Header().Get("X-Total-Count"))
+	assert.Contains(t, recorder.Header().Get("Link"), `rel="next"`)
+	assert.Greater(t, hosts[0]["name"], hosts[1]["name"])
+	assert.Len(t, hosts[0], 2)
+
+	// filter
+	res, _, err := peer.QueryString("GET hosts\nStats: state = 0\n\n")
+	require.NoError(t, err)
+	recorder = get("/hosts?state=0&columns=name", nil)
+	assert.Equal(t, fmt.Sprintf("%v", res[0][0]), recorder.Header().Get("X-Total-Count"))
+
+	recorder = get("/hosts?unknown_column=1", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// single objects
+	hostName := interface2stringNoDedup(hosts[0]["name"])
+	var host map[string]interface{}
+	recorder = get("/hosts/"+hostName, &host)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, hostName, host["name"])
+
+	recorder = get("/hosts/unknown", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	var services []map[string]interface{}
+	recorder = get("/services?columns=host_name,description&limit=1", &services)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Len(t, services, 1)
+	var service map[string]interface{}
+	recorder = get(fmt.Sprintf("/services/%s/%s", services[0]["host_name"], url.PathEscape(interface2stringNoDedup(services[0]["description"]))), &service)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, services[0]["description"], service["description"])
+
+	recorder = get(fmt.Sprintf("/services/%s/unknown", services[0]["host_name"]), nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// group members
+	var groups []map[string]interface{}
+	recorder = get("/hostgroups?columns=name,members&limit=1", &groups)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Len(t, groups, 1)
+	var members []map[string]interface{}
+	recorder = get(fmt.Sprintf("/hostgroups/%s/members?columns=name", groups[0]["name"]), &members)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Len(t, members, len(groups[0]["members"].([]interface{})))
+
+	recorder = get("/hostgroups/unknown/members", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// escaped slashes are part of the key
+	recorder = get("/hosts/unknown%2Fhost", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "not found: hosts unknown/host")
+
+	recorder = get("/hosts/"+hostName+"/unknown", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	err = cleanup()
+	require.NoError(t, err)
+}
+
+func TestRESTPathKeys(t *testing.T) {
+	requestURL, err := url.Parse("/services/host%2Fa/disk%20%2Fvar")
+	require.NoError(t, err)
+	keys, err := restPathKeys(TableServices, requestURL)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"host/a", "disk /var"}, keys)
+
+	requestURL, err = url.Parse("/hostgroups/group%2F1/members")
+	require.NoError(t, err)
+	keys, err = restPathKeys(TableHostgroups, requestURL)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"group/1", "members"}, keys)
+}
@@ -0,0 +1,180 @@
+package lmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+// available limit scopes.
+const (
+	LimitScopeClient   = "client"
+	LimitScopeUser     = "user"
+	LimitScopeListener = "listener"
+)
+
+// limitCleanupInterval sets the interval to remove idle limit buckets.
+const limitCleanupInterval = time.Minute
+
+// LimitError is returned if a request exceeds a rate or concurrency limit.
+type LimitError struct {
+	scope string
+	key   string
+	kind  string
+}
+
+// Error returns the error message as string.
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("too many requests: %s limit exceeded for %s %s", e.kind, e.scope, e.key)
+}
+
+// RequestLimiter keeps track of the request rate and the running queries of all clients, users and listeners.
+type RequestLimiter struct {
+	lock        *deadlock.Mutex
+	buckets     map[string]*limitBucket
+	lastCleanup time.Time
+}
+
+// limitBucket is a token bucket combined with a counter of running queries.
+type limitBucket struct {
+	last   time.Time
+	tokens float64
+	rate   float64
+	burst  float64
+	active int
+}
+
+// limitCheck contains a single limit to check.
+type limitCheck struct {
+	limit *RequestLimit
+	scope string
+	key   string
+}
+
+// NewRequestLimiter creates a new limiter.
+func NewRequestLimiter() *RequestLimiter {
+	return &RequestLimiter{
+		lock:        new(deadlock.Mutex),
+		buckets:     make(map[string]*limitBucket),
+		lastCleanup: time.Now(),
+	}
+}
+
+// Admit checks all limits at once and reserves a slot in each of them.
+// The returned release function must be called once the request has finished.
+func (rl *RequestLimiter) Admit(checks []limitCheck) (release func(), err error) {
+	now := time.Now()
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	rl.cleanup(now)
+
+	buckets := make([]*limitBucket, 0, len(checks))
+	for _, check := range checks {
+		limit := check.limit
+		if check.key == "" || limit == nil || (limit.Rate <= 0 && limit.Concurrent <= 0) {
+			continue
+		}
+		id := check.scope + ":" + check.key
+		bucket := rl.buckets[id]
+		if bucket == nil {
+			bucket = &limitBucket{last: now, tokens: limit.burst()}
+			rl.buckets[id] = bucket
+		}
+		bucket.refill(now, limit.Rate, limit.burst())
+		if limit.Rate > 0 && bucket.tokens < 1 {
+			return nil, &LimitError{scope: check.scope, key: check.key, kind: "rate"}
+		}
+		if limit.Concurrent > 0 && bucket.active >= limit.Concurrent {
+			return nil, &LimitError{scope: check.scope, key: check.key, kind: "concurrency"}
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	for _, bucket := range buckets {
+		if bucket.rate > 0 {
+			bucket.tokens--
+		}
+		bucket.active++
+	}
+
+	return func() {
+		rl.lock.Lock()
+		defer rl.lock.Unlock()
+		for _, bucket := range buckets {
+			bucket.active--
+		}
+	}, nil
+}
+
+// cleanup removes buckets without running queries which are refilled completely.
+func (rl *RequestLimiter) cleanup(now time.Time) {
+	if now.Sub(rl.lastCleanup) < limitCleanupInterval {
+		return
+	}
+	rl.lastCleanup = now
+	for id, bucket := range rl.buckets {
+		if bucket.active > 0 {
+			continue
+		}
+		bucket.refill(now, bucket.rate, bucket.burst)
+		if bucket.rate <= 0 || bucket.tokens >= bucket.burst {
+			delete(rl.buckets, id)
+		}
+	}
+}
+
+// refill adds the tokens for the time passed since the last refill.
+func (b *limitBucket) refill(now time.Time, rate, burst float64) {
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	b.rate = rate
+	b.burst = burst
+}
+
+// burst returns the number of requests allowed at once, it defaults to the rate.
+func (limit *RequestLimit) burst() float64 {
+	if limit.Burst > 0 {
+		return float64(limit.Burst)
+	}
+	if limit.Rate < 1 {
+		return 1
+	}
+
+	return limit.Rate
+}
+
+// admitRequest checks the request against the limits of the remote address, the AuthUser and the listener.
+// Clients connected by unix socket are limited by user and listener only.
+func (lmd *Daemon) admitRequest(remoteAddr, authUser, listen string) (release func(), err error) {
+	release, err = lmd.requestLimiter.Admit([]limitCheck{
+		{limit: &lmd.Config.LimitClient, scope: LimitScopeClient, key: remoteHost(remoteAddr)},
+		{limit: &lmd.Config.LimitUser, scope: LimitScopeUser, key: authUser},
+		{limit: &lmd.Config.LimitListener, scope: LimitScopeListener, key: listen},
+	})
+	if err != nil {
+		var limitErr *LimitError
+		if errors.As(err, &limitErr) {
+			promFrontendRejectedRequests.WithLabelValues(listen, limitErr.scope).Inc()
+		}
+
+		return nil, err
+	}
+
+	return release, nil
+}
+
+// remoteHost returns the host part of a remote tcp address or an empty string for other addresses.
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return ""
+	}
+
+	return host
+}
@@ -0,0 +1,127 @@
+package lmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLimiter(t *testing.T) {
+	limiter := NewRequestLimiter()
+	rateLimit := &RequestLimit{Rate: 0.001, Burst: 2}
+	concurrentLimit := &RequestLimit{Concurrent: 1}
+
+	// rate limit allows bursts
+	for range 2 {
+		release, err := limiter.Admit([]limitCheck{{limit: rateLimit, scope: LimitScopeClient, key: "127.0.0.1"}})
+		require.NoError(t, err)
+		release()
+	}
+	_, err := limiter.Admit([]limitCheck{{limit: rateLimit, scope: LimitScopeClient, key: "127.0.0.1"}})
+	require.ErrorContains(t, err, "rate limit exceeded for client 127.0.0.1")
+
+	// other clients have their own limit
+	release, err := limiter.Admit([]limitCheck{{limit: rateLimit, scope: LimitScopeClient, key: "127.0.0.2"}})
+	require.NoError(t, err)
+	release()
+
+	// concurrency limit
+	release, err = limiter.Admit([]limitCheck{{limit: concurrentLimit, scope: LimitScopeUser, key: "user"}})
+	require.NoError(t, err)
+	_, err = limiter.Admit([]limitCheck{{limit: concurrentLimit, scope: LimitScopeUser, key: "user"}})
+	require.ErrorContains(t, err, "concurrency limit exceeded for user user")
+	release()
+	release, err = limiter.Admit([]limitCheck{{limit: concurrentLimit, scope: LimitScopeUser, key: "user"}})
+	require.NoError(t, err)
+	release()
+
+	// rejected requests do not reserve any slot
+	_, err = limiter.Admit([]limitCheck{
+		{limit: concurrentLimit, scope: LimitScopeUser, key: "other"},
+		{limit: rateLimit, scope: LimitScopeClient, key: "127.0.0.1"},
+	})
+	require.Error(t, err)
+	release, err = limiter.Admit([]limitCheck{{limit: concurrentLimit, scope: LimitScopeUser, key: "other"}})
+	require.NoError(t, err)
+	release()
+
+	assert.Equal(t, "127.0.0.1", remoteHost("127.0.0.1:12345"))
+	assert.Empty(t, remoteHost("@"))
+}
+
+func TestRequestLimits(t *testing.T) {
+	peer, cleanup, mocklmd := StartTestPeer(1, 2, 2)
+	PauseTestPeers(peer)
+
+	mocklmd.Config.LimitUser = RequestLimit{Rate: 0.001, Burst: 1}
+
+	_, _, err := peer.QueryString("GET hosts\nColumns: name\nAuthUser: authuser\n\n")
+	require.NoError(t, err)
+	_, _, err = peer.QueryString("GET hosts\nColumns: name\nAuthUser: authuser\n\n")
+	require.ErrorContains(t, err, "too many requests")
+
+	// requests without AuthUser are not limited per user
+	_, _, err = peer.QueryString("GET hosts\nColumns: name\n\n")
+	require.NoError(t, err)
+
+	// rejected requests do not close keepalive connections
+	conn, err := net.DialTimeout("unix", "test.sock", 10*time.Second)
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	readStatus := func(query string) int {
+		_, err = fmt.Fprintf(conn, "%sKeepAlive: on\nResponseHeader: fixed16\n\n", query)
+		require.NoError(t, err)
+		header := make([]byte, 16)
+		_, err = io.ReadFull(reader, header)
+		require.NoError(t, err)
+		var code, size int
+		_, err = fmt.Sscanf(string(header), "%d %d", &code, &size)
+		require.NoError(t, err)
+		_, err = io.ReadFull(reader, make([]byte, size))
+		require.NoError(t, err)
+
+		return code
+	}
+	assert.Equal(t, ReturnCodeTooManyRequests, readStatus("GET hosts\nColumns: name\nAuthUser: authuser\n"))
+	assert.Equal(t, ReturnCodeOK, readStatus("GET hosts\nColumns: name\n"))
+	conn.Close()
+
+	// commands are limited as well
+	mocklmd.Config.LimitListener = RequestLimit{Rate: 0.001, Burst: 1}
+	_, _, err = peer.QueryString("COMMAND [0] test_ok\n\n")
+	require.NoError(t, err)
+	_, _, err = peer.QueryString("COMMAND [0] test_ok\n\n")
+	require.ErrorContains(t, err, "too many requests")
+
+	// queued commands hold their slots until sent, further commands wait for them
+	mocklmd.Config.LimitListener = RequestLimit{Concurrent: 1}
+	conn, err = net.DialTimeout("unix", "test.sock", 10*time.Second)
+	require.NoError(t, err)
+	_, err = fmt.Fprintf(conn, "COMMAND [0] test_ok\n\nCOMMAND [0] test_ok\n\n")
+	require.NoError(t, err)
+	require.NoError(t, conn.(*net.UnixConn).CloseWrite())
+	res, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Empty(t, string(res))
+	conn.Close()
+	mocklmd.Config.LimitListener = RequestLimit{}
+
+	// http api
+	client := NewTestHTTPClient(t, mocklmd)
+	query := func() int {
+		return client.Send(http.MethodPost, "/table/hosts", `{"columns":["name"],"authuser":"httpuser"}`).Code
+	}
+	assert.Equal(t, http.StatusOK, query())
+	assert.Equal(t, http.StatusTooManyRequests, query())
+
+	mocklmd.Config.LimitUser = RequestLimit{}
+	err = cleanup()
+	require.NoError(t, err)
+}
@@ -1,6 +1,7 @@
 package lmd
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
@@ -29,6 +30,13 @@ const (
 	PeerCommandTimeout = 9500 * time.Millisecond
 )
 
+// available sources for the AuthUser of tls client certificates.
+const (
+	TLSClientAuthUserCN    = "cn"
+	TLSClientAuthUserEmail = "email"
+	TLSClientAuthUserDNS   = "dns"
+)
+
 // Listener is the object which handles incoming connections.
 type Listener struct {
 	noCopy           noCopy
@@ -154,7 +162,7 @@ func (l *Listener) localListenerLivestatus(connType ConnectionType, listen strin
 
 		l.Lock.Lock()
 		l.openConnections++
-		clConn := NewClientConnection(l.lmd, conn, l.lmd.Config.ListenTimeout, l.lmd.Config.LogSlowQueryThreshold, l.lmd.Config.LogHugeQueryThreshold, l.queryStats)
+		clConn := NewClientConnection(l.lmd, conn, l.connectionString, l.lmd.Config.ListenTimeout, l.lmd.Config.LogSlowQueryThreshold, l.lmd.Config.LogHugeQueryThreshold, l.queryStats)
 		promFrontendOpenConnections.WithLabelValues(l.connectionString).Set(float64(l.openConnections))
 		l.Lock.Unlock()
 
@@ -213,6 +221,11 @@ func (l *Listener) localListenerHTTP(httpType, listen string) {
 		ReadTimeout:       HTTPServerRequestTimeout,
 		WriteTimeout:      HTTPServerRequestTimeout,
 		ReadHeaderTimeout: HTTPServerRequestTimeout,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			ctx = context.WithValue(ctx, CtxListener, l.connectionString)
+
+			return context.WithValue(ctx, CtxRemoteAddr, conn.RemoteAddr().String())
+		},
 	}
 	if err := server.Serve(l.Connection); err != nil {
 		log.Infof("stopping listener on %s", listen)
@@ -257,3 +270,30 @@ func GetTLSListenerConfig(localConfig *Config) (config *tls.Config, err error) {
 
 	return
 }
+
+// tlsClientAuthUser returns the AuthUser from the verified client certificate of a tls connection.
+func tlsClientAuthUser(state *tls.ConnectionState, source string) (authUser string, err error) {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", fmt.Errorf("bad request: verified client certificate required")
+	}
+	cert := state.VerifiedChains[0][0]
+	switch source {
+	case TLSClientAuthUserCN:
+		authUser = cert.Subject.CommonName
+	case TLSClientAuthUserEmail:
+		if len(cert.EmailAddresses) > 0 {
+			authUser = cert.EmailAddresses[0]
+		}
+	case TLSClientAuthUserDNS:
+		if len(cert.DNSNames) > 0 {
+			authUser = cert.DNSNames[0]
+		}
+	default:
+		return "", fmt.Errorf("unsupported client certificate source: %s", source)
+	}
+	if authUser == "" {
+		return "", fmt.Errorf("bad request: client certificate has no %s", source)
+	}
+
+	return authUser, nil
+}
@@ -0,0 +1,384 @@
+package lmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+// LogCacheChunkSize sets the maximum time range in seconds fetched by a single log query.
+// Larger ranges, like the initial window, are fetched in multiple chunks to limit the response size.
+const LogCacheChunkSize = 3600
+
+// LogCache contains the locally cached log entries of a peer along with their sync state.
+// Entries are stored append-only by column, data rows are only created for the time range of a query.
+// The cache belongs to the peer, so it survives reinitializing the tables.
+type LogCache struct {
+	lock         *deadlock.RWMutex
+	columns      ColumnList       // columns of the cached entries
+	values       []logCacheColumn // cached values, all columns contain the same number of entries
+	timeIndex    int              // index of the time column
+	messageIndex int              // index of the message column
+	seen         map[string]int   // messages with the time of lastSeen, used to skip duplicates on the next sync
+	start        int64            // unix time of the oldest log entry guaranteed to be in the cache
+	lastSeen     int64            // unix time of the latest log entry in the cache
+	synced       bool             // flag wether the cache is up to date and can be used for queries
+}
+
+// logCacheColumn contains the values of a single column of all cached log entries.
+// Only the slice matching the data type of the column is used.
+type logCacheColumn struct {
+	ints    []int64
+	strings []string
+	lists   [][]string
+}
+
+// newLogCache creates an empty log cache starting at given unix time.
+func newLogCache(columns ColumnList, start int64) (*LogCache, error) {
+	cache := &LogCache{
+		lock:         new(deadlock.RWMutex),
+		columns:      columns,
+		values:       make([]logCacheColumn, len(columns)),
+		timeIndex:    -1,
+		messageIndex: -1,
+		seen:         make(map[string]int),
+		start:        start,
+		lastSeen:     start,
+	}
+	for i, col := range columns {
+		switch col.Name {
+		case "time":
+			cache.timeIndex = i
+		case "message":
+			cache.messageIndex = i
+		}
+		switch col.DataType {
+		case IntCol, Int64Col, StringCol, StringListCol:
+		default:
+			return nil, fmt.Errorf("log column %s has unsupported type %s", col.Name, col.DataType.String())
+		}
+	}
+	if cache.timeIndex == -1 || cache.messageIndex == -1 {
+		return nil, fmt.Errorf("log table requires time and message columns")
+	}
+
+	return cache, nil
+}
+
+// UpdateLogCache fetches all log entries since the last sync and removes entries which
+// are outside of the LogCacheWindow. Failed updates mark the cache as outdated, so queries
+// are passed through till the next successful update.
+// It returns any error encountered.
+func (p *Peer) UpdateLogCache(ctx context.Context) (err error) {
+	window := p.lmd.Config.LogCacheWindow
+	if window <= 0 || p.HasFlag(MultiBackend) {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	from := now - window
+	p.lock.RLock()
+	cache := p.logCache
+	p.lock.RUnlock()
+	if cache == nil {
+		_, columns := NewDataStore(Objects.Tables[TableLog], p).GetInitialColumns()
+		cache, err = newLogCache(columns, from)
+		if err != nil {
+			return err
+		}
+		p.lock.Lock()
+		p.logCache = cache
+		p.lock.Unlock()
+	}
+
+	cache.lock.RLock()
+	from = max(cache.lastSeen, from)
+	cache.lock.RUnlock()
+
+	defer func() {
+		if err != nil {
+			cache.lock.Lock()
+			cache.synced = false
+			cache.lock.Unlock()
+		}
+	}()
+
+	for {
+		until := int64(0)
+		if now-from > LogCacheChunkSize {
+			until = from + LogCacheChunkSize
+		}
+		err = p.fetchLogCache(ctx, cache, from, until, now-window)
+		if err != nil {
+			return err
+		}
+		if until == 0 {
+			return nil
+		}
+		from = until
+	}
+}
+
+// fetchLogCache fetches the log entries between from and until, or all since from if until is 0, and adds them to the cache.
+func (p *Peer) fetchLogCache(ctx context.Context, cache *LogCache, from, until, minTime int64) (err error) {
+	keys := make([]string, 0, len(cache.columns))
+	for _, col := range cache.columns {
+		keys = append(keys, col.Name)
+	}
+	req := &Request{
+		Table:     TableLog,
+		Columns:   keys,
+		FilterStr: fmt.Sprintf("Filter: time >= %d\n", from),
+	}
+	if until > 0 {
+		req.FilterStr += fmt.Sprintf("Filter: time < %d\n", until)
+	}
+	p.setQueryOptions(req)
+	res, resMeta, err := p.Query(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	for _, raw := range res {
+		if len(raw) != len(cache.columns) {
+			return fmt.Errorf("log result set verification failed: expected %d columns and got %d", len(cache.columns), len(raw))
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return interface2int64(res[i][cache.timeIndex]) < interface2int64(res[j][cache.timeIndex])
+	})
+
+	time1 := time.Now()
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	added := 0
+	for _, raw := range res {
+		entryTime := interface2int64(raw[cache.timeIndex])
+		message := interface2stringNoDedup(raw[cache.messageIndex])
+		if entryTime < cache.lastSeen {
+			continue
+		}
+		if entryTime == cache.lastSeen && cache.seen[message] > 0 {
+			// already fetched during the last sync
+			cache.seen[message]--
+
+			continue
+		}
+		cache.append(raw)
+		added++
+	}
+
+	// remember all entries of the last second, they will be fetched again next time
+	times := cache.values[cache.timeIndex].ints
+	if num := len(times); num > 0 {
+		cache.lastSeen = times[num-1]
+	}
+	cache.seen = make(map[string]int)
+	for i := len(times) - 1; i >= 0 && times[i] == cache.lastSeen; i-- {
+		cache.seen[cache.values[cache.messageIndex].strings[i]]++
+	}
+	// completed chunks do not need to be fetched again
+	if until > cache.lastSeen {
+		cache.lastSeen = until
+		cache.seen = make(map[string]int)
+	}
+	if until == 0 {
+		cache.synced = true
+	}
+
+	cache.expire(minTime)
+
+	logWith(p, req).Debugf("up. log cache - fetch: %9s - insert: %9s - added: %8d - cached: %8d - size: %8d kB",
+		resMeta.Duration.Truncate(time.Millisecond), time.Since(time1).Truncate(time.Millisecond), added, cache.count(), resMeta.Size/1024)
+	promObjectCount.WithLabelValues(p.Name, "log").Set(float64(cache.count()))
+
+	return nil
+}
+
+// count returns the number of cached entries. cache.lock must be held.
+func (cache *LogCache) count() int {
+	return len(cache.values[cache.timeIndex].ints)
+}
+
+// append adds the raw log entry to the cache. cache.lock must be held.
+func (cache *LogCache) append(raw []interface{}) {
+	for i, col := range cache.columns {
+		values := &cache.values[i]
+		switch col.DataType {
+		case IntCol, Int64Col:
+			values.ints = append(values.ints, interface2int64(raw[i]))
+		case StringCol:
+			values.strings = append(values.strings, *interface2string(raw[i]))
+		case StringListCol:
+			values.lists = append(values.lists, interface2stringlist(raw[i]))
+		default:
+			log.Panicf("unsupported column %s in log cache", col.Name)
+		}
+	}
+}
+
+// value returns the raw value of the entry with given index. cache.lock must be held.
+func (cache *LogCache) value(column, index int) interface{} {
+	values := &cache.values[column]
+	switch cache.columns[column].DataType {
+	case IntCol, Int64Col:
+		return values.ints[index]
+	case StringCol:
+		return values.strings[index]
+	default:
+		return values.lists[index]
+	}
+}
+
+// expire removes all log entries older than given timestamp. cache.lock must be held.
+func (cache *LogCache) expire(minTime int64) {
+	cache.start = max(cache.start, minTime)
+
+	expired := cache.search(minTime)
+	if expired == 0 {
+		return
+	}
+
+	// copy remaining entries once most of them expired, so the memory of the expired ones can be freed
+	compact := expired > cache.count()/2
+	for i := range cache.values {
+		values := &cache.values[i]
+		switch {
+		case values.ints != nil && compact:
+			values.ints = append(make([]int64, 0, len(values.ints)-expired), values.ints[expired:]...)
+		case values.ints != nil:
+			values.ints = values.ints[expired:]
+		case values.strings != nil && compact:
+			values.strings = append(make([]string, 0, len(values.strings)-expired), values.strings[expired:]...)
+		case values.strings != nil:
+			values.strings = values.strings[expired:]
+		case values.lists != nil && compact:
+			values.lists = append(make([][]string, 0, len(values.lists)-expired), values.lists[expired:]...)
+		case values.lists != nil:
+			values.lists = values.lists[expired:]
+		}
+	}
+}
+
+// search returns the index of the first entry at or after given timestamp. cache.lock must be held.
+func (cache *LogCache) search(minTime int64) int {
+	times := cache.values[cache.timeIndex].ints
+
+	return sort.Search(len(times), func(i int) bool {
+		return times[i] >= minTime
+	})
+}
+
+// getLogCacheStore returns a new log store with all cached entries since minTime.
+func (p *Peer) getLogCacheStore(minTime int64) (*DataStore, error) {
+	p.lock.RLock()
+	cache := p.logCache
+	data := p.data
+	p.lock.RUnlock()
+	if cache == nil || data == nil {
+		return nil, fmt.Errorf("peer is down: %s", p.getError())
+	}
+
+	store := NewDataStore(Objects.Tables[TableLog], p)
+
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+	first := cache.search(minTime)
+	store.Data = make([]*DataRow, 0, cache.count()-first)
+	raw := make([]interface{}, len(cache.columns))
+	for index := first; index < cache.count(); index++ {
+		for i := range cache.columns {
+			raw[i] = cache.value(i, index)
+		}
+		row, err := NewDataRow(store, raw, cache.columns, 0, false)
+		if err != nil {
+			return nil, err
+		}
+		store.Data = append(store.Data, row)
+	}
+	// the data set is used to lock the store and to look up contact groups
+	store.DataSet = data
+
+	return store, nil
+}
+
+// canUseLogCache returns true if the log query can be answered from the local log cache of all selected peers.
+func (res *Response) canUseLogCache() bool {
+	req := res.Request
+	if req.lmd == nil || req.lmd.Config.LogCacheWindow <= 0 {
+		return false
+	}
+	minTime, ok := logFilterMinTime(req.Filter)
+	if !ok {
+		return false
+	}
+
+	for _, peer := range res.SelectedPeers {
+		if !peer.hasLogCache(minTime) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasLogCache returns true if all log entries since minTime are cached and the peer is up,
+// otherwise the cache might be outdated.
+func (p *Peer) hasLogCache(minTime int64) bool {
+	p.lock.RLock()
+	cache := p.logCache
+	usable := p.data != nil && !p.Idling && p.PeerState == PeerStatusUp
+	p.lock.RUnlock()
+	if cache == nil || !usable {
+		return false
+	}
+
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+	if !cache.synced {
+		return false
+	}
+
+	return minTime >= cache.start
+}
+
+// logFilterMinTime returns the lower time boundary of the given log filter.
+// It returns false if the filter does not limit the time.
+func logFilterMinTime(filter []*Filter) (minTime int64, ok bool) {
+	for _, fil := range filter {
+		if fil.Negate {
+			continue
+		}
+		if len(fil.Filter) > 0 {
+			if fil.GroupOperator != And {
+				continue
+			}
+			if groupMin, groupOK := logFilterMinTime(fil.Filter); groupOK && (!ok || groupMin > minTime) {
+				minTime, ok = groupMin, true
+			}
+
+			continue
+		}
+		if fil.Column == nil || fil.Column.Name != "time" || fil.IsEmpty {
+			continue
+		}
+		var value int64
+		switch fil.Operator {
+		case GreaterThan, Equal:
+			value = fil.Int64Value
+		case Greater:
+			value = fil.Int64Value + 1
+		default:
+			continue
+		}
+		if !ok || value > minTime {
+			minTime, ok = value, true
+		}
+	}
+
+	return minTime, ok
+}
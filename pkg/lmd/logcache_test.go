@@ -0,0 +1,139 @@
+package lmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogFilterMinTime(t *testing.T) {
+	lmd := createTestLMDInstance()
+	tests := []struct {
+		query   string
+		minTime int64
+		ok      bool
+	}{
+		{"GET log\n\n", 0, false},
+		{"GET log\nFilter: time >= 100\n\n", 100, true},
+		{"GET log\nFilter: time > 100\n\n", 101, true},
+		{"GET log\nFilter: time < 100\n\n", 0, false},
+		{"GET log\nFilter: time >= 100\nFilter: time >= 200\n\n", 200, true},
+		{"GET log\nFilter: time >= 100\nFilter: time >= 200\nOr: 2\n\n", 0, false},
+		{"GET log\nFilter: time >= 100\nFilter: class = 1\nAnd: 2\n\n", 100, true},
+	}
+	for _, test := range tests {
+		req, _, err := NewRequest(context.TODO(), lmd, bufio.NewReader(bytes.NewBufferString(test.query)), ParseDefault)
+		require.NoError(t, err)
+		minTime, ok := logFilterMinTime(req.Filter)
+		assert.Equalf(t, test.ok, ok, "query: %s", test.query)
+		assert.Equalf(t, test.minTime, minTime, "query: %s", test.query)
+	}
+}
+
+func TestLogCache(t *testing.T) {
+	peer, cleanup, mocklmd := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	mocklmd.PeerMapLock.RLock()
+	mockPeer := mocklmd.PeerMap[mocklmd.PeerMapOrder[0]]
+	mocklmd.PeerMapLock.RUnlock()
+
+	now := time.Now().Unix()
+	assert.False(t, mockPeer.hasLogCache(now))
+
+	// the initial window is fetched in chunks
+	mocklmd.Config.LogCacheWindow = 3 * LogCacheChunkSize
+	queries := interface2int64(mockPeer.statusGetLocked(Queries))
+	err := mockPeer.UpdateLogCache(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, queries+3, interface2int64(mockPeer.statusGetLocked(Queries)))
+	assert.True(t, mockPeer.hasLogCache(now-3*LogCacheChunkSize+60))
+
+	// further updates only fetch new entries
+	err = mockPeer.UpdateLogCache(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, queries+4, interface2int64(mockPeer.statusGetLocked(Queries)))
+
+	mockPeer.lock.Lock()
+	mockPeer.logCache = nil
+	mockPeer.lock.Unlock()
+	mocklmd.Config.LogCacheWindow = 3600
+	err = mockPeer.UpdateLogCache(context.TODO())
+	require.NoError(t, err)
+
+	assert.True(t, mockPeer.hasLogCache(now-60))
+	assert.False(t, mockPeer.hasLogCache(now-7200))
+
+	// expire old entries
+	mockPeer.lock.RLock()
+	cache := mockPeer.logCache
+	mockPeer.lock.RUnlock()
+	cache.lock.Lock()
+	for _, ts := range []int64{now - 7200, now - 5000, now - 60} {
+		raw := make([]interface{}, len(cache.columns))
+		for i, col := range cache.columns {
+			switch col.Name {
+			case "time":
+				raw[i] = ts
+			case "message":
+				raw[i] = fmt.Sprintf("[%d] test", ts)
+			}
+		}
+		cache.append(raw)
+	}
+	cache.expire(now - 3600)
+	require.Equal(t, 1, cache.count())
+	assert.Equal(t, now-60, cache.value(cache.timeIndex, 0))
+	cache.lock.Unlock()
+
+	store, err := mockPeer.getLogCacheStore(now - 600)
+	require.NoError(t, err)
+	require.Len(t, store.Data, 1)
+	assert.Equal(t, fmt.Sprintf("[%d] test", now-60), store.Data[0].GetStringByName("message"))
+
+	// query inside the window is answered from the cache
+	res, _, err := peer.QueryString(fmt.Sprintf("GET log\nColumns: time message\nFilter: time >= %d\n\n", now-600))
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, fmt.Sprintf("[%d] test", now-60), res[0][1])
+
+	// query beyond the window is passed through
+	res, _, err = peer.QueryString(fmt.Sprintf("GET log\nColumns: time message\nFilter: time >= %d\n\n", now-7200))
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	// failed updates mark the cache as outdated till the next successful update
+	lmd := createTestLMDInstance()
+	lmd.Config.LogCacheWindow = 3600
+	brokenPeer := NewPeer(lmd, &Connection{Name: "broken", ID: "broken", Source: []string{"doesnotexist.sock"}})
+	brokenCache, err := newLogCache(cache.columns, now-3600)
+	require.NoError(t, err)
+	brokenCache.synced = true
+	brokenPeer.lock.Lock()
+	brokenPeer.logCache = brokenCache
+	brokenPeer.data = NewDataStoreSet(brokenPeer)
+	brokenPeer.PeerState = PeerStatusUp
+	brokenPeer.lock.Unlock()
+	assert.True(t, brokenPeer.hasLogCache(now-60))
+	err = brokenPeer.UpdateLogCache(context.TODO())
+	require.Error(t, err)
+	assert.False(t, brokenPeer.hasLogCache(now-60))
+
+	// peers which are not up might be outdated
+	mockPeer.lock.Lock()
+	mockPeer.PeerState = PeerStatusDown
+	mockPeer.lock.Unlock()
+	assert.False(t, mockPeer.hasLogCache(now-60))
+	mockPeer.lock.Lock()
+	mockPeer.PeerState = PeerStatusUp
+	mockPeer.lock.Unlock()
+
+	err = cleanup()
+	require.NoError(t, err)
+}
@@ -0,0 +1,78 @@
+package lmd
+
+import (
+	"sync/atomic"
+)
+
+// lruCache is a size limited map which evicts the least recently used entry once the limit is reached.
+// It does not lock itself: get may be called concurrently with a read lock held, add and clear require a write lock.
+type lruCache[V any] struct {
+	entries map[string]*lruEntry[V]
+	clock   atomic.Int64 // increased on every access to track the usage order
+	size    int
+}
+
+type lruEntry[V any] struct {
+	value    V
+	lastUsed atomic.Int64
+}
+
+// newLRUCache creates a new cache with given maximum number of entries.
+func newLRUCache[V any](size int) *lruCache[V] {
+	return &lruCache[V]{
+		entries: make(map[string]*lruEntry[V]),
+		size:    size,
+	}
+}
+
+// get returns the cached value and marks it as recently used.
+func (c *lruCache[V]) get(key string) (value V, ok bool) {
+	entry, ok := c.entries[key]
+	if !ok {
+		return value, false
+	}
+	entry.lastUsed.Store(c.clock.Add(1))
+
+	return entry.value, true
+}
+
+// add stores the value and evicts the least recently used entry if the cache is full.
+func (c *lruCache[V]) add(key string, value V) {
+	if entry, ok := c.entries[key]; ok {
+		entry.value = value
+		entry.lastUsed.Store(c.clock.Add(1))
+
+		return
+	}
+	if len(c.entries) >= c.size {
+		oldestKey := ""
+		oldest := int64(-1)
+		for k, entry := range c.entries {
+			if used := entry.lastUsed.Load(); oldest == -1 || used < oldest {
+				oldestKey = k
+				oldest = used
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+	entry := &lruEntry[V]{value: value}
+	entry.lastUsed.Store(c.clock.Add(1))
+	c.entries[key] = entry
+}
+
+// each calls fn for all cached entries without changing their usage order.
+func (c *lruCache[V]) each(fn func(key string, value V)) {
+	for key, entry := range c.entries {
+		fn(key, entry.value)
+	}
+}
+
+// clear removes all entries.
+func (c *lruCache[V]) clear() {
+	c.entries = make(map[string]*lruEntry[V])
+}
+
+// count returns the number of cached entries.
+func (c *lruCache[V]) count() int {
+	return len(c.entries)
+}
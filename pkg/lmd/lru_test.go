@@ -0,0 +1,33 @@
+package lmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCache(t *testing.T) {
+	cache := newLRUCache[int](2)
+	cache.add("a", 1)
+	cache.add("b", 2)
+
+	// a has been used more recently than b
+	val, ok := cache.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, val)
+
+	cache.add("c", 3)
+	assert.Equal(t, 2, cache.count())
+	_, ok = cache.get("b")
+	assert.Falsef(t, ok, "least recently used entry has been evicted")
+	_, ok = cache.get("a")
+	assert.True(t, ok)
+
+	cache.add("c", 4)
+	val, _ = cache.get("c")
+	assert.Equal(t, 4, val)
+	assert.Equal(t, 2, cache.count())
+
+	cache.clear()
+	assert.Equal(t, 0, cache.count())
+}
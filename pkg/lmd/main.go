@@ -22,6 +22,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -81,6 +82,27 @@ const (
 	CtxPeer    ContextKey = "peer"
 	CtxClient  ContextKey = "client"
 	CtxRequest ContextKey = "request"
+
+	// CtxGeneration is used to collect delta updates which should be applied together.
+	CtxGeneration ContextKey = "generation"
+
+	// CtxAPIToken contains the api token used to authenticate a http request.
+	CtxAPIToken ContextKey = "apitoken"
+
+	// CtxAuthUser contains the AuthUser from a tls client certificate which cannot be overridden by requests.
+	CtxAuthUser ContextKey = "authuser"
+
+	// CtxNodeAuth is set if a http request is authenticated with the NodeToken of another cluster node.
+	CtxNodeAuth ContextKey = "nodeauth"
+
+	// CtxGraphQL contains the state of the current graphql request.
+	CtxGraphQL ContextKey = "graphql"
+
+	// CtxListener contains the connection string of the listener which accepted a http request.
+	CtxListener ContextKey = "listener"
+
+	// CtxRemoteAddr contains the remote address of a http request.
+	CtxRemoteAddr ContextKey = "remoteaddr"
 )
 
 // https://github.com/golang/go/issues/8005#issuecomment-190753527
@@ -126,6 +148,13 @@ type Daemon struct {
 	waitGroupPeers    *sync.WaitGroup
 	ListenersLock     *deadlock.RWMutex // ListenersLock is the lock for the Listeners map
 	nodeAccessor      *Nodes            // nodeAccessor manages cluster nodes and starts/stops peers.
+	changeStream      *ChangeStream     // changeStream distributes row changes to http stream subscribers
+	stateEvents       *StateEventBroker // stateEvents distributes host and service state changes to http event subscribers
+	auditLog          *AuditLog         // auditLog records commands and administrative actions
+	auditLock         *deadlock.RWMutex // auditLock is the lock for the auditLog
+	requestLimiter    *RequestLimiter   // requestLimiter enforces the client, user and listener limits
+	peerAdminLock     *deadlock.Mutex   // peerAdminLock serializes runtime peer administration actions
+	healthLock        *sync.Mutex       // healthLock serializes the lock probes of liveness checks
 	shutdownChannel   chan bool
 	cpuProfileHandler *os.File
 	PeerMap           map[string]*Peer // PeerMap contains a map of available remote peers.
@@ -150,6 +179,8 @@ type Daemon struct {
 		flagVersion      bool
 	}
 	lastMainRestart          float64
+	reloadStart              time.Time   // set when a configuration reload was requested
+	initialized              atomic.Bool // set once listeners and peers have been started initially
 	defaultReqestParseOption ParseOptions
 }
 
@@ -199,6 +230,12 @@ func NewLMDInstance() (lmd *Daemon) {
 		waitGroupPeers:           &sync.WaitGroup{},
 		shutdownChannel:          make(chan bool),
 		defaultReqestParseOption: ParseOptimize,
+		changeStream:             NewChangeStream(),
+		stateEvents:              NewStateEventBroker(StateEventBufferSize),
+		auditLock:                new(deadlock.RWMutex),
+		requestLimiter:           NewRequestLimiter(),
+		peerAdminLock:            new(deadlock.Mutex),
+		healthLock:               new(sync.Mutex),
 	}
 
 	return
@@ -295,8 +332,22 @@ func (lmd *Daemon) mainLoop() (exitCode int) {
 	once.Do(lmd.PrintVersion)
 	log.Infof("%s - version %s started with config %s", NAME, Version(), lmd.flags.flagConfigFile)
 	localConfig.LogConfig()
+	if localConfig.PeerAdminConfig != "" && !isIncludedConfigFile(localConfig.PeerAdminConfig, lmd.flags.flagConfigFile) {
+		log.Warnf("PeerAdminConfig %s is not included with -c, runtime peer changes will be lost on restart", localConfig.PeerAdminConfig)
+	}
 	ctx := context.Background()
 
+	lmd.initAuditLog()
+	if !lmd.reloadStart.IsZero() {
+		lmd.audit(&AuditEntry{
+			Action:   AuditActionReload,
+			Message:  fmt.Sprintf("configuration reloaded from %s", lmd.flags.flagConfigFile.String()),
+			Code:     ReturnCodeOK,
+			Duration: time.Since(lmd.reloadStart).Seconds(),
+		})
+		lmd.reloadStart = time.Time{}
+	}
+
 	// initialize prometheus
 	prometheusListener := initPrometheus(lmd)
 
@@ -319,6 +370,7 @@ func (lmd *Daemon) mainLoop() (exitCode int) {
 		lmd.initializePeers(ctx)
 	}
 
+	lmd.initialized.Store(true)
 	if lmd.initChannel != nil {
 		lmd.initChannel <- true
 	}
@@ -480,7 +532,12 @@ func (lmd *Daemon) initializePeers(ctx context.Context) {
 				peer.waitGroup = lmd.waitGroupPeers
 				peer.shutdownChannel = lmd.shutdownChannel
 				peer.SetHTTPClient()
+				data := peer.data
 				peer.lock.Unlock()
+				if data != nil {
+					// authorization settings might have changed
+					data.resetAuthCache()
+				}
 			}
 		}
 		lmd.PeerMapLock.RUnlock()
@@ -770,6 +827,7 @@ func (lmd *Daemon) mainSignalHandler(sig os.Signal, prometheusListener io.Closer
 		return (1)
 	case syscall.SIGHUP:
 		log.Infof("got sighup, reloading configuration...")
+		lmd.reloadStart = time.Now()
 		if prometheusListener != nil {
 			prometheusListener.Close()
 		}
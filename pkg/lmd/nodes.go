@@ -8,11 +8,14 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/sasha-s/go-deadlock"
 )
 
 var reNodeAddress = regexp.MustCompile(`^(https?)?(://)?(.*?)(:(\d+))?(/.*)?$`)
@@ -24,6 +27,7 @@ type Nodes struct {
 	WaitGroupInit    *sync.WaitGroup
 	ShutdownChannel  chan bool
 	lmd              *Daemon
+	lock             *deadlock.Mutex // lock is used to serialize redistribution and changes of the backends list
 	stopChannel      chan bool
 	nodeBackends     map[string][]string
 	thisNode         *NodeAddress
@@ -78,6 +82,7 @@ func NewNodes(lmd *Daemon, addresses []string, listen string) *Nodes {
 		stopChannel:     make(chan bool),
 		nodeBackends:    make(map[string][]string),
 		lmd:             lmd,
+		lock:            new(deadlock.Mutex),
 	}
 	tlsConfig := getMinimalTLSConfig(lmd.Config)
 	node.HTTPClient = NewLMDHTTPClient(tlsConfig, "")
@@ -172,7 +177,7 @@ func (n *Nodes) Initialize(ctx context.Context) {
 		n.lmd.PeerMapLock.RLock()
 		for id := range n.lmd.PeerMap {
 			peer := n.lmd.PeerMap[id]
-			if val, ok := peer.statusGetLocked(Paused).(bool); ok && val {
+			if val, ok := peer.statusGetLocked(Paused).(bool); ok && val && !peer.isAdminPaused() {
 				peer.Start(ctx)
 			}
 		}
@@ -289,6 +294,9 @@ func (n *Nodes) checkNodeAvailability(ctx context.Context) {
 // redistribute assigns the peers to the available nodes.
 // It starts peers assigned to this node and stops other peers.
 func (n *Nodes) redistribute(ctx context.Context) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
 	// Nodes and backends
 	numberBackends := len(n.backends)
 	ownIndex, nodeOnline, numberAllNodes, numberAvailableNodes := n.getOnlineNodes()
@@ -403,11 +411,47 @@ func (n *Nodes) updateBackends(ctx context.Context, ourBackends []string) {
 	}
 	for _, newBackend := range addBackends {
 		peer := n.lmd.PeerMap[newBackend]
+		if peer.isAdminPaused() {
+			continue
+		}
 		peer.Start(ctx)
 	}
 	n.lmd.PeerMapLock.RUnlock()
 }
 
+// addBackend adds a new peer to the list of backends.
+// In cluster mode, the backends are redistributed and the peer is started by the node it is assigned to.
+// In single mode, the peer is started right away unless it is paused.
+func (n *Nodes) addBackend(ctx context.Context, peer *Peer) {
+	n.lock.Lock()
+	n.backends = append(n.backends, peer.ID)
+	n.lock.Unlock()
+
+	if n.IsClustered() {
+		if n.thisNode != nil {
+			n.redistribute(ctx)
+		}
+
+		return
+	}
+	if !peer.isAdminPaused() {
+		peer.Start(ctx)
+	}
+}
+
+// removeBackend removes the peer from the list of backends and redistributes the remaining backends in cluster mode.
+// The peer itself is not stopped.
+func (n *Nodes) removeBackend(ctx context.Context, peerKey string) {
+	n.lock.Lock()
+	n.backends = slices.DeleteFunc(n.backends, func(id string) bool { return id == peerKey })
+	n.assignedBackends = slices.DeleteFunc(n.assignedBackends, func(id string) bool { return id == peerKey })
+	n.lock.Unlock()
+
+	if n.IsClustered() && n.thisNode != nil {
+		n.redistribute(ctx)
+	}
+}
+
 func (n *Nodes) getOnlineNodes() (ownIndex int, nodeOnline []bool, numberAllNodes, numberAvailableNodes int) {
 	allNodes := n.nodeAddresses
 	numberAllNodes = len(allNodes)
@@ -473,6 +517,9 @@ func (n *Nodes) SendQuery(ctx context.Context, node *NodeAddress, name string, p
 	url := node.url + "query"
 	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(rawRequest))
 	req.Header.Set("Content-Type", contentType)
+	if n.lmd.Config.NodeToken != "" {
+		req.Header.Set("Authorization", "Bearer "+n.lmd.Config.NodeToken)
+	}
 	res, err := n.HTTPClient.Do(req)
 	if err != nil {
 		log.Debugf("error sending query (%s) to node (%s): %s", name, node, err.Error())
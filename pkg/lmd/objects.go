@@ -110,6 +110,11 @@ func NewBackendsTable() (t *Table) {
 	t.AddPeerInfoColumn("federation_addr", StringListCol, "original addresses when using nested federation")
 	t.AddPeerInfoColumn("federation_type", StringListCol, "original types when using nested federation")
 	t.AddPeerInfoColumn("federation_version", StringListCol, "original version when using nested federation")
+	t.AddPeerInfoColumn("source_mode", StringCol, "How queries are distributed across sources (failover, roundrobin or leastconn)")
+	t.AddPeerInfoColumn("source_addr", StringListCol, "List of all source and fallback addresses")
+	t.AddPeerInfoColumn("source_status", Int64ListCol, "Status of each source address (0 - UP, 2 - Down, 4 - Pending)")
+	t.AddPeerInfoColumn("source_last_error", StringListCol, "Last error of each source address or empty if up")
+	t.AddPeerInfoColumn("source_active_queries", Int64ListCol, "Number of running queries for each source address")
 	t.AddExtraColumn("localtime", VirtualStore, None, FloatCol, NoFlags, "The unix timestamp of the local lmd host.")
 
 	return t
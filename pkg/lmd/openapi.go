@@ -0,0 +1,363 @@
+package lmd
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// OpenAPIVersion sets the version of the generated OpenAPI document.
+const OpenAPIVersion = "3.0.3"
+
+// openapi sends the OpenAPI document for all table endpoints.
+func (c *HTTPServerController) openapi(wrt http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	wrt.Header().Set("Content-Type", "application/json")
+	restWriteJSON(wrt, c.lmd.buildOpenAPISpec())
+}
+
+// buildOpenAPISpec generates the OpenAPI document from the table definitions.
+// It is created on every request, so optional columns are marked available once a backend supports them.
+func (lmd *Daemon) buildOpenAPISpec() map[string]interface{} {
+	flags := lmd.backendFlags()
+
+	tableNames := make([]string, 0, len(Objects.Tables))
+	for name := range Objects.Tables {
+		tableNames = append(tableNames, name.String())
+	}
+	sort.Strings(tableNames)
+
+	paths := map[string]interface{}{
+		"/table/{name}": map[string]interface{}{
+			"post": openAPITableOperation(tableNames),
+		},
+	}
+	schemas := map[string]interface{}{
+		"Error": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"error": map[string]interface{}{"type": "string"}},
+		},
+		"TableRequest": openAPITableRequestSchema(),
+	}
+
+	for name, table := range Objects.Tables {
+		schemas[name.String()] = openAPIObjectSchema(table, flags)
+		for path, item := range openAPITablePaths(name, table) {
+			paths[path] = item
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": OpenAPIVersion,
+		"info": map[string]interface{}{
+			"title":       "LMD",
+			"description": "Livestatus Multitool Daemon http api",
+			"version":     VERSION,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"description": "error",
+					"content":     openAPIJSONContent(openAPIRef("schemas", "Error")),
+				},
+			},
+		},
+	}
+}
+
+// backendFlags returns the combined flags of all backends.
+func (lmd *Daemon) backendFlags() (flags OptionalFlags) {
+	lmd.PeerMapLock.RLock()
+	defer lmd.PeerMapLock.RUnlock()
+	for _, peer := range lmd.PeerMap {
+		flags |= OptionalFlags(atomic.LoadUint32(&peer.Flags))
+	}
+
+	return flags
+}
+
+// openAPITablePaths returns the rest endpoints of a table.
+func openAPITablePaths(name TableName, table *Table) map[string]interface{} {
+	tableName := name.String()
+	objectRef := openAPIRef("schemas", tableName)
+	listSchema := map[string]interface{}{"type": "array", "items": objectRef}
+
+	paths := map[string]interface{}{
+		"/" + tableName: map[string]interface{}{
+			"get": map[string]interface{}{
+				"operationId": "list_" + tableName,
+				"summary":     fmt.Sprintf("list %s", tableName),
+				"tags":        []string{tableName},
+				"parameters":  openAPICollectionParameters(table),
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": fmt.Sprintf("list of %s", tableName),
+						"headers": map[string]interface{}{
+							"X-Total-Count": map[string]interface{}{
+								"description": "number of objects without limit and offset",
+								"schema":      map[string]interface{}{"type": "integer"},
+							},
+							"Link": map[string]interface{}{
+								"description": "pagination links, only set along with a limit",
+								"schema":      map[string]interface{}{"type": "string"},
+							},
+						},
+						"content": openAPIJSONContent(listSchema),
+					},
+					"default": openAPIRef("responses", "Error"),
+				},
+			},
+		},
+	}
+
+	if len(table.PrimaryKey) == 0 {
+		return paths
+	}
+
+	keyParams := make([]interface{}, 0, len(table.PrimaryKey))
+	keyPath := "/" + tableName
+	for _, key := range table.PrimaryKey {
+		keyPath += "/{" + key + "}"
+		keyParams = append(keyParams, map[string]interface{}{
+			"name":     key,
+			"in":       "path",
+			"required": true,
+			"schema":   openAPIFilterSchema(table.GetColumn(key)),
+		})
+	}
+	paths[keyPath] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"operationId": "get_" + tableName,
+			"summary":     fmt.Sprintf("get single object from %s by %s", tableName, strings.Join(table.PrimaryKey, " and ")),
+			"tags":        []string{tableName},
+			"parameters":  slices.Concat(keyParams, []interface{}{openAPIQueryParameter("columns", "comma separated list of columns")}),
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "single object",
+					"content":     openAPIJSONContent(objectRef),
+				},
+				"404":     openAPIRef("responses", "Error"),
+				"default": openAPIRef("responses", "Error"),
+			},
+		},
+	}
+
+	if memberTable, ok := restMemberTables[name]; ok {
+		memberName := memberTable.String()
+		paths[keyPath+"/members"] = map[string]interface{}{
+			"get": map[string]interface{}{
+				"operationId": "list_" + tableName + "_members",
+				"summary":     fmt.Sprintf("list %s of a group", memberName),
+				"tags":        []string{tableName},
+				"parameters":  slices.Concat(keyParams, openAPICollectionParameters(Objects.Tables[memberTable])),
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": fmt.Sprintf("list of %s", memberName),
+						"content": openAPIJSONContent(map[string]interface{}{
+							"type":  "array",
+							"items": openAPIRef("schemas", memberName),
+						}),
+					},
+					"404":     openAPIRef("responses", "Error"),
+					"default": openAPIRef("responses", "Error"),
+				},
+			},
+		}
+	}
+
+	return paths
+}
+
+// openAPITableOperation returns the generic /table/{name} operation.
+func openAPITableOperation(tableNames []string) map[string]interface{} {
+	return map[string]interface{}{
+		"operationId": "query_table",
+		"summary":     "query a table with livestatus filter syntax",
+		"parameters": []interface{}{
+			map[string]interface{}{
+				"name":     "name",
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string", "enum": tableNames},
+			},
+		},
+		"requestBody": map[string]interface{}{
+			"required": true,
+			"content":  openAPIJSONContent(openAPIRef("schemas", "TableRequest")),
+		},
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "result in the requested output format",
+				"content":     openAPIJSONContent(map[string]interface{}{}),
+			},
+			"default": openAPIRef("responses", "Error"),
+		},
+	}
+}
+
+// openAPITableRequestSchema returns the schema of the json request used by /table/{name}.
+func openAPITableRequestSchema() map[string]interface{} {
+	stringList := map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}
+	lines := map[string]interface{}{
+		"oneOf": []interface{}{map[string]interface{}{"type": "string"}, stringList},
+	}
+
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"columns":           stringList,
+			"filter":            lines,
+			"stats":             lines,
+			"sort":              stringList,
+			"limit":             map[string]interface{}{"type": "integer", "minimum": 0},
+			"offset":            map[string]interface{}{"type": "integer", "minimum": 0},
+			"backends":          stringList,
+			"authuser":          map[string]interface{}{"type": "string"},
+			"outputformat":      map[string]interface{}{"type": "string", "enum": []string{"json", "wrapped_json", "python"}},
+			"sendcolumnsheader": map[string]interface{}{"type": "boolean"},
+			"distributed":       map[string]interface{}{"type": "boolean"},
+		},
+	}
+}
+
+// openAPICollectionParameters returns the query parameters of collection endpoints.
+func openAPICollectionParameters(table *Table) []interface{} {
+	operators := make([]string, 0, len(restFilterOperators))
+	for op := range restFilterOperators {
+		operators = append(operators, op)
+	}
+	sort.Strings(operators)
+
+	filterProperties := make(map[string]interface{}, len(table.Columns))
+	for _, col := range table.Columns {
+		filterProperties[col.Name] = openAPIFilterSchema(col)
+	}
+
+	return []interface{}{
+		openAPIQueryParameter("columns", "comma separated list of columns"),
+		openAPIQueryParameter("sort", "comma separated list of columns, prefix with - to sort descending"),
+		map[string]interface{}{
+			"name":   "limit",
+			"in":     "query",
+			"schema": map[string]interface{}{"type": "integer", "minimum": 0},
+		},
+		map[string]interface{}{
+			"name":   "offset",
+			"in":     "query",
+			"schema": map[string]interface{}{"type": "integer", "minimum": 0},
+		},
+		openAPIQueryParameter("backends", "comma separated list of backend ids"),
+		openAPIQueryParameter("authuser", "only return objects visible to this contact"),
+		map[string]interface{}{
+			"name":    "filter",
+			"in":      "query",
+			"style":   "form",
+			"explode": true,
+			"description": fmt.Sprintf("filter by column, ie. ?state=2. Append [operator] to the column name to use other operators, ie. ?state[gte]=1. "+
+				"Available operators: %s. The contains operator matches substrings of string columns and elements of list columns, "+
+				"ie. ?plugin_output[contains]=timeout or ?groups[contains]=linux. Repeated parameters are combined with or.", strings.Join(operators, ", ")),
+			"schema": map[string]interface{}{
+				"type":       "object",
+				"properties": filterProperties,
+			},
+			"x-lmd-filter-operators": restFilterOperators,
+		},
+	}
+}
+
+// openAPIQueryParameter returns a string query parameter.
+func openAPIQueryParameter(name, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"schema":      map[string]interface{}{"type": "string"},
+	}
+}
+
+// openAPIObjectSchema returns the schema of a single row of the table.
+// Optional columns list the backend flags they depend on and whether any connected backend provides them.
+func openAPIObjectSchema(table *Table, flags OptionalFlags) map[string]interface{} {
+	properties := make(map[string]interface{}, len(table.Columns))
+	for _, col := range table.Columns {
+		schema := openAPIColumnSchema(col)
+		if col.Description != "" {
+			schema["description"] = col.Description
+		}
+		if col.Optional != NoFlags {
+			schema["x-lmd-optional"] = col.Optional.List()
+			schema["x-lmd-available"] = flags&col.Optional != 0
+		}
+		properties[col.Name] = schema
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(table.PrimaryKey) > 0 {
+		schema["x-lmd-primary-key"] = table.PrimaryKey
+	}
+
+	return schema
+}
+
+// openAPIColumnSchema returns the schema for the values of a column.
+func openAPIColumnSchema(col *Column) map[string]interface{} {
+	switch col.DataType {
+	case StringCol, StringLargeCol, JSONCol:
+		return map[string]interface{}{"type": "string"}
+	case IntCol:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case Int64Col:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case FloatCol:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case StringListCol:
+		return map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}
+	case Int64ListCol:
+		return map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "integer", "format": "int64"}}
+	case CustomVarCol:
+		return map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}}
+	case ServiceMemberListCol:
+		return map[string]interface{}{"type": "array", "items": map[string]interface{}{
+			"type": "array", "items": map[string]interface{}{"type": "string"}, "minItems": 2, "maxItems": 2,
+		}}
+	case InterfaceListCol:
+		return map[string]interface{}{"type": "array", "items": map[string]interface{}{}}
+	default:
+		log.Panicf("type %s not supported", col.DataType)
+	}
+
+	return nil
+}
+
+// openAPIFilterSchema returns the schema of filter values for a column, list columns are filtered by single elements.
+func openAPIFilterSchema(col *Column) map[string]interface{} {
+	switch col.DataType {
+	case IntCol, Int64Col, Int64ListCol:
+		return map[string]interface{}{"type": "integer"}
+	case FloatCol:
+		return map[string]interface{}{"type": "number"}
+	default:
+		return map[string]interface{}{"type": "string"}
+	}
+}
+
+// openAPIRef returns a reference to a component.
+func openAPIRef(kind, name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/" + kind + "/" + name}
+}
+
+// openAPIJSONContent returns the json content definition for given schema.
+func openAPIJSONContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
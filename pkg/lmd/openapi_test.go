@@ -0,0 +1,53 @@
+package lmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	_, cleanup, _, client := StartTestHTTPPeer(t, 1, 2, 2, "")
+
+	recorder := client.Send(http.MethodGet, "/openapi.json", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	spec := struct {
+		OpenAPI    string                            `json:"openapi"`
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]interface{} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &spec))
+	assert.Equal(t, OpenAPIVersion, spec.OpenAPI)
+
+	for _, path := range []string{"/table/{name}", "/hosts", "/hosts/{name}", "/services/{host_name}/{description}", "/hostgroups/{name}/members", "/log"} {
+		assert.Containsf(t, spec.Paths, path, "path %s", path)
+	}
+
+	// every column of every table is documented
+	for name, table := range Objects.Tables {
+		require.Contains(t, spec.Components.Schemas, name.String())
+		assert.Len(t, spec.Components.Schemas[name.String()].Properties, len(table.ColumnsIndex))
+	}
+
+	hosts := spec.Components.Schemas["hosts"].Properties
+	assert.Equal(t, "integer", hosts["state"]["type"])
+	assert.Equal(t, "number", hosts["latency"]["type"])
+	assert.Equal(t, "array", hosts["contacts"]["type"])
+	assert.Equal(t, "object", hosts["custom_variables"]["type"])
+
+	// optional columns list their backend flags and whether a connected backend supports them
+	services := spec.Components.Schemas["services"].Properties
+	assert.Equal(t, []interface{}{"HasDependencyColumn"}, services["depends_exec"]["x-lmd-optional"])
+	assert.Equal(t, true, services["depends_exec"]["x-lmd-available"])
+
+	err := cleanup()
+	require.NoError(t, err)
+}
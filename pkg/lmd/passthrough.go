@@ -0,0 +1,217 @@
+package lmd
+
+import (
+	"context"
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	// PassthroughLatencySamples sets the number of recent passthrough query durations used to calculate the hedging delay.
+	PassthroughLatencySamples = 100
+
+	// PassthroughHedgeMinSamples sets the number of samples required before hedging starts.
+	PassthroughHedgeMinSamples = 10
+)
+
+// hedgedResult contains the result of a passthrough query which might have been sent to multiple sources.
+type hedgedResult struct {
+	err    error
+	res    ResultSet
+	hedged bool
+}
+
+// queryPassthrough sends a passthrough query to the current source. If hedging is enabled and the source
+// does not answer within the hedging delay, the same query will be sent to an alternate source as well
+// and whichever answers first wins.
+func (p *Peer) queryPassthrough(ctx context.Context, req *Request) (ResultSet, error) {
+	delay := p.passthroughHedgeDelay()
+	var alternate *PeerSource
+	if delay > 0 {
+		alternate = p.passthroughHedgeSource()
+	}
+
+	time1 := time.Now()
+	if alternate == nil {
+		res, _, err := p.query(ctx, req)
+		if err == nil {
+			p.addPassthroughLatency(time.Since(time1))
+		}
+
+		return res, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// buffered, so the slower query does not block after we returned
+	results := make(chan *hedgedResult, 2)
+	go func() {
+		defer logPanicExitPeer(p)
+		res, _, err := p.query(ctx, req)
+		results <- &hedgedResult{res: res, err: err}
+	}()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	pending := 1
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			logWith(p, req).Debugf("passthrough query did not answer within %s, sending hedged query to %s", delay, alternate.Addr)
+			promPeerPassthroughHedged.WithLabelValues(p.Name).Inc()
+			pending++
+			go func() {
+				defer logPanicExitPeer(p)
+				res, _, err := p.querySource(ctx, copyPassthroughRequest(req), alternate)
+				results <- &hedgedResult{res: res, err: err, hedged: true}
+			}()
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				p.addPassthroughLatency(time.Since(time1))
+				if result.hedged {
+					logWith(p, req).Debugf("hedged passthrough query to %s answered first", alternate.Addr)
+				}
+
+				return result.res, nil
+			}
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			// errors before the hedging delay are returned right away, failover is handled by the caller
+			if pending == 0 {
+				return nil, firstErr
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// copyPassthroughRequest returns a new request with the same query, so it can be sent in parallel.
+func copyPassthroughRequest(req *Request) *Request {
+	return &Request{
+		Table:           req.Table,
+		Filter:          req.Filter,
+		Stats:           req.Stats,
+		Columns:         req.Columns,
+		Limit:           req.Limit,
+		OutputFormat:    req.OutputFormat,
+		ResponseFixed16: req.ResponseFixed16,
+		AuthUser:        req.AuthUser,
+		Backends:        req.Backends,
+	}
+}
+
+// passthroughHedgeSource returns an alternate source to send hedged queries to or nil if there is none.
+func (p *Peer) passthroughHedgeSource() *PeerSource {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	var alternate *PeerSource
+	for _, source := range p.sources {
+		if source.Addr == p.PeerAddr || source.Status == PeerStatusDown {
+			continue
+		}
+		// prefer primary sources over fallback sources
+		if alternate == nil || (alternate.Fallback && !source.Fallback) {
+			alternate = source
+		}
+	}
+
+	return alternate
+}
+
+// addPassthroughLatency stores the duration of a successful passthrough query.
+func (p *Peer) addPassthroughLatency(duration time.Duration) {
+	promPeerPassthroughDuration.WithLabelValues(p.Name).Observe(duration.Seconds())
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.passthrough.latency) < PassthroughLatencySamples {
+		p.passthrough.latency = append(p.passthrough.latency, duration)
+
+		return
+	}
+	p.passthrough.latency[p.passthrough.next] = duration
+	p.passthrough.next = (p.passthrough.next + 1) % PassthroughLatencySamples
+}
+
+// passthroughHedgeDelay returns the delay after which a hedged query will be sent.
+// It returns 0 if hedging is disabled or not enough samples have been collected yet.
+func (p *Peer) passthroughHedgeDelay() time.Duration {
+	percentile := p.lmd.Config.PassthroughHedgePercentile
+	if percentile <= 0 {
+		return 0
+	}
+
+	p.lock.RLock()
+	samples := slices.Clone(p.passthrough.latency)
+	p.lock.RUnlock()
+	if len(samples) < PassthroughHedgeMinSamples {
+		return 0
+	}
+
+	slices.Sort(samples)
+	index := int(math.Ceil(percentile/100*float64(len(samples)))) - 1
+	index = max(0, min(index, len(samples)-1))
+
+	return max(samples[index], time.Duration(p.lmd.Config.PassthroughHedgeMinDelay)*time.Millisecond)
+}
+
+// logAuthColumns contains the columns required to check the authorization of log entries locally.
+var logAuthColumns = []string{"host_name", "service_description", "current_host_contacts", "current_service_contacts"}
+
+// supportsLogAuthUser returns true if the backend applies the AuthUser header to log queries.
+func (p *Peer) supportsLogAuthUser() bool {
+	return !p.HasFlag(Icinga2) && !p.HasFlag(Shinken)
+}
+
+// localAuthRequest returns a copy of the passthrough request without AuthUser which additionally
+// fetches all columns required to check the authorization locally.
+func localAuthRequest(req *Request) *Request {
+	authReq := copyPassthroughRequest(req)
+	authReq.AuthUser = ""
+	// limit can only be applied after filtering
+	authReq.Limit = nil
+	authReq.Columns = append(slices.Clone(req.Columns), logAuthColumns...)
+
+	return authReq
+}
+
+// filterLogAuth removes all log entries the AuthUser is not allowed to see and strips the additional auth columns.
+func (p *Peer) filterLogAuth(result ResultSet, req *Request) ResultSet {
+	numCols := len(req.Columns)
+	filtered := make(ResultSet, 0, len(result))
+	// contact groups can only be checked if the objects are available
+	data, _ := p.GetDataStoreSet()
+	if data != nil {
+		data.lock.RLock()
+		defer data.lock.RUnlock()
+	}
+	for _, row := range result {
+		if len(row) != numCols+len(logAuthColumns) {
+			logWith(p, req).Warnf("invalid result row, expected %d columns and got %d", numCols+len(logAuthColumns), len(row))
+
+			continue
+		}
+		if !data.isAuthorizedForLogEntry(req.AuthUser,
+			interface2stringNoDedup(row[numCols]),
+			interface2stringNoDedup(row[numCols+1]),
+			interface2stringlist(row[numCols+2]),
+			interface2stringlist(row[numCols+3]),
+			p.lmd.Config.ServiceAuthorization,
+		) {
+			continue
+		}
+		filtered = append(filtered, row[:numCols])
+		if req.Limit != nil && len(filtered) >= *req.Limit {
+			break
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,73 @@
+package lmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPassthroughHedgeDelay(t *testing.T) {
+	lmd := createTestLMDInstance()
+	peer := NewPeer(lmd, &Connection{
+		Name:   "Test",
+		ID:     "test",
+		Source: []string{"a.sock", "b.sock"},
+	})
+
+	// disabled by default
+	for i := range PassthroughLatencySamples {
+		peer.addPassthroughLatency(time.Duration(i+1) * time.Second)
+	}
+	assert.Equal(t, time.Duration(0), peer.passthroughHedgeDelay())
+
+	lmd.Config.PassthroughHedgePercentile = 95
+	assert.Equal(t, 95*time.Second, peer.passthroughHedgeDelay())
+
+	// ring buffer keeps the latest samples only
+	for range PassthroughLatencySamples {
+		peer.addPassthroughLatency(time.Millisecond)
+	}
+	assert.Len(t, peer.passthrough.latency, PassthroughLatencySamples)
+	assert.Equal(t, time.Duration(lmd.Config.PassthroughHedgeMinDelay)*time.Millisecond, peer.passthroughHedgeDelay())
+
+	// alternate source is the one not in use
+	peer.PeerAddr = "a.sock"
+	require.NotNil(t, peer.passthroughHedgeSource())
+	assert.Equal(t, "b.sock", peer.passthroughHedgeSource().Addr)
+}
+
+func TestPassthroughHedgedQuery(t *testing.T) {
+	peer, cleanup, _ := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	peer.lmd.Config.PassthroughHedgePercentile = 50
+	peer.lmd.Config.PassthroughHedgeMinDelay = 0
+	for range PassthroughHedgeMinSamples {
+		peer.addPassthroughLatency(time.Nanosecond)
+	}
+	// failed source from the initial connection
+	peer.lock.Lock()
+	peer.getSource("doesnotexist").Status = PeerStatusPending
+	peer.lock.Unlock()
+
+	alternate := peer.passthroughHedgeSource()
+	require.NotNil(t, alternate)
+	assert.Equal(t, "doesnotexist", alternate.Addr)
+
+	// hedged query fails, but the primary one answers
+	req := &Request{
+		Table:           TableLog,
+		Columns:         []string{"time", "type", "message"},
+		OutputFormat:    OutputFormatJSON,
+		ResponseFixed16: true,
+	}
+	res, err := peer.queryPassthrough(context.TODO(), req)
+	require.NoError(t, err)
+	assert.NotEmpty(t, res)
+
+	err = cleanup()
+	require.NoError(t, err)
+}
@@ -93,6 +93,19 @@ type Peer struct {
 		Request  *Request // reference to last query (used in error reports)
 		Response []byte   // reference to last response
 	}
+	sources     []*PeerSource // status of all source and fallback addresses
+	sourceMode  SourceMode    // defines how queries are distributed across sources
+	sourceNext  atomic.Uint32 // round robin counter
+	passthrough struct {
+		latency []time.Duration // recent passthrough query durations, used to calculate the hedging delay
+		next    int             // next index in the latency ring buffer
+	}
+	logCache *LogCache // locally cached log entries, nil if not enabled
+	stream   struct {
+		since     float64 // unix time when the change stream got connected
+		running   bool    // flag wether the change stream consumer is running
+		connected bool    // flag wether the change stream is connected right now
+	}
 	Source                     []string // reference to all connection strings
 	Fallback                   []string // reference to all fallback connection strings
 	SubName                    []string
@@ -255,7 +268,13 @@ func NewPeer(lmd *Daemon, config *Connection) *Peer {
 		Config:          config,
 		lmd:             lmd,
 		Flags:           uint32(NoFlags),
+		sources:         newPeerSources(config.Source, config.Fallback),
+	}
+	sourceMode, err := NewSourceMode(config.SourceMode)
+	if err != nil {
+		logWith(&peer).Warnf("%s", err.Error())
 	}
+	peer.sourceMode = sourceMode
 	peer.cache.connectionPool = make(chan net.Conn, lmd.Config.MaxParallelPeerConnections)
 	peer.cache.maxParallelConnections = make(chan bool, lmd.Config.MaxParallelPeerConnections)
 	if len(peer.Source) == 0 {
@@ -341,6 +360,10 @@ func (p *Peer) countFromServer(ctx context.Context, name, queryCondition string)
 // updateLoop is the main loop updating this peer.
 // It does not return till triggered by the shutdownChannel or by the internal stopChannel.
 func (p *Peer) updateLoop(ctx context.Context) {
+	// cancel background tasks, like the change stream, once the loop ends
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	err := p.InitAllTables(ctx)
 	if err != nil {
 		logWith(p).Warnf("initializing objects failed: %s", err.Error())
@@ -353,6 +376,14 @@ func (p *Peer) updateLoop(ctx context.Context) {
 		peer.clearLastRequest()
 	}
 
+	// source health checks may take up to the connect timeout, so they must not delay the updates
+	if p.isBalanced() {
+		go func() {
+			defer logPanicExitPeer(p)
+			p.sourceHealthLoop(ctx)
+		}()
+	}
+
 	var lastErr error
 	ticker := time.NewTicker(UpdateLoopTickerInterval)
 	for {
@@ -462,7 +493,18 @@ func (p *Peer) periodicUpdate(ctx context.Context) (ok bool, err error) {
 			p.statusSetLocked(ForceFull, false)
 		}
 
-		return ok, data.UpdateDelta(ctx, lastUpdate, now)
+		err = data.UpdateDelta(ctx, lastUpdate, now)
+		if err != nil {
+			return ok, err
+		}
+
+		// the log cache is optional, queries are passed through to the backend until it is synced again
+		err = p.UpdateLogCache(ctx)
+		if err != nil {
+			logWith(p).Warnf("updating log cache failed: %s", err.Error())
+		}
+
+		return ok, nil
 	}
 
 	logWith(p).Panicf("unhandled status case: %s", lastStatus.String())
@@ -524,6 +566,10 @@ func (p *Peer) periodicUpdateLMD(ctx context.Context, data *DataStoreSet, force
 	// of the update interval
 	p.statusSetLocked(LastUpdate, now)
 
+	if p.Config.StreamSource != "" {
+		p.startChangeStream(ctx)
+	}
+
 	columns := []string{"key", "name", "status", "addr", "last_error", "last_update", "last_online", "last_query", "idling"}
 	req := &Request{
 		Table:   TableSites,
@@ -974,9 +1020,16 @@ func (p *Peer) resetErrors() {
 // query sends the request to a remote livestatus.
 // It returns the unmarshaled result and any error encountered.
 func (p *Peer) query(ctx context.Context, req *Request) (ResultSet, *ResultMetaData, error) {
+	return p.querySource(ctx, req, nil)
+}
+
+// querySource sends the request to given source or to the current source if source is nil.
+// It returns the unmarshaled result and any error encountered.
+func (p *Peer) querySource(ctx context.Context, req *Request, forceSource *PeerSource) (ResultSet, *ResultMetaData, error) {
 	p.cache.maxParallelConnections <- true // wait/reserve one connection slot, channel will block if full
 	var conn net.Conn
 	var connType ConnectionType
+	var source *PeerSource
 	var err error
 	defer func() {
 		switch {
@@ -1002,16 +1055,25 @@ func (p *Peer) query(ctx context.Context, req *Request) (ResultSet, *ResultMetaD
 
 	logWith(p, req).Tracef("connection #%02d of max. %02d", len(p.cache.maxParallelConnections), p.lmd.Config.MaxParallelPeerConnections)
 
-	conn, connType, err = p.GetConnection(req)
+	if forceSource != nil {
+		source, conn, connType, err = p.getSourceConnection(forceSource)
+	} else {
+		source, conn, connType, err = p.getConnectionSource(req)
+	}
 	if err != nil {
 		logWith(p, req).Tracef("query: %s", req.String())
 		logWith(p, req).Debugf("connection failed: %s", err)
 
 		return nil, nil, err
 	}
-	if connType == ConnTypeHTTP {
+	// balanced connections are not pooled, since the pool does not know about sources
+	if connType == ConnTypeHTTP || p.isBalanced() || forceSource != nil {
 		req.KeepAlive = false
 	}
+	if source != nil {
+		source.active.Add(1)
+		defer source.active.Add(-1)
+	}
 	query := req.String()
 	if log.IsV(LogVerbosityTrace) {
 		logWith(p, req).Tracef("query: %s", query)
@@ -1026,6 +1088,12 @@ func (p *Peer) query(ctx context.Context, req *Request) (ResultSet, *ResultMetaD
 	p.BytesSend += int64(len(query))
 	totalBytesSend := p.BytesSend
 	peerAddr := p.PeerAddr
+	if source != nil {
+		peerAddr = source.Addr
+	}
+	if source != nil && forceSource == nil {
+		p.PeerAddr = source.Addr
+	}
 	p.lock.Unlock()
 	promPeerBytesSend.WithLabelValues(p.Name).Set(float64(totalBytesSend))
 	promPeerQueries.WithLabelValues(p.Name).Inc()
@@ -1035,9 +1103,15 @@ func (p *Peer) query(ctx context.Context, req *Request) (ResultSet, *ResultMetaD
 	duration := time.Since(t1)
 	if err != nil {
 		logWith(p, req).Debugf("backend query failed: %w", err)
+		var peerErr *PeerError
+		var peerCmdErr *PeerCommandError
+		if !errors.As(err, &peerCmdErr) && (!errors.As(err, &peerErr) || peerErr.kind != ResponseError) {
+			p.setSourceStatus(source, err)
+		}
 
 		return nil, nil, err
 	}
+	p.setSourceStatus(source, nil)
 	if newConn != nil {
 		conn = newConn
 	}
@@ -1096,7 +1170,7 @@ func (p *Peer) getQueryResponse(ctx context.Context, req *Request, query, peerAd
 		return p.getHTTPQueryResponse(ctx, req, query, peerAddr)
 	}
 
-	return p.getSocketQueryResponseWithTemporaryRetries(req, query, conn)
+	return p.getSocketQueryResponseWithTemporaryRetries(req, query, peerAddr, conn)
 }
 
 func (p *Peer) getHTTPQueryResponse(ctx context.Context, req *Request, query, peerAddr string) ([]byte, net.Conn, error) {
@@ -1144,7 +1218,7 @@ func (p *Peer) getSocketQueryResponse(req *Request, query string, conn net.Conn)
 	return b, err
 }
 
-func (p *Peer) getSocketQueryResponseWithTemporaryRetries(req *Request, query string, conn net.Conn) ([]byte, net.Conn, error) {
+func (p *Peer) getSocketQueryResponseWithTemporaryRetries(req *Request, query, rawAddr string, conn net.Conn) ([]byte, net.Conn, error) {
 	// catch temporary errors
 	retries := 0
 	for {
@@ -1163,7 +1237,7 @@ func (p *Peer) getSocketQueryResponseWithTemporaryRetries(req *Request, query st
 		if retries > 1 {
 			time.Sleep(TemporaryNetworkErrorRetryDelay * time.Duration(retries-1))
 		}
-		peerAddr, connType := extractConnType(p.statusGetLocked(PeerAddr).(string)) //nolint:forcetypeassert // peerAddr is always a string
+		peerAddr, connType := extractConnType(rawAddr)
 		conn.Close()
 		var oErr error
 		conn, oErr = p.openConnection(peerAddr, connType)
@@ -1417,6 +1491,27 @@ func (p *Peer) validateResponseHeader(resBytes []byte, req *Request, code int, e
 // return anything.
 // It returns the connection object and any error encountered.
 func (p *Peer) GetConnection(req *Request) (conn net.Conn, connType ConnectionType, err error) {
+	_, conn, connType, err = p.getConnectionSource(req)
+
+	return conn, connType, err
+}
+
+// getConnectionSource returns the next connection along with the source it belongs to.
+func (p *Peer) getConnectionSource(req *Request) (source *PeerSource, conn net.Conn, connType ConnectionType, err error) {
+	if p.isBalanced() {
+		return p.getBalancedConnection(req)
+	}
+
+	conn, connType, err = p.getFailoverConnection(req)
+	if err == nil {
+		source = p.getSource(interface2stringNoDedup(p.statusGetLocked(PeerAddr)))
+	}
+
+	return source, conn, connType, err
+}
+
+// getFailoverConnection returns a connection to the current source and fails over to the next one on errors.
+func (p *Peer) getFailoverConnection(req *Request) (conn net.Conn, connType ConnectionType, err error) {
 	// try primary sources first
 	conn, connType, err = p.tryConnection(req, p.Source)
 	if err == nil {
@@ -1465,6 +1560,7 @@ func (p *Peer) tryConnection(req *Request, source []string) (conn net.Conn, conn
 		}
 
 		// connection error
+		p.setSourceStatus(p.getSource(interface2stringNoDedup(p.statusGetLocked(PeerAddr))), err)
 		p.setNextAddrFromErr(err, req, source)
 	}
 
@@ -1573,6 +1669,11 @@ func (p *Peer) setNextAddrFromErr(err error, req *Request, source []string) {
 		logContext = append(logContext, req)
 	}
 	logWith(logContext...).Debugf("connection error %s: %s", p.PeerAddr, err)
+
+	// the next query will use one of the remaining healthy sources
+	if p.isBalanced() && p.hasHealthySourceLocked() {
+		return
+	}
 	p.LastError = strings.TrimSpace(err.Error())
 	p.ErrorCount++
 
@@ -1959,29 +2060,12 @@ func (p *Peer) waitcondition(ctx context.Context, waitChan chan struct{}, req *R
 		}
 
 		// get object to watch
-		found := false
-		if req.WaitObject != "" {
-			obj, ok := store.GetWaitObject(req)
-			if !ok {
-				logWith(p, req).Warnf("WaitObject did not match any object: %s", req.WaitObject)
-				safeCloseWaitChannel(waitChan)
-
-				return nil
-			}
-
-			found = true
-			for i := range req.WaitCondition {
-				if !obj.MatchFilter(req.WaitCondition[i], false) {
-					found = false
-				}
-			}
-		} else if p.waitConditionTableMatches(store, req.WaitCondition) {
-			found = true
-		}
+		found, ok := p.waitConditionMatches(store, req)
+		if !ok {
+			logWith(p, req).Warnf("WaitObject did not match any object: %s", req.WaitObject)
+			safeCloseWaitChannel(waitChan)
 
-		// invert wait condition logic
-		if req.WaitConditionNegate {
-			found = !found
+			return nil
 		}
 
 		if found {
@@ -2298,8 +2382,23 @@ func ExtractHTTPResponse(response *http.Response) (contents []byte, err error) {
 // PassThroughQuery runs a passthrough query on a single peer and appends the result.
 func (p *Peer) PassThroughQuery(ctx context.Context, res *Response, passthroughRequest *Request, virtualColumns []*Column, columnsIndex map[*Column]int) {
 	req := res.Request
+
+	// some backends do not support AuthUser for the log table, filter those locally
+	queryRequest := passthroughRequest
+	authFilter := passthroughRequest.AuthUser != "" && passthroughRequest.Table == TableLog && !p.supportsLogAuthUser()
+	if authFilter {
+		if len(passthroughRequest.Stats) > 0 {
+			res.Lock.Lock()
+			res.Failed[p.ID] = "backend does not support stats queries on the log table with AuthUser"
+			res.Lock.Unlock()
+
+			return
+		}
+		queryRequest = localAuthRequest(passthroughRequest)
+	}
+
 	// do not use Query here, might be a log query with log
-	result, _, queryErr := p.query(ctx, passthroughRequest)
+	result, queryErr := p.queryPassthrough(ctx, queryRequest)
 	logWith(p, req).Tracef("req done")
 	if queryErr != nil {
 		var peerErr *PeerError
@@ -2314,6 +2413,9 @@ func (p *Peer) PassThroughQuery(ctx context.Context, res *Response, passthroughR
 
 		return
 	}
+	if authFilter {
+		result = p.filterLogAuth(result, passthroughRequest)
+	}
 	// insert virtual values, like peer_addr or name
 	if len(virtualColumns) > 0 {
 		table := Objects.Tables[res.Request.Table]
@@ -2331,6 +2433,7 @@ func (p *Peer) PassThroughQuery(ctx context.Context, res *Response, passthroughR
 			result[rowNum] = *row
 		}
 	}
+	redactResultSet(result, req)
 	logWith(p, req).Tracef("result ready")
 	res.Lock.Lock()
 	if len(req.Stats) == 0 {
@@ -2413,6 +2516,44 @@ func (p *Peer) getError() string {
 	return fmt.Sprintf("%v", p.statusGetLocked(LastError))
 }
 
+// WaitConditionMet returns true if the wait condition of the request matches the current data.
+func (p *Peer) WaitConditionMet(req *Request) bool {
+	store, err := p.GetDataStore(req.Table)
+	if err != nil {
+		return false
+	}
+	found, ok := p.waitConditionMatches(store, req)
+
+	return found && ok
+}
+
+// waitConditionMatches returns true if the wait object, or any object if no wait object is set, matches the wait condition.
+// It returns false for ok if the wait object does not exist.
+func (p *Peer) waitConditionMatches(store *DataStore, req *Request) (found, ok bool) {
+	if req.WaitObject != "" {
+		obj, exists := store.GetWaitObject(req)
+		if !exists {
+			return false, false
+		}
+
+		found = true
+		for i := range req.WaitCondition {
+			if !obj.MatchFilter(req.WaitCondition[i], false) {
+				found = false
+			}
+		}
+	} else {
+		found = p.waitConditionTableMatches(store, req.WaitCondition)
+	}
+
+	// invert wait condition logic
+	if req.WaitConditionNegate {
+		found = !found
+	}
+
+	return found, true
+}
+
 func (p *Peer) waitConditionTableMatches(store *DataStore, filter []*Filter) bool {
 Rows:
 	for j := range store.Data {
@@ -2941,6 +3082,7 @@ func (p *Peer) addSubPeer(ctx context.Context, subFlag OptionalFlags, key, subNa
 		TLSCA:          p.Config.TLSCA,
 		TLSSkipVerify:  p.Config.TLSSkipVerify,
 		Auth:           p.Config.Auth,
+		SourceMode:     p.Config.SourceMode,
 	}
 	subPeer = NewPeer(p.lmd, &conn)
 	subPeer.ParentID = p.ID
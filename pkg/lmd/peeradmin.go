@@ -0,0 +1,710 @@
+package lmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/julienschmidt/httprouter"
+)
+
+// available peer administration actions.
+const (
+	PeerAdminAdd    = "add"
+	PeerAdminRemove = "remove"
+	PeerAdminPause  = "pause"
+	PeerAdminResume = "resume"
+	PeerAdminResync = "resync"
+)
+
+// PeerAdminStopTimeout sets the maximum time to wait for the update loop of a peer to stop.
+const PeerAdminStopTimeout = 30 * time.Second
+
+// peerAdminCommands maps the livestatus command extensions to the peer administration actions.
+var peerAdminCommands = map[string]string{
+	"LMD_ADD_PEER":    PeerAdminAdd,    // LMD_ADD_PEER;<id>;<name>;<source>[,<source>...][;<section>]
+	"LMD_REMOVE_PEER": PeerAdminRemove, // LMD_REMOVE_PEER;<id>
+	"LMD_PAUSE_PEER":  PeerAdminPause,  // LMD_PAUSE_PEER;<id>
+	"LMD_RESUME_PEER": PeerAdminResume, // LMD_RESUME_PEER;<id>
+	"LMD_RESYNC_PEER": PeerAdminResync, // LMD_RESYNC_PEER;<id>
+}
+
+// PeerAdminRequest contains a runtime peer administration action.
+type PeerAdminRequest struct {
+	Connection *Connection `json:"connection,omitempty"` // new connection for add actions
+	Action     string      `json:"action"`
+	ID         string      `json:"id"`
+	AuthUser   string      `json:"authuser,omitempty"`
+	Forwarded  bool        `json:"forwarded,omitempty"` // set by cluster nodes forwarding the action to all other nodes
+}
+
+// PeerAdminResponse contains the result of a peer administration action.
+type PeerAdminResponse struct {
+	Message   string `json:"message"`
+	Code      int    `json:"code"`
+	Persisted bool   `json:"persisted"` // true if the change has been written to the PeerAdminConfig file
+}
+
+// peerAdminFile is the content of the PeerAdminConfig file.
+type peerAdminFile struct {
+	Connections []Connection `toml:"Connections"`
+}
+
+// addPeerAdmin creates a new peer from the connection json in the request body.
+func (c *HTTPServerController) addPeerAdmin(wrt http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	conn := &Connection{}
+	defer request.Body.Close()
+	if err := json.NewDecoder(request.Body).Decode(conn); err != nil {
+		c.errorOutput(fmt.Errorf("request not understood"), wrt)
+
+		return
+	}
+	adminReq := &PeerAdminRequest{
+		Action:     PeerAdminAdd,
+		ID:         conn.ID,
+		Connection: conn,
+		AuthUser:   request.URL.Query().Get("authuser"),
+	}
+	c.sendPeerAdmin(request.Context(), wrt, adminReq)
+}
+
+// removePeerAdmin stops and removes a peer.
+func (c *HTTPServerController) removePeerAdmin(wrt http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	adminReq := &PeerAdminRequest{
+		Action:   PeerAdminRemove,
+		ID:       params.ByName("id"),
+		AuthUser: request.URL.Query().Get("authuser"),
+	}
+	c.sendPeerAdmin(request.Context(), wrt, adminReq)
+}
+
+// actionPeerAdmin pauses, resumes or resyncs a peer.
+func (c *HTTPServerController) actionPeerAdmin(wrt http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	action := params.ByName("action")
+	switch action {
+	case PeerAdminPause, PeerAdminResume, PeerAdminResync:
+	default:
+		httpErrorOutput(fmt.Errorf("unknown action: %s", action), wrt, http.StatusNotFound)
+
+		return
+	}
+	adminReq := &PeerAdminRequest{
+		Action:   action,
+		ID:       params.ByName("id"),
+		AuthUser: request.URL.Query().Get("authuser"),
+	}
+	c.sendPeerAdmin(request.Context(), wrt, adminReq)
+}
+
+// queryPeerAdmin handles peer administration actions forwarded by other cluster nodes.
+// Only requests authenticated with the NodeToken may mark the action as forwarded.
+func (c *HTTPServerController) queryPeerAdmin(ctx context.Context, wrt http.ResponseWriter, requestData map[string]interface{}) {
+	adminReq := &PeerAdminRequest{}
+	raw, err := json.Marshal(requestData)
+	if err == nil {
+		err = json.Unmarshal(raw, adminReq)
+	}
+	if err != nil {
+		c.errorOutput(fmt.Errorf("request not understood"), wrt)
+
+		return
+	}
+	if adminReq.Forwarded && !isNodeHTTPAuth(ctx) {
+		log.Warnf("rejected forwarded peer %s: request not authenticated by NodeToken", adminReq.Action)
+		httpErrorOutput(fmt.Errorf("forbidden: forwarded peer administration requires the NodeToken"), wrt, http.StatusForbidden)
+
+		return
+	}
+	c.sendPeerAdmin(ctx, wrt, adminReq)
+}
+
+// sendPeerAdmin runs the peer administration request and sends the response.
+// Forwarded requests always get status 200, so the forwarding node can report the result per node.
+func (c *HTTPServerController) sendPeerAdmin(ctx context.Context, wrt http.ResponseWriter, adminReq *PeerAdminRequest) {
+	res := c.lmd.executeHTTPPeerAdmin(ctx, adminReq)
+	wrt.Header().Set("Content-Type", "application/json")
+	if res.Code == ReturnCodeTooManyRequests {
+		wrt.Header().Set("Retry-After", "1")
+	}
+	if adminReq.Forwarded {
+		wrt.WriteHeader(http.StatusOK)
+	} else {
+		wrt.WriteHeader(res.Code)
+	}
+	restWriteJSON(wrt, res)
+}
+
+// executeHTTPPeerAdmin applies the token and client certificate authentication and runs the peer administration request.
+func (lmd *Daemon) executeHTTPPeerAdmin(ctx context.Context, adminReq *PeerAdminRequest) *PeerAdminResponse {
+	remoteAddr, _ := ctx.Value(CtxRemoteAddr).(string)
+	listen, _ := ctx.Value(CtxListener).(string)
+
+	line, err := adminReq.commandLine()
+	if err != nil {
+		return &PeerAdminResponse{Code: ReturnCodeBadRequest, Message: err.Error()}
+	}
+	req := &Request{lmd: lmd, Command: line, AuthUser: adminReq.AuthUser}
+	if err = applyHTTPAuth(ctx, lmd, req); err != nil {
+		return &PeerAdminResponse{Code: ReturnCodeBadRequest, Message: err.Error()}
+	}
+	adminReq.AuthUser = req.AuthUser
+
+	return lmd.executePeerAdmin(ctx, adminReq, req, remoteAddr, listen)
+}
+
+// executePeerAdmin authorizes and applies the peer administration action, stores it in the PeerAdminConfig file
+// and forwards it to all other cluster nodes. The request contains the action as command line and is used
+// to check the command allow lists of the listener and the ACL.
+func (lmd *Daemon) executePeerAdmin(ctx context.Context, adminReq *PeerAdminRequest, req *Request, remoteAddr, listen string) (res *PeerAdminResponse) {
+	entry := &AuditEntry{
+		Time:     time.Now(),
+		Action:   AuditActionPeer,
+		Client:   remoteAddr,
+		AuthUser: req.AuthUser,
+		Peers:    []string{adminReq.ID},
+		Command:  strings.TrimSpace(req.Command),
+	}
+	defer func() {
+		entry.Code = res.Code
+		entry.Message = res.Message
+		entry.Duration = time.Since(entry.Time).Seconds()
+		lmd.audit(entry)
+	}()
+
+	if !lmd.Config.PeerAdmin {
+		log.Warnf("rejected peer %s from %s: peer administration is disabled", adminReq.Action, remoteAddr)
+
+		return &PeerAdminResponse{Code: ReturnCodeForbidden, Message: "peer administration is disabled, see PeerAdmin"}
+	}
+
+	release, err := lmd.admitRequest(remoteAddr, req.AuthUser, listen)
+	if err != nil {
+		log.Warnf("rejected peer %s from %s: %s", adminReq.Action, remoteAddr, err.Error())
+
+		return &PeerAdminResponse{Code: ReturnCodeTooManyRequests, Message: err.Error()}
+	}
+	defer release()
+
+	if _, err = lmd.checkCommandAllowed(req, listen); err != nil {
+		log.Warnf("rejected peer %s from %s: %s", adminReq.Action, remoteAddr, err.Error())
+		var commandErr *CommandError
+		if errors.As(err, &commandErr) {
+			return &PeerAdminResponse{Code: commandErr.code, Message: err.Error()}
+		}
+
+		return &PeerAdminResponse{Code: ReturnCodeInternalError, Message: err.Error()}
+	}
+
+	// peers must be started with a context which outlives the admin request
+	ctx = context.WithoutCancel(ctx)
+
+	lmd.peerAdminLock.Lock()
+	conn, code, err := lmd.applyPeerAdmin(ctx, adminReq)
+	res = &PeerAdminResponse{Code: code}
+	if err != nil {
+		res.Message = err.Error()
+	} else {
+		res.Message = fmt.Sprintf("peer %s: %s successful", adminReq.ID, adminReq.Action)
+		res.Persisted, err = lmd.persistPeerAdmin(adminReq, conn)
+		if err != nil {
+			log.Errorf("failed to persist peer %s: %s", adminReq.Action, err.Error())
+			res.Code = ReturnCodeInternalError
+			res.Message = fmt.Sprintf("peer %s: %s successful, but persisting failed: %s", adminReq.ID, adminReq.Action, err.Error())
+		}
+	}
+	lmd.peerAdminLock.Unlock()
+
+	if res.Code != ReturnCodeOK || adminReq.Forwarded {
+		return res
+	}
+	log.Infof("peer %s: %s by %s", adminReq.ID, adminReq.Action, remoteAddr)
+
+	if err := lmd.forwardPeerAdmin(ctx, adminReq); err != nil {
+		res.Code = ReturnCodeConnectionError
+		res.Message = fmt.Sprintf("%s, but not on all cluster nodes: %s", res.Message, err.Error())
+	}
+
+	return res
+}
+
+// applyPeerAdmin applies the action to the local peers.
+// It returns the connection of the peer along with the status code.
+func (lmd *Daemon) applyPeerAdmin(ctx context.Context, adminReq *PeerAdminRequest) (*Connection, int, error) {
+	if adminReq.Action == PeerAdminAdd {
+		return lmd.addPeer(ctx, adminReq.Connection)
+	}
+
+	lmd.PeerMapLock.RLock()
+	peer := lmd.PeerMap[adminReq.ID]
+	lmd.PeerMapLock.RUnlock()
+	if peer == nil {
+		return nil, ReturnCodeNotFound, fmt.Errorf("not found: no peer with id %s", adminReq.ID)
+	}
+	if peer.ParentID != "" {
+		return nil, ReturnCodeBadRequest, fmt.Errorf("bad request: peer %s is a sub peer of %s", peer.ID, peer.ParentID)
+	}
+
+	var err error
+	code := ReturnCodeOK
+	switch adminReq.Action {
+	case PeerAdminRemove:
+		lmd.removePeer(ctx, peer)
+	case PeerAdminPause:
+		code, err = peer.pause()
+	case PeerAdminResume:
+		code, err = peer.resume(ctx)
+	case PeerAdminResync:
+		code, err = peer.resync(ctx)
+	default:
+		return nil, ReturnCodeBadRequest, fmt.Errorf("bad request: unknown action %s", adminReq.Action)
+	}
+
+	return peer.Config, code, err
+}
+
+// addPeer creates and starts a new peer.
+func (lmd *Daemon) addPeer(ctx context.Context, conn *Connection) (*Connection, int, error) {
+	if conn == nil || conn.ID == "" {
+		return nil, ReturnCodeBadRequest, fmt.Errorf("bad request: peer id is required")
+	}
+	if len(conn.Source) == 0 {
+		return nil, ReturnCodeBadRequest, fmt.Errorf("bad request: peer source is required")
+	}
+	if conn.Name == "" {
+		conn.Name = conn.ID
+	}
+	if _, err := NewSourceMode(conn.SourceMode); err != nil {
+		return nil, ReturnCodeBadRequest, fmt.Errorf("bad request: %w", err)
+	}
+	for i := range conn.Source {
+		if strings.HasPrefix(conn.Source[i], "http") {
+			conn.Source[i] = completePeerHTTPAddr(conn.Source[i])
+		}
+	}
+	for i := range conn.Fallback {
+		if strings.HasPrefix(conn.Fallback[i], "http") {
+			conn.Fallback[i] = completePeerHTTPAddr(conn.Fallback[i])
+		}
+	}
+
+	lmd.PeerMapLock.Lock()
+	if _, ok := lmd.PeerMap[conn.ID]; ok {
+		lmd.PeerMapLock.Unlock()
+
+		return nil, ReturnCodeConflict, fmt.Errorf("peer %s exists already", conn.ID)
+	}
+	peer := NewPeer(lmd, conn)
+	lmd.PeerMap[conn.ID] = peer
+	lmd.PeerMapOrder = append(lmd.PeerMapOrder, conn.ID)
+	lmd.PeerMapLock.Unlock()
+
+	if conn.Paused {
+		peer.setAdminPaused()
+	}
+	lmd.nodeAccessor.addBackend(ctx, peer)
+
+	return conn, ReturnCodeOK, nil
+}
+
+// removePeer stops the peer and removes it along with its sub peers.
+func (lmd *Daemon) removePeer(ctx context.Context, peer *Peer) {
+	lmd.nodeAccessor.removeBackend(ctx, peer.ID)
+	if err := peer.stopAndWait(PeerAdminStopTimeout); err != nil {
+		logWith(peer).Warnf("%s, removing it anyway", err.Error())
+	}
+	peer.removeSubPeers()
+
+	lmd.PeerMapLock.Lock()
+	peer.ClearData(true)
+	lmd.PeerMapRemove(peer.ID)
+	lmd.PeerMapLock.Unlock()
+}
+
+// pause stops the peer until it is resumed.
+func (p *Peer) pause() (int, error) {
+	p.lock.Lock()
+	if p.Config.Paused {
+		p.lock.Unlock()
+
+		return ReturnCodeConflict, fmt.Errorf("peer %s is paused already", p.ID)
+	}
+	p.Config.Paused = true
+	p.lock.Unlock()
+
+	if err := p.stopAndWait(PeerAdminStopTimeout); err != nil {
+		return ReturnCodeInternalError, err
+	}
+	p.removeSubPeers()
+	p.setAdminPaused()
+
+	return ReturnCodeOK, nil
+}
+
+// resume starts a paused peer again. In cluster mode, it is started by the node it is assigned to only.
+func (p *Peer) resume(ctx context.Context) (int, error) {
+	p.lock.Lock()
+	if !p.Config.Paused {
+		p.lock.Unlock()
+
+		return ReturnCodeConflict, fmt.Errorf("peer %s is not paused", p.ID)
+	}
+	p.Config.Paused = false
+	p.PeerState = PeerStatusPending
+	p.LastError = "connecting..."
+	p.lock.Unlock()
+
+	if p.lmd.nodeAccessor.IsOurBackend(p.ID) && interface2bool(p.statusGetLocked(Paused)) {
+		p.Start(ctx)
+	}
+
+	return ReturnCodeOK, nil
+}
+
+// resync restarts the update loop of the peer which starts with a full update of all tables.
+// Peers assigned to other cluster nodes are not running and therefore skipped.
+func (p *Peer) resync(ctx context.Context) (int, error) {
+	if p.isAdminPaused() {
+		return ReturnCodeConflict, fmt.Errorf("peer %s is paused", p.ID)
+	}
+	if interface2bool(p.statusGetLocked(Paused)) {
+		return ReturnCodeOK, nil
+	}
+
+	if err := p.stopAndWait(PeerAdminStopTimeout); err != nil {
+		return ReturnCodeInternalError, err
+	}
+	p.Start(ctx)
+
+	return ReturnCodeOK, nil
+}
+
+// isAdminPaused returns true if the peer has been paused by the configuration or the peer administration.
+func (p *Peer) isAdminPaused() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.Config.Paused
+}
+
+// setAdminPaused marks the peer as paused by the peer administration and clears its data.
+func (p *Peer) setAdminPaused() {
+	p.lock.Lock()
+	p.PeerState = PeerStatusDown
+	p.LastError = "paused"
+	p.ClearData(false)
+	p.lock.Unlock()
+}
+
+// stopAndWait stops the peer and waits till its update loop has finished.
+// It returns an error if the update loop is still running after the timeout.
+func (p *Peer) stopAndWait(timeout time.Duration) error {
+	p.Stop()
+	deadline := time.Now().Add(timeout)
+	for !interface2bool(p.statusGetLocked(Paused)) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("peer %s did not stop within %s", p.ID, timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return nil
+}
+
+// removeSubPeers stops and removes all sub peers of this peer.
+func (p *Peer) removeSubPeers() {
+	p.lmd.PeerMapLock.Lock()
+	defer p.lmd.PeerMapLock.Unlock()
+	for peerKey := range p.lmd.PeerMap {
+		peer := p.lmd.PeerMap[peerKey]
+		if peer.ParentID == p.ID {
+			logWith(peer).Debugf("removing sub peer")
+			peer.Stop()
+			peer.ClearData(true)
+			p.lmd.PeerMapRemove(peerKey)
+		}
+	}
+}
+
+// processPeerAdmin runs a LMD_* peer administration command from a livestatus client. All pending
+// commands are sent before, so commands are applied in order. Failed actions are reported to the client
+// and end the processing of further requests. It returns true if the action was successful.
+func (cl *ClientConnection) processPeerAdmin(ctx context.Context, req *Request, adminReq *PeerAdminRequest, parseErr error, commandsByPeer *map[string][]string, auditEntries *[]*AuditEntry) (ok bool, err error) {
+	err = cl.sendRemainingCommands(ctx, commandsByPeer, auditEntries)
+	if err != nil {
+		return false, err
+	}
+
+	res := &PeerAdminResponse{Code: ReturnCodeBadRequest}
+	if parseErr != nil {
+		res.Message = parseErr.Error()
+		logWith(ctx).Warnf("rejected command from %s: %s", cl.remoteAddr, res.Message)
+	} else {
+		res = cl.lmd.executePeerAdmin(ctx, adminReq, req, cl.remoteAddr, cl.listen)
+	}
+	if res.Code == ReturnCodeOK {
+		return true, nil
+	}
+	_, err = fmt.Fprintf(cl.connection, "%d: %s\n", res.Code, res.Message)
+	if err != nil {
+		return false, fmt.Errorf("write: %w", err)
+	}
+
+	return false, nil
+}
+
+// forwardPeerAdmin sends the action to all other online cluster nodes, which then redistribute their backends.
+func (lmd *Daemon) forwardPeerAdmin(ctx context.Context, adminReq *PeerAdminRequest) error {
+	nodes := lmd.nodeAccessor
+	if !nodes.IsClustered() {
+		return nil
+	}
+
+	forward := *adminReq
+	forward.Forwarded = true
+	parameters := make(map[string]interface{})
+	raw, err := json.Marshal(&forward)
+	if err == nil {
+		err = json.Unmarshal(raw, &parameters)
+	}
+	if err != nil {
+		return fmt.Errorf("json: %w", err)
+	}
+
+	var failed []string
+	lock := new(sync.Mutex)
+	wgroup := &sync.WaitGroup{}
+	for _, node := range nodes.onlineNodes {
+		if node.isMe {
+			continue
+		}
+		wgroup.Add(1)
+		go func(node *NodeAddress) {
+			defer lmd.logPanicExit()
+			defer wgroup.Done()
+			err := lmd.sendPeerAdminNode(ctx, node, parameters)
+			if err != nil {
+				lock.Lock()
+				failed = append(failed, fmt.Sprintf("%s: %s", node, err.Error()))
+				lock.Unlock()
+			}
+		}(node)
+	}
+	wgroup.Wait()
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+
+		return errors.New(strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// sendPeerAdminNode sends the forwarded action to a single cluster node.
+// Conflicts are ignored, the node is in the requested state already.
+func (lmd *Daemon) sendPeerAdminNode(ctx context.Context, node *NodeAddress, parameters map[string]interface{}) error {
+	done := make(chan interface{}, 1)
+	err := lmd.nodeAccessor.SendQuery(ctx, node, "peeradmin", parameters, func(data interface{}) {
+		done <- data
+	})
+	if err != nil {
+		return err
+	}
+
+	res := &PeerAdminResponse{}
+	select {
+	case data := <-done:
+		raw, err := json.Marshal(data)
+		if err == nil {
+			err = json.Unmarshal(raw, res)
+		}
+		if err != nil {
+			return fmt.Errorf("json: %w", err)
+		}
+	case <-time.After(time.Duration(lmd.Config.NetTimeout) * time.Second):
+		return fmt.Errorf("timeout while waiting for node response")
+	}
+	if res.Code != ReturnCodeOK && res.Code != ReturnCodeConflict {
+		return errors.New(res.Message)
+	}
+
+	return nil
+}
+
+// isIncludedConfigFile returns true if the file matches any of the config file patterns given with -c.
+// The file itself does not need to exist yet.
+func isIncludedConfigFile(file string, patterns []string) bool {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range patterns {
+		pattern, err = filepath.Abs(pattern)
+		if err != nil {
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, file); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// persistPeerAdmin stores the change in the PeerAdminConfig file if configured. Connections from other config
+// files cannot be changed, so removing or pausing them is not persisted. It returns true if the file was changed.
+func (lmd *Daemon) persistPeerAdmin(adminReq *PeerAdminRequest, conn *Connection) (bool, error) {
+	file := lmd.Config.PeerAdminConfig
+	if file == "" || adminReq.Action == PeerAdminResync {
+		return false, nil
+	}
+
+	conf := &peerAdminFile{}
+	if _, err := os.Stat(file); err == nil {
+		meta, err := toml.DecodeFile(file, conf)
+		if err != nil {
+			return false, fmt.Errorf("peer admin config %s: %w", file, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return false, fmt.Errorf("peer admin config %s must contain connections only, found: %s", file, undecoded[0].String())
+		}
+	}
+
+	idx := slices.IndexFunc(conf.Connections, func(c Connection) bool { return c.ID == adminReq.ID })
+	switch adminReq.Action {
+	case PeerAdminAdd:
+		if idx >= 0 {
+			conf.Connections[idx] = *conn
+		} else {
+			conf.Connections = append(conf.Connections, *conn)
+		}
+	case PeerAdminRemove:
+		if idx < 0 {
+			return false, nil
+		}
+		conf.Connections = slices.Delete(conf.Connections, idx, idx+1)
+	case PeerAdminPause, PeerAdminResume:
+		if idx < 0 {
+			return false, nil
+		}
+		conf.Connections[idx].Paused = adminReq.Action == PeerAdminPause
+	}
+
+	return true, writePeerAdminFile(file, conf)
+}
+
+// writePeerAdminFile replaces the PeerAdminConfig file atomically.
+func writePeerAdminFile(file string, conf *peerAdminFile) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("peer admin config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = fmt.Fprintf(tmp, "# connections managed by the lmd peer administration, manual changes will be overwritten\n\n")
+	if err == nil {
+		err = toml.NewEncoder(tmp).Encode(conf)
+	}
+	if err == nil {
+		err = tmp.Chmod(DefaultFilePerm)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		return fmt.Errorf("peer admin config %s: %w", file, err)
+	}
+
+	return nil
+}
+
+// commandLine returns the livestatus command line for this action.
+func (adminReq *PeerAdminRequest) commandLine() (string, error) {
+	name := ""
+	for cmdName, action := range peerAdminCommands {
+		if action == adminReq.Action {
+			name = cmdName
+		}
+	}
+	if name == "" {
+		return "", fmt.Errorf("bad request: unknown action %s", adminReq.Action)
+	}
+	if adminReq.Action == PeerAdminAdd && adminReq.Connection == nil {
+		return "", fmt.Errorf("bad request: connection is required")
+	}
+
+	fields := []string{name, adminReq.ID}
+	if adminReq.Action == PeerAdminAdd {
+		conn := adminReq.Connection
+		fields = append(fields, conn.Name, strings.Join(conn.Source, ","))
+		if conn.Section != "" {
+			fields = append(fields, conn.Section)
+		}
+	}
+	for _, field := range fields {
+		if strings.ContainsAny(field, ";\r\n") {
+			return "", fmt.Errorf("bad request: invalid character in %s", field)
+		}
+	}
+
+	return fmt.Sprintf("COMMAND [%d] %s", time.Now().Unix(), strings.Join(fields, ";")), nil
+}
+
+// parseRequestPeerAdmin returns the peer administration action if the command of the request is a LMD_* command.
+func parseRequestPeerAdmin(req *Request) (*PeerAdminRequest, error) {
+	cmd, err := ParseExternalCommand(req.Command)
+	if err != nil {
+		// invalid commands are rejected by the regular command authorization
+		return nil, nil
+	}
+
+	return parsePeerAdminCommand(cmd)
+}
+
+// parsePeerAdminCommand returns the peer administration action for LMD_* livestatus commands.
+// It returns nil if the command is no peer administration command.
+func parsePeerAdminCommand(cmd *ExternalCommand) (*PeerAdminRequest, error) {
+	action, ok := peerAdminCommands[cmd.Name]
+	if !ok {
+		return nil, nil
+	}
+
+	adminReq := &PeerAdminRequest{Action: action}
+	if len(cmd.Args) > 0 {
+		adminReq.ID = cmd.Args[0]
+	}
+	if action != PeerAdminAdd {
+		if len(cmd.Args) != 1 || adminReq.ID == "" {
+			return nil, fmt.Errorf("bad request: usage: %s;<id>", cmd.Name)
+		}
+
+		return adminReq, nil
+	}
+
+	if len(cmd.Args) < 3 || len(cmd.Args) > 4 || adminReq.ID == "" || cmd.Args[2] == "" {
+		return nil, fmt.Errorf("bad request: usage: %s;<id>;<name>;<source>[,<source>...][;<section>]", cmd.Name)
+	}
+	adminReq.Connection = &Connection{
+		ID:     adminReq.ID,
+		Name:   cmd.Args[1],
+		Source: strings.Split(cmd.Args[2], ","),
+	}
+	if len(cmd.Args) > 3 {
+		adminReq.Connection.Section = cmd.Args[3]
+	}
+
+	return adminReq, nil
+}
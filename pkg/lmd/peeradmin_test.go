@@ -0,0 +1,222 @@
+package lmd
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerAdminHTTP(t *testing.T) {
+	_, cleanup, mocklmd, client := StartTestHTTPPeer(t, 2, 10, 10, "")
+
+	configFile := filepath.Join(t.TempDir(), "peers.ini")
+	mocklmd.Config.PeerAdminConfig = configFile
+
+	send := func(method, path, body string) (int, *PeerAdminResponse) {
+		res := &PeerAdminResponse{}
+		recorder := client.SendJSON(method, path, body, res)
+
+		return recorder.Code, res
+	}
+
+	// peer administration is disabled by default
+	code, _ := send(http.MethodPost, "/admin/peers/mockid1/pause", "")
+	require.Equal(t, http.StatusForbidden, code)
+	mocklmd.Config.PeerAdmin = true
+	getPeer := func(peerKey string) *Peer {
+		mocklmd.PeerMapLock.RLock()
+		defer mocklmd.PeerMapLock.RUnlock()
+
+		return mocklmd.PeerMap[peerKey]
+	}
+	waitUp := func(peerKey string) {
+		require.Eventuallyf(t, func() bool {
+			return getPeer(peerKey).hasPeerState([]PeerStatus{PeerStatusUp})
+		}, 10*time.Second, 20*time.Millisecond, "peer %s never came up", peerKey)
+	}
+
+	// pause and resume peers from the config file
+	code, res := send(http.MethodPost, "/admin/peers/mockid1/pause", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.False(t, res.Persisted)
+	assert.True(t, interface2bool(getPeer("mockid1").statusGetLocked(Paused)))
+	assert.True(t, getPeer("mockid1").hasPeerState([]PeerStatus{PeerStatusDown}))
+
+	code, _ = send(http.MethodPost, "/admin/peers/mockid1/pause", "")
+	assert.Equal(t, http.StatusConflict, code)
+	code, _ = send(http.MethodPost, "/admin/peers/mockid1/resync", "")
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, _ = send(http.MethodPost, "/admin/peers/mockid1/resume", "")
+	require.Equal(t, http.StatusOK, code)
+	waitUp("mockid1")
+
+	code, _ = send(http.MethodPost, "/admin/peers/mockid0/resync", "")
+	require.Equal(t, http.StatusOK, code)
+	waitUp("mockid0")
+
+	// add new peer
+	source := getPeer("mockid0").Source[0]
+	code, res = send(http.MethodPost, "/admin/peers", `{"id":"mockid9","source":["`+source+`"]}`)
+	require.Equalf(t, http.StatusOK, code, "add peer: %s", res.Message)
+	assert.True(t, res.Persisted)
+	assert.Equal(t, "mockid9", getPeer("mockid9").Name)
+	waitUp("mockid9")
+
+	code, _ = send(http.MethodPost, "/admin/peers", `{"id":"mockid9","source":["`+source+`"]}`)
+	assert.Equal(t, http.StatusConflict, code)
+	code, _ = send(http.MethodPost, "/admin/peers", `{"id":"mockid8"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, res = send(http.MethodPost, "/admin/peers/mockid9/pause", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, res.Persisted)
+	conf := NewConfig([]string{configFile})
+	require.Len(t, conf.Connections, 1)
+	assert.Equal(t, "mockid9", conf.Connections[0].ID)
+	assert.True(t, conf.Connections[0].Paused)
+
+	// remove peer
+	code, res = send(http.MethodDelete, "/admin/peers/mockid9", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, res.Persisted)
+	assert.Nil(t, getPeer("mockid9"))
+	assert.NotContains(t, mocklmd.PeerMapOrder, "mockid9")
+	content, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "mockid9")
+
+	code, _ = send(http.MethodDelete, "/admin/peers/mockid9", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// users require the command in their acl
+	code, _ = send(http.MethodPost, "/admin/peers/mockid0/resync?authuser=authuser", "")
+	assert.Equal(t, http.StatusForbidden, code)
+
+	err = cleanup()
+	require.NoError(t, err)
+}
+
+func TestPeerAdminCommand(t *testing.T) {
+	peer, cleanup, mocklmd := StartTestPeer(2, 10, 10)
+	PauseTestPeers(peer)
+
+	// peer administration is disabled by default
+	_, _, err := peer.QueryString("COMMAND [0] LMD_PAUSE_PEER;mockid1\n\n")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "peer administration is disabled")
+	mocklmd.Config.PeerAdmin = true
+
+	_, _, err = peer.QueryString("COMMAND [0] LMD_PAUSE_PEER;mockid1\n\n")
+	require.NoError(t, err)
+	mocklmd.PeerMapLock.RLock()
+	paused := mocklmd.PeerMap["mockid1"]
+	mocklmd.PeerMapLock.RUnlock()
+	assert.True(t, paused.isAdminPaused())
+
+	_, _, err = peer.QueryString("COMMAND [0] LMD_PAUSE_PEER;mockid1\n\n")
+	require.Error(t, err)
+	_, _, err = peer.QueryString("COMMAND [0] LMD_PAUSE_PEER\n\n")
+	require.Error(t, err)
+
+	_, _, err = peer.QueryString("COMMAND [0] LMD_RESUME_PEER;mockid1\n\n")
+	require.NoError(t, err)
+	assert.False(t, paused.isAdminPaused())
+
+	err = cleanup()
+	require.NoError(t, err)
+}
+
+func TestPeerAdminForwarded(t *testing.T) {
+	_, cleanup, mocklmd, client := StartTestHTTPPeer(t, 2, 10, 10, "")
+
+	mocklmd.Config.PeerAdmin = true
+	// the NodeToken is accepted without any api tokens
+	mocklmd.Config.NodeToken = "node-secret"
+
+	send := func(token, body string) int {
+		return client.Send(http.MethodPost, "/query", body, "Content-Type: application/json", "Authorization: Bearer "+token).Code
+	}
+	isPaused := func() bool {
+		mocklmd.PeerMapLock.RLock()
+		defer mocklmd.PeerMapLock.RUnlock()
+
+		return mocklmd.PeerMap["mockid1"].isAdminPaused()
+	}
+
+	// ordinary clients cannot mark actions as forwarded
+	forwarded := `{"_name":"peeradmin","action":"pause","id":"mockid1","forwarded":true}`
+	assert.Equal(t, http.StatusForbidden, send("client-secret", forwarded))
+	assert.False(t, isPaused())
+
+	assert.Equal(t, http.StatusOK, send("node-secret", forwarded))
+	assert.True(t, isPaused())
+
+	// without forwarded flag, the action is a regular request
+	assert.Equal(t, http.StatusOK, send("client-secret", `{"_name":"peeradmin","action":"resume","id":"mockid1"}`))
+	assert.False(t, isPaused())
+
+	err := cleanup()
+	require.NoError(t, err)
+}
+
+func TestPeerAdminStopTimeout(t *testing.T) {
+	peer, cleanup, _ := StartTestPeer(1, 2, 2)
+	PauseTestPeers(peer)
+
+	require.NoError(t, peer.stopAndWait(time.Second))
+
+	// update loop which receives the stop signal but does not finish
+	peer.statusSetLocked(Paused, false)
+	go func() { <-peer.stopChannel }()
+	require.ErrorContains(t, peer.stopAndWait(50*time.Millisecond), "did not stop within 50ms")
+	peer.statusSetLocked(Paused, true)
+
+	err := cleanup()
+	require.NoError(t, err)
+}
+
+func TestPeerAdminConfigIncluded(t *testing.T) {
+	assert.True(t, isIncludedConfigFile("lmd.ini.d/peers.ini", []string{"lmd.ini", "lmd.ini.d/*.ini"}))
+	assert.True(t, isIncludedConfigFile("./peers.ini", []string{"peers.ini"}))
+	assert.False(t, isIncludedConfigFile("peers.ini", []string{"lmd.ini", "lmd.ini.d/*.ini"}))
+	assert.False(t, isIncludedConfigFile("peers.ini", nil))
+}
+
+func TestPeerAdminParseCommand(t *testing.T) {
+	parse := func(line string) (*PeerAdminRequest, error) {
+		cmd, err := ParseExternalCommand(line)
+		require.NoError(t, err)
+
+		return parsePeerAdminCommand(cmd)
+	}
+
+	adminReq, err := parse("COMMAND [0] LMD_ADD_PEER;site1;Site 1;10.0.0.1:6557,10.0.0.2:6557;eu")
+	require.NoError(t, err)
+	assert.Equal(t, PeerAdminAdd, adminReq.Action)
+	assert.Equal(t, &Connection{ID: "site1", Name: "Site 1", Source: []string{"10.0.0.1:6557", "10.0.0.2:6557"}, Section: "eu"}, adminReq.Connection)
+
+	adminReq, err = parse("COMMAND [0] lmd_resync_peer;site1")
+	require.NoError(t, err)
+	assert.Equal(t, &PeerAdminRequest{Action: PeerAdminResync, ID: "site1"}, adminReq)
+
+	_, err = parse("COMMAND [0] LMD_ADD_PEER;site1;Site 1")
+	require.Error(t, err)
+	_, err = parse("COMMAND [0] LMD_REMOVE_PEER;site1;site2")
+	require.Error(t, err)
+
+	adminReq, err = parse("COMMAND [0] DISABLE_NOTIFICATIONS")
+	require.NoError(t, err)
+	assert.Nil(t, adminReq)
+
+	line, err := (&PeerAdminRequest{Action: PeerAdminPause, ID: "site1"}).commandLine()
+	require.NoError(t, err)
+	assert.Contains(t, line, "] LMD_PAUSE_PEER;site1")
+	_, err = (&PeerAdminRequest{Action: PeerAdminPause, ID: "site;1"}).commandLine()
+	require.Error(t, err)
+}
@@ -0,0 +1,292 @@
+package lmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SourceMode defines how queries are distributed across multiple sources of a connection.
+type SourceMode uint8
+
+const (
+	// SourceModeFailover uses the first working source and switches to the next one on errors.
+	SourceModeFailover SourceMode = iota
+
+	// SourceModeRoundRobin rotates queries through all healthy sources.
+	SourceModeRoundRobin
+
+	// SourceModeLeastConn sends queries to the healthy source with the least active queries.
+	SourceModeLeastConn
+)
+
+// NewSourceMode parses the source_mode connection option.
+func NewSourceMode(str string) (SourceMode, error) {
+	switch strings.ToLower(str) {
+	case "failover", "":
+		return SourceModeFailover, nil
+	case "roundrobin":
+		return SourceModeRoundRobin, nil
+	case "leastconn":
+		return SourceModeLeastConn, nil
+	}
+
+	return SourceModeFailover, fmt.Errorf("unknown source_mode %s, must be one of: failover, roundrobin, leastconn", str)
+}
+
+// String returns the name of the source mode.
+func (m SourceMode) String() string {
+	switch m {
+	case SourceModeFailover:
+		return "failover"
+	case SourceModeRoundRobin:
+		return "roundrobin"
+	case SourceModeLeastConn:
+		return "leastconn"
+	}
+
+	log.Panicf("not implemented")
+
+	return ""
+}
+
+// PeerSource contains the status of a single source address of a peer.
+type PeerSource struct {
+	Addr      string     // connection string, ex.: tls://host:port
+	LastError string     // last error or empty if up
+	Status    PeerStatus // PeerStatusUp, PeerStatusDown or PeerStatusPending if not yet used
+	active    atomic.Int64
+	Fallback  bool // flag wether this is a fallback source
+}
+
+// newPeerSources creates the source list from all primary and fallback addresses.
+func newPeerSources(source, fallback []string) (sources []*PeerSource) {
+	sources = make([]*PeerSource, 0, len(source)+len(fallback))
+	for _, addr := range source {
+		sources = append(sources, &PeerSource{Addr: addr, Status: PeerStatusPending})
+	}
+	for _, addr := range fallback {
+		sources = append(sources, &PeerSource{Addr: addr, Status: PeerStatusPending, Fallback: true})
+	}
+
+	return sources
+}
+
+// isBalanced returns true if queries are spread across all sources.
+func (p *Peer) isBalanced() bool {
+	return p.sourceMode != SourceModeFailover
+}
+
+// getSource returns the source for given address.
+func (p *Peer) getSource(addr string) *PeerSource {
+	for _, source := range p.sources {
+		if source.Addr == addr {
+			return source
+		}
+	}
+
+	return nil
+}
+
+// setSourceStatus updates the status of a source after it has been used.
+func (p *Peer) setSourceStatus(source *PeerSource, err error) {
+	if source == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.setSourceStatusLocked(source, err)
+}
+
+func (p *Peer) setSourceStatusLocked(source *PeerSource, err error) {
+	if err != nil {
+		if source.Status != PeerStatusDown && p.isBalanced() {
+			logWith(p).Infof("source %s went offline: %s", source.Addr, err.Error())
+		}
+		source.Status = PeerStatusDown
+		source.LastError = strings.TrimSpace(err.Error())
+
+		return
+	}
+	if source.Status == PeerStatusDown && p.isBalanced() {
+		logWith(p).Infof("source %s is back online", source.Addr)
+	}
+	source.Status = PeerStatusUp
+	source.LastError = ""
+}
+
+// hasHealthySourceLocked returns true if any source is not known to be down.
+func (p *Peer) hasHealthySourceLocked() bool {
+	for _, source := range p.sources {
+		if source.Status != PeerStatusDown {
+			return true
+		}
+	}
+
+	return false
+}
+
+// balancedSources returns the sources in the order they should be tried according to the source mode.
+// Fallback sources are only used if all primary sources are down. If all sources are down,
+// all of them will be tried.
+func (p *Peer) balancedSources() []*PeerSource {
+	p.lock.RLock()
+	candidates := make([]*PeerSource, 0, len(p.sources))
+	for _, fallback := range []bool{false, true} {
+		for _, source := range p.sources {
+			if source.Fallback == fallback && source.Status != PeerStatusDown {
+				candidates = append(candidates, source)
+			}
+		}
+		if len(candidates) > 0 {
+			break
+		}
+	}
+	p.lock.RUnlock()
+	if len(candidates) == 0 {
+		candidates = append(candidates, p.sources...)
+	}
+
+	switch p.sourceMode {
+	case SourceModeRoundRobin:
+		start := int(p.sourceNext.Add(1) % uint32(len(candidates)))
+		candidates = append(candidates[start:], candidates[:start]...)
+	case SourceModeLeastConn:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].active.Load() < candidates[j].active.Load()
+		})
+	case SourceModeFailover:
+	}
+
+	return candidates
+}
+
+// getBalancedConnection returns a connection to the next healthy source.
+func (p *Peer) getBalancedConnection(req *Request) (source *PeerSource, conn net.Conn, connType ConnectionType, err error) {
+	for _, source = range p.balancedSources() {
+		var peerAddr string
+		peerAddr, connType = extractConnType(source.Addr)
+		p.lock.RLock()
+		isUp := source.Status == PeerStatusUp
+		p.lock.RUnlock()
+		if connType == ConnTypeHTTP && isUp {
+			// http connections will be opened by the http client
+			return source, nil, connType, nil
+		}
+
+		conn, err = p.openConnection(peerAddr, connType)
+		p.setSourceStatus(source, err)
+		if err == nil {
+			promPeerConnections.WithLabelValues(p.Name).Inc()
+
+			return source, conn, connType, nil
+		}
+		logWith(p, req).Debugf("connection to source %s failed: %s", source.Addr, err.Error())
+	}
+
+	return nil, nil, ConnTypeUnix, &PeerError{msg: err.Error(), kind: ConnectionError, srcErr: err}
+}
+
+// getSourceConnection returns a connection to given source without failing over to other sources.
+func (p *Peer) getSourceConnection(source *PeerSource) (*PeerSource, net.Conn, ConnectionType, error) {
+	peerAddr, connType := extractConnType(source.Addr)
+	if connType == ConnTypeHTTP {
+		// http connections will be opened by the http client
+		return source, nil, connType, nil
+	}
+
+	conn, err := p.openConnection(peerAddr, connType)
+	p.setSourceStatus(source, err)
+	if err != nil {
+		return nil, nil, connType, &PeerError{msg: err.Error(), kind: ConnectionError, srcErr: err}
+	}
+	promPeerConnections.WithLabelValues(p.Name).Inc()
+
+	return source, conn, connType, nil
+}
+
+// sourceHealthLoop checks the health of all sources every update interval till the context is done.
+func (p *Peer) sourceHealthLoop(ctx context.Context) {
+	interval := time.Duration(p.lmd.Config.UpdateInterval) * time.Second
+	if interval < UpdateLoopTickerInterval {
+		interval = UpdateLoopTickerInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.checkSourcesHealth(ctx)
+		}
+	}
+}
+
+// checkSourcesHealth runs a connection test on all sources of balanced connections.
+func (p *Peer) checkSourcesHealth(ctx context.Context) {
+	if !p.isBalanced() {
+		return
+	}
+
+	waitGroup := &sync.WaitGroup{}
+	for _, source := range p.sources {
+		waitGroup.Add(1)
+		go func(source *PeerSource) {
+			defer logPanicExitPeer(p)
+			defer waitGroup.Done()
+			peerAddr, connType := extractConnType(source.Addr)
+			conn, err := p.openConnection(peerAddr, connType)
+			if conn != nil {
+				conn.Close()
+			}
+			p.setSourceStatus(source, err)
+		}(source)
+	}
+
+	// health checks are limited by the connect timeout
+	waitTimeout(ctx, waitGroup, time.Duration(p.lmd.Config.ConnectTimeout+1)*time.Second)
+}
+
+// getSourceStatus returns the requested per source attribute. Peer lock must be held.
+func (p *Peer) getSourceStatus(key PeerStatusKey) interface{} {
+	switch key {
+	case SourceAddr:
+		list := make([]string, 0, len(p.sources))
+		for _, source := range p.sources {
+			list = append(list, source.Addr)
+		}
+
+		return list
+	case SourceStatus:
+		list := make([]int64, 0, len(p.sources))
+		for _, source := range p.sources {
+			list = append(list, int64(source.Status))
+		}
+
+		return list
+	case SourceLastError:
+		list := make([]string, 0, len(p.sources))
+		for _, source := range p.sources {
+			list = append(list, source.LastError)
+		}
+
+		return list
+	case SourceActiveQueries:
+		list := make([]int64, 0, len(p.sources))
+		for _, source := range p.sources {
+			list = append(list, source.active.Load())
+		}
+
+		return list
+	default:
+		log.Panicf("unknown source status key: %#v", key)
+	}
+
+	return nil
+}
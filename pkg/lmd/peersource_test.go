@@ -0,0 +1,116 @@
+package lmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceMode(t *testing.T) {
+	for _, str := range []string{"", "failover", "roundrobin", "LeastConn"} {
+		_, err := NewSourceMode(str)
+		require.NoErrorf(t, err, "source mode %s is valid", str)
+	}
+	mode, err := NewSourceMode("random")
+	require.Error(t, err)
+	assert.Equal(t, SourceModeFailover, mode)
+}
+
+func TestSourceBalancing(t *testing.T) {
+	lmd := createTestLMDInstance()
+	peer := NewPeer(lmd, &Connection{
+		Name:       "Test",
+		ID:         "test",
+		Source:     []string{"a.sock", "b.sock"},
+		Fallback:   []string{"c.sock"},
+		SourceMode: "roundrobin",
+	})
+
+	addrs := func(sources []*PeerSource) (list []string) {
+		for _, s := range sources {
+			list = append(list, s.Addr)
+		}
+
+		return list
+	}
+
+	// round robin rotates through primary sources
+	first := addrs(peer.balancedSources())
+	second := addrs(peer.balancedSources())
+	assert.Len(t, first, 2)
+	assert.NotEqual(t, first[0], second[0])
+
+	// fallback is used if all primary sources are down
+	peer.setSourceStatus(peer.sources[0], assert.AnError)
+	peer.setSourceStatus(peer.sources[1], assert.AnError)
+	assert.Equal(t, []string{"c.sock"}, addrs(peer.balancedSources()))
+
+	// least conn prefers idle sources
+	peer.sourceMode = SourceModeLeastConn
+	peer.setSourceStatus(peer.sources[0], nil)
+	peer.setSourceStatus(peer.sources[1], nil)
+	peer.sources[0].active.Add(2)
+	assert.Equal(t, []string{"b.sock", "a.sock"}, addrs(peer.balancedSources()))
+}
+
+func TestSourceBalancingQuery(t *testing.T) {
+	peer, cleanup, mocklmd := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	lmd := createTestLMDInstance()
+	lbPeer := NewPeer(lmd, &Connection{
+		Name:       "Test",
+		ID:         "test",
+		Source:     []string{"doesnotexist.sock", mocklmd.Config.Listen[0]},
+		SourceMode: "roundrobin",
+	})
+
+	for range 3 {
+		res, _, err := lbPeer.QueryString("GET backends\nColumns: peer_key\n\n")
+		require.NoError(t, err)
+		assert.Len(t, res, 1)
+	}
+
+	lbPeer.lock.RLock()
+	status := lbPeer.statusGet(SourceStatus)
+	lbPeer.lock.RUnlock()
+	assert.Equal(t, []int64{int64(PeerStatusDown), int64(PeerStatusUp)}, status)
+
+	err := cleanup()
+	require.NoError(t, err)
+}
+
+func TestSourceHealthLoop(t *testing.T) {
+	lmd := createTestLMDInstance()
+	lmd.Config.UpdateInterval = 0
+	peer := NewPeer(lmd, &Connection{
+		Name:       "Test",
+		ID:         "test",
+		Source:     []string{"doesnotexist.sock", "doesnotexist2.sock"},
+		SourceMode: "roundrobin",
+	})
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	done := make(chan struct{})
+	go func() {
+		peer.sourceHealthLoop(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		peer.lock.RLock()
+		defer peer.lock.RUnlock()
+
+		return peer.sources[0].Status == PeerStatusDown && peer.sources[1].Status == PeerStatusDown
+	}, 5*time.Second, 50*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "health loop did not stop")
+	}
+}
@@ -40,6 +40,11 @@ const (
 	ThrukExtras
 	ForceFull
 	LastHTTPRequestSuccessful
+	PeerSourceMode
+	SourceAddr
+	SourceStatus
+	SourceLastError
+	SourceActiveQueries
 )
 
 // statusSetLocked updates a peer status entry and takes care about the locking.
@@ -129,6 +134,10 @@ func (p *Peer) statusGet(key PeerStatusKey) interface{} {
 		return p.ForceFull
 	case LastHTTPRequestSuccessful:
 		return p.LastHTTPRequestSuccessful
+	case PeerSourceMode:
+		return p.sourceMode.String()
+	case SourceAddr, SourceStatus, SourceLastError, SourceActiveQueries:
+		return p.getSourceStatus(key)
 	}
 
 	log.Panicf("unknown peer status key: %#v", key)
@@ -106,6 +106,15 @@ var (
 		},
 		[]string{"listen"},
 	)
+	promFrontendRejectedRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: NAME,
+			Subsystem: "frontend",
+			Name:      "rejected_requests",
+			Help:      "Requests rejected by rate or concurrency limits",
+		},
+		[]string{"listen", "scope"},
+	)
 	promFrontendRequestDuration = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
 			Namespace: NAME,
@@ -194,6 +203,25 @@ var (
 		},
 		[]string{"peer"},
 	)
+	promPeerPassthroughDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: NAME,
+			Subsystem: "peer",
+			Name:      "passthrough_duration_seconds",
+			Help:      "Peer Passthrough Query Duration in Seconds",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+		},
+		[]string{"peer"},
+	)
+	promPeerPassthroughHedged = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: NAME,
+			Subsystem: "peer",
+			Name:      "passthrough_hedged_queries",
+			Help:      "Peer Passthrough Queries Sent to an Alternate Source",
+		},
+		[]string{"peer"},
+	)
 
 	promObjectCount = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -276,6 +304,7 @@ func initPrometheus(lmd *Daemon) (prometheusListener io.Closer) {
 	prometheus.MustRegister(promFrontendBytesSend)
 	prometheus.MustRegister(promFrontendBytesReceived)
 	prometheus.MustRegister(promFrontendOpenConnections)
+	prometheus.MustRegister(promFrontendRejectedRequests)
 	prometheus.MustRegister(promFrontendRequestDuration)
 	prometheus.MustRegister(promPeerUpdateInterval)
 	prometheus.MustRegister(promPeerFullUpdateInterval)
@@ -286,6 +315,8 @@ func initPrometheus(lmd *Daemon) (prometheusListener io.Closer) {
 	prometheus.MustRegister(promPeerBytesReceived)
 	prometheus.MustRegister(promPeerUpdates)
 	prometheus.MustRegister(promPeerUpdateDuration)
+	prometheus.MustRegister(promPeerPassthroughDuration)
+	prometheus.MustRegister(promPeerPassthroughHedged)
 	prometheus.MustRegister(promObjectUpdate)
 	prometheus.MustRegister(promObjectCount)
 	prometheus.MustRegister(promStringDedupCount)
@@ -0,0 +1,396 @@
+package lmd
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// DefaultRedactReplacement replaces hidden values if the rule does not set a replacement.
+const DefaultRedactReplacement = "***"
+
+// RequestRedaction contains all redaction rules applying to the user of a request.
+type RequestRedaction struct {
+	rules []*RedactRule
+}
+
+// ColumnRedaction describes how the values of a redacted column are derived from the original column.
+type ColumnRedaction struct {
+	Column         *Column         // original column
+	names          *Column         // custom variable names column for lists of custom variable values
+	columnRules    []*RedactRule   // rules applied to all values
+	customVarRules []*RedactRule   // rules applied to matching custom variables only
+	elementRules   [][]*RedactRule // rules by position for list elements embedding other columns, ex.: services_with_info
+}
+
+// NewRequestRedaction returns the redaction rules for given user or nil if the user is exempt from all rules.
+// Requests without AuthUser are redacted as well, unless exempted by an empty user pattern.
+func NewRequestRedaction(lmd *Daemon, authUser string) *RequestRedaction {
+	if lmd == nil || len(lmd.Config.Redact) == 0 {
+		return nil
+	}
+
+	var groups map[string]bool
+	var redaction *RequestRedaction
+	for i := range lmd.Config.Redact {
+		rule := &lmd.Config.Redact[i]
+		if matchAnyPattern(rule.ExemptUsers, authUser) {
+			continue
+		}
+		if authUser != "" && len(rule.ExemptGroups) > 0 {
+			if groups == nil {
+				groups = lmd.getContactGroups(authUser)
+			}
+			if slices.ContainsFunc(rule.ExemptGroups, func(group string) bool { return groups[group] }) {
+				continue
+			}
+		}
+		if redaction == nil {
+			redaction = &RequestRedaction{}
+		}
+		redaction.rules = append(redaction.rules, rule)
+	}
+
+	return redaction
+}
+
+// redactColumn returns a virtual copy of the column which returns redacted values or nil if no rule applies.
+func (rr *RequestRedaction) redactColumn(col *Column) *Column {
+	if rr == nil || col.Redaction != nil {
+		return nil
+	}
+	switch col.DataType {
+	case StringCol, StringLargeCol, StringListCol, CustomVarCol:
+	case InterfaceListCol:
+		return rr.redactEmbeddedColumn(col)
+	default:
+		return nil
+	}
+
+	// lower case columns share the rules of their original column
+	name := strings.TrimSuffix(col.Name, "_lc")
+	isCustomVar := col.DataType == CustomVarCol || strings.HasSuffix(name, "custom_variable_values")
+	// reference columns, like host_plugin_output, also match by the name of the referenced column
+	names := []string{name}
+	for ref := col.RefCol; ref != nil; ref = ref.RefCol {
+		names = append(names, strings.TrimSuffix(ref.Name, "_lc"))
+	}
+	redaction := &ColumnRedaction{Column: col}
+	for _, rule := range rr.rules {
+		if slices.ContainsFunc(names, func(name string) bool { return matchAnyPattern(rule.Columns, name) }) {
+			redaction.columnRules = append(redaction.columnRules, rule)
+		}
+		if isCustomVar && len(rule.CustomVariables) > 0 {
+			redaction.customVarRules = append(redaction.customVarRules, rule)
+		}
+	}
+	if len(redaction.columnRules) == 0 && len(redaction.customVarRules) == 0 {
+		return nil
+	}
+	if col.DataType == StringListCol && isCustomVar {
+		redaction.names = col.Table.ColumnsIndex[strings.TrimSuffix(name, "values")+"names"]
+	}
+
+	return col.Table.GetRedactedColumn(redaction)
+}
+
+// redactEmbeddedColumn returns a virtual copy of list columns embedding other columns, like services_with_info,
+// which returns the embedded values redacted by the rules of their original column or nil if no rule applies.
+func (rr *RequestRedaction) redactEmbeddedColumn(col *Column) *Column {
+	base := col
+	for base.RefCol != nil {
+		base = base.RefCol
+	}
+	names := embeddedColumns[base.Table.Name][base.Name]
+	if len(names) == 0 {
+		return nil
+	}
+	found := false
+	elementRules := make([][]*RedactRule, len(names))
+	for i, name := range names {
+		for _, rule := range rr.rules {
+			if matchAnyPattern(rule.Columns, name) {
+				elementRules[i] = append(elementRules[i], rule)
+				found = true
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	return col.Table.GetRedactedColumn(&ColumnRedaction{Column: col, elementRules: elementRules})
+}
+
+// redactFilter replaces the columns of all filters with their redacted copies,
+// so filters and stats only match the values visible to the user.
+func (rr *RequestRedaction) redactFilter(filter []*Filter) {
+	for _, fil := range filter {
+		if fil.Column != nil {
+			if col := rr.redactColumn(fil.Column); col != nil {
+				fil.Column = col
+				fil.ColumnIndex = -1
+			}
+		}
+		rr.redactFilter(fil.Filter)
+	}
+}
+
+// checkPassthroughFilter returns an error if any filter uses a redacted column.
+// Passthrough filters are applied by the backend on plain values and would reveal them.
+func (rr *RequestRedaction) checkPassthroughFilter(filter []*Filter) error {
+	for _, fil := range filter {
+		if fil.Column != nil && rr.redactColumn(fil.Column) != nil {
+			return fmt.Errorf("bad request: filter on redacted column %s not supported for table %s", fil.Column.Name, fil.Column.Table.Name.String())
+		}
+		if err := rr.checkPassthroughFilter(fil.Filter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// apply returns the value with all parts matching the pattern replaced.
+func (rule *RedactRule) apply(value string) string {
+	if value == "" {
+		return value
+	}
+	replacement := rule.Replacement
+	if replacement == "" {
+		replacement = DefaultRedactReplacement
+	}
+	// rules without valid pattern hide the whole value
+	if rule.regex == nil {
+		return replacement
+	}
+
+	return rule.regex.ReplaceAllString(value, replacement)
+}
+
+// matchCustomVariable returns true if the custom variable name matches any pattern, regardless of the case.
+func (rule *RedactRule) matchCustomVariable(name string) bool {
+	name = strings.ToUpper(name)
+	for _, pattern := range rule.CustomVariables {
+		if ok, _ := path.Match(strings.ToUpper(pattern), name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactString returns the value with all column rules applied.
+func (r *ColumnRedaction) redactString(value string) string {
+	for _, rule := range r.columnRules {
+		value = rule.apply(value)
+	}
+
+	return value
+}
+
+// redactCustomVar returns the custom variable value with all matching rules applied.
+func (r *ColumnRedaction) redactCustomVar(name, value string) string {
+	value = r.redactString(value)
+	for _, rule := range r.customVarRules {
+		if rule.matchCustomVariable(name) {
+			value = rule.apply(value)
+		}
+	}
+
+	return value
+}
+
+// redactRow returns the redacted value of the original column from given row.
+func (r *ColumnRedaction) redactRow(row *DataRow) interface{} {
+	col := r.Column
+	switch col.DataType {
+	case CustomVarCol:
+		if col.StorageType == RefStore && row.Refs[col.RefColTableName] == nil {
+			return map[string]string{}
+		}
+		vars := interface2hashmap(row.GetValueByColumn(col))
+		res := make(map[string]string, len(vars))
+		for name, value := range vars {
+			res[name] = r.redactCustomVar(name, value)
+		}
+
+		return res
+	case StringListCol:
+		list := row.GetStringList(col)
+		var names []string
+		if r.names != nil {
+			names = row.GetStringList(r.names)
+		}
+		res := make([]string, len(list))
+		for i, value := range list {
+			switch {
+			case r.names == nil:
+				res[i] = r.redactString(value)
+			case i < len(names):
+				res[i] = r.redactCustomVar(names[i], value)
+			default:
+				// hide values without name, they cannot be matched against the rules
+				res[i] = DefaultRedactReplacement
+			}
+		}
+
+		return res
+	case InterfaceListCol:
+		return r.redactElements(row.GetInterfaceList(col))
+	default:
+		return r.redactString(row.GetString(col))
+	}
+}
+
+// redactElements returns a copy of the list with the embedded string values redacted by their position.
+func (r *ColumnRedaction) redactElements(list []interface{}) []interface{} {
+	res := make([]interface{}, len(list))
+	for i, elem := range list {
+		values, ok := elem.([]interface{})
+		if !ok {
+			res[i] = elem
+
+			continue
+		}
+		redacted := make([]interface{}, len(values))
+		for j, value := range values {
+			str, isString := value.(string)
+			if !isString || j >= len(r.elementRules) {
+				redacted[j] = value
+
+				continue
+			}
+			for _, rule := range r.elementRules[j] {
+				str = rule.apply(str)
+			}
+			redacted[j] = str
+		}
+		res[i] = redacted
+	}
+
+	return res
+}
+
+// redactValue returns the redacted value from a passthrough result.
+func (r *ColumnRedaction) redactValue(value interface{}) interface{} {
+	switch val := value.(type) {
+	case string:
+		return r.redactString(val)
+	case []string:
+		list := make([]string, len(val))
+		for i, v := range val {
+			list[i] = r.redactString(v)
+		}
+
+		return list
+	case []interface{}:
+		if r.elementRules != nil {
+			return r.redactElements(val)
+		}
+		list := make([]interface{}, len(val))
+		for i, v := range val {
+			if str, ok := v.(string); ok {
+				list[i] = r.redactString(str)
+			} else {
+				list[i] = v
+			}
+		}
+
+		return list
+	}
+
+	return value
+}
+
+// redactChangeData returns a copy of the change event data with all rules applied.
+func (rr *RequestRedaction) redactChangeData(table *Table, data map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(data))
+	for name, value := range data {
+		res[name] = value
+		col, ok := table.ColumnsIndex[name]
+		if !ok {
+			continue
+		}
+		redacted := rr.redactColumn(col)
+		if redacted == nil {
+			continue
+		}
+		r := redacted.Redaction
+		list, isList := value.([]string)
+		if !isList || r.names == nil {
+			res[name] = r.redactValue(value)
+
+			continue
+		}
+		names, _ := data[r.names.Name].([]string)
+		values := make([]string, len(list))
+		for i, val := range list {
+			if i < len(names) {
+				values[i] = r.redactCustomVar(names[i], val)
+			} else {
+				values[i] = DefaultRedactReplacement
+			}
+		}
+		res[name] = values
+	}
+
+	return res
+}
+
+// redactResultSet redacts passthrough results in place, they are not backed by data rows.
+func redactResultSet(result ResultSet, req *Request) {
+	redactResultColumn := func(index int, col *Column) {
+		if col.Redaction == nil {
+			return
+		}
+		for _, row := range result {
+			if index < len(row) {
+				row[index] = col.Redaction.redactValue(row[index])
+			}
+		}
+	}
+	for i, col := range req.RequestColumns {
+		redactResultColumn(i, col)
+	}
+	// additional sort columns are appended after the request columns
+	for _, field := range req.Sort {
+		if field.Column != nil && field.Index >= len(req.RequestColumns) {
+			redactResultColumn(field.Index, field.Column)
+		}
+	}
+}
+
+// VirtualColRedacted returns the redacted value of the original column.
+func VirtualColRedacted(d *DataRow, col *Column) interface{} {
+	return col.Redaction.redactRow(d)
+}
+
+// WriteJSONRedactedColumn writes the redacted value of the column to output buffer.
+func (d *DataRow) WriteJSONRedactedColumn(jsonwriter *jsoniter.Stream, col *Column) {
+	if col.DataType != CustomVarCol {
+		d.WriteJSONVirtualColumn(jsonwriter, col)
+
+		return
+	}
+
+	vars := interface2hashmap(d.getVirtualRowValue(col))
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	jsonwriter.WriteObjectStart()
+	for i, name := range names {
+		if i > 0 {
+			jsonwriter.WriteMore()
+		}
+		jsonwriter.WriteObjectField(name)
+		jsonwriter.WriteString(vars[name])
+	}
+	jsonwriter.WriteObjectEnd()
+}
@@ -0,0 +1,113 @@
+package lmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const redactTestConfig = `
+Listen = ["test.sock"]
+
+[[Redact]]
+name = "output"
+columns = ["plugin_output", "check_command"]
+exempt_users = ["authuser"]
+
+[[Redact]]
+name = "customvars"
+custom_variables = ["test"]
+replacement = "hidden"
+exempt_users = ["authuser"]
+`
+
+func TestRedactRule(t *testing.T) {
+	conf := &Config{Redact: []RedactRule{
+		{Pattern: `(password=)\S+`, Replacement: "${1}***"},
+		{Pattern: `[invalid`},
+	}}
+	conf.validateRedact()
+
+	assert.Equal(t, "check_http -a password=*** -H localhost", conf.Redact[0].apply("check_http -a password=secret -H localhost"))
+	assert.Equal(t, "check_ping", conf.Redact[0].apply("check_ping"))
+	assert.Empty(t, conf.Redact[0].apply(""))
+
+	// invalid patterns hide the whole value
+	assert.Equal(t, DefaultRedactReplacement, conf.Redact[1].apply("password=secret"))
+}
+
+/**
+ * Tests that redacted columns neither show nor leak the plain values.
+ */
+func TestRedactColumns(t *testing.T) {
+	peer, cleanup, _ := StartTestPeerExtra(1, 2, 9, redactTestConfig)
+	PauseTestPeers(peer)
+
+	query := "GET hosts\nColumns: name plugin_output custom_variables custom_variable_values\n"
+
+	res, _, err := peer.QueryString(query + "\n")
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, DefaultRedactReplacement, res[0][1])
+	assert.Equal(t, map[string]interface{}{"TEST": "hidden"}, res[0][2])
+	assert.Equal(t, []interface{}{"hidden"}, res[0][3])
+
+	// exempt users see plain values
+	res, _, err = peer.QueryString(query + "AuthUser: authuser\n\n")
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.NotEqual(t, DefaultRedactReplacement, res[0][1])
+	assert.Equal(t, map[string]interface{}{"TEST": "1"}, res[0][2])
+
+	// reference columns are redacted as well
+	res, _, err = peer.QueryString("GET services\nColumns: host_plugin_output host_custom_variables\nLimit: 1\n\n")
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, DefaultRedactReplacement, res[0][0])
+	assert.Equal(t, map[string]interface{}{"TEST": "hidden"}, res[0][1])
+
+	// list columns embedding redacted columns
+	res, _, err = peer.QueryString("GET hosts\nColumns: services_with_info services_with_state\nLimit: 1\n\n")
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	services := interface2interfacelist(res[0][0])
+	require.NotEmpty(t, services)
+	for _, service := range services {
+		info := interface2interfacelist(service)
+		require.Len(t, info, 4)
+		assert.NotEqual(t, DefaultRedactReplacement, info[0])
+		assert.Equal(t, DefaultRedactReplacement, info[3])
+	}
+	assert.Len(t, interface2interfacelist(res[0][1]), len(services))
+
+	res, _, err = peer.QueryString("GET services\nColumns: host_services_with_info\nLimit: 1\nAuthUser: authuser\n\n")
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	for _, service := range interface2interfacelist(res[0][0]) {
+		assert.NotEqual(t, DefaultRedactReplacement, interface2interfacelist(service)[3])
+	}
+
+	// filters, stats and sorting only see the redacted values
+	res, _, err = peer.QueryString("GET hosts\nColumns: name\nFilter: custom_variables = TEST 1\n\n")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	res, _, err = peer.QueryString("GET hosts\nStats: custom_variables = TEST hidden\nStats: custom_variable_values >= 1\nStats: plugin_output !~ ^\\*\\*\\*$\n\n")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{2.0, 0.0, 0.0}, res[0])
+
+	res, _, err = peer.QueryString("GET services\nColumns: host_name\nFilter: host_custom_variables = TEST 1\n\n")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	_, _, err = peer.QueryString("GET hosts\nColumns: name\nSort: plugin_output asc\nSort: custom_variables TEST asc\n\n")
+	require.NoError(t, err)
+
+	// filters on passthrough tables would be applied to plain values
+	_, _, err = peer.QueryString("GET log\nColumns: message\nFilter: plugin_output ~ secret\n\n")
+	require.ErrorContains(t, err, "filter on redacted column plugin_output not supported")
+
+	err = cleanup()
+	require.NoError(t, err)
+}
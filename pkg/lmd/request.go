@@ -26,6 +26,8 @@ type Request struct {
 	noCopy              noCopy
 	StatsResult         *ResultSetStats
 	lmd                 *Daemon
+	acl                 *RequestACL
+	redaction           *RequestRedaction
 	BackendsMap         map[string]string
 	BackendErrors       map[string]string
 	Limit               *int
@@ -35,6 +37,8 @@ type Request struct {
 	WaitTrigger         string
 	FilterStr           string
 	WaitObject          string
+	IfChangedSince      string // change token from a previous response, unchanged results are answered with not modified
+	changeToken         string // change token computed before the response has been built
 	Stats               []*Filter
 	StatsGrouped        []*Filter // optimized stats groups
 	Filter              []*Filter
@@ -53,6 +57,8 @@ type Request struct {
 	ResponseFixed16     bool
 	WaitConditionNegate bool
 	KeepAlive           bool
+	aclResolved         bool
+	redactionResolved   bool
 }
 
 // SortDirection can be either Asc or Desc.
@@ -346,13 +352,21 @@ func NewRequest(ctx context.Context, lmd *Daemon, buf *bufio.Reader, options Par
 		}
 	}
 
+	// client certificates and api tokens from the http listener, ex. used by websocket connections, may set AuthUser and ACL
+	if err = applyHTTPAuth(ctx, lmd, req); err != nil {
+		return nil, 0, err
+	}
+
 	// remove unnecessary filter indentation
 	if options&ParseOptimize != 0 {
 		req.optimizeFilterIndentation()
 		req.StatsGrouped = req.optimizeStatsGroups(req.Stats, true)
 	}
 
-	req.SetRequestColumns()
+	err = req.SetRequestColumns()
+	if err != nil {
+		return nil, 0, err
+	}
 	err = req.SetSortColumns()
 
 	return req, size, err
@@ -601,6 +615,14 @@ func (req *Request) buildDistributedRequestData(subBackends []string) (requestDa
 	// avoid recursion
 	requestData["distributed"] = true
 
+	// keep authorization and acl rules of the original request
+	if req.AuthUser != "" {
+		requestData["authuser"] = req.AuthUser
+	}
+	if req.acl != nil && req.acl.name != "" {
+		requestData["acl"] = req.acl.name
+	}
+
 	// Set backends for this sub-request
 	requestData["backends"] = subBackends
 
@@ -663,7 +685,8 @@ func (req *Request) buildDistributedRequestData(subBackends []string) (requestDa
 	}
 
 	// Get hash with metadata in addition to table rows
-	requestData["outputformat"] = OutputFormatWrappedJSON
+	outputFormat := OutputFormatWrappedJSON
+	requestData["outputformat"] = outputFormat.String()
 
 	return requestData
 }
@@ -779,6 +802,10 @@ func (req *Request) ParseRequestHeaderLine(line []byte, options ParseOptions) (e
 	case "waitobject":
 		req.WaitObject = string(args)
 
+		return nil
+	case "ifchangedsince":
+		req.IfChangedSince = string(args)
+
 		return nil
 	case "waitcondition":
 		req.NumFilter++
@@ -923,11 +950,49 @@ func parseAuthUser(field *string, value []byte) (err error) {
 	return
 }
 
+// ACL returns the combined access rules for the user of this request or nil if no rules apply.
+func (req *Request) ACL() *RequestACL {
+	if !req.aclResolved {
+		req.acl = NewRequestACL(req.lmd, req.AuthUser)
+		req.aclResolved = true
+	}
+
+	return req.acl
+}
+
+// SetACL sets the access rules for this request regardless of the AuthUser.
+func (req *Request) SetACL(acl *RequestACL) {
+	req.acl = acl
+	req.aclResolved = true
+}
+
+// Redaction returns the redaction rules for the user of this request or nil if no rules apply.
+func (req *Request) Redaction() *RequestRedaction {
+	if !req.redactionResolved {
+		req.redaction = NewRequestRedaction(req.lmd, req.AuthUser)
+		req.redactionResolved = true
+	}
+
+	return req.redaction
+}
+
 // SetRequestColumns sets  list of used indexes and columns for this request.
-func (req *Request) SetRequestColumns() {
+// Columns denied by the ACL are replaced by empty placeholder columns and
+// redacted columns by virtual copies returning the redacted values.
+func (req *Request) SetRequestColumns() (err error) {
 	logWith(req).Tracef("SetRequestColumns")
 	if req.Command != "" {
-		return
+		return nil
+	}
+	acl := req.ACL()
+	if !acl.AllowTable(req.Table) {
+		return fmt.Errorf("bad request: table %s not allowed", req.Table.String())
+	}
+	if err = acl.checkFilter(req.Filter); err != nil {
+		return err
+	}
+	if err = acl.checkFilter(req.Stats); err != nil {
+		return err
 	}
 	table := Objects.Tables[req.Table]
 	numColumns := len(req.Columns) + len(req.Stats)
@@ -941,16 +1006,58 @@ func (req *Request) SetRequestColumns() {
 	if len(req.Columns) == 0 && len(req.Stats) == 0 {
 		for j := range table.Columns {
 			col := table.Columns[j]
+			if acl.DenyColumn(col) {
+				continue
+			}
 			columns = append(columns, col)
 		}
 	}
 
 	// build array of requested columns as ResultColumn objects list
 	for j := range req.Columns {
+		// unknown columns are denied by their requested name
 		col := table.GetColumnWithFallback(req.Columns[j])
+		if acl.DenyColumn(col) || acl.DenyColumnName(req.Columns[j]) {
+			columns = append(columns, table.GetDeniedColumn(req.Columns[j]))
+
+			continue
+		}
 		columns = append(columns, col)
 	}
+
+	if err = req.setRedactedColumns(table, columns); err != nil {
+		return err
+	}
 	req.RequestColumns = columns
+
+	return nil
+}
+
+// setRedactedColumns replaces redacted columns in the column list and all filters.
+func (req *Request) setRedactedColumns(table *Table, columns []*Column) error {
+	redaction := req.Redaction()
+	if redaction == nil {
+		return nil
+	}
+	for i, col := range columns {
+		if redacted := redaction.redactColumn(col); redacted != nil {
+			columns[i] = redacted
+		}
+	}
+	if table.PassthroughOnly {
+		for _, filter := range [][]*Filter{req.Filter, req.Stats, req.WaitCondition} {
+			if err := redaction.checkPassthroughFilter(filter); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+	for _, filter := range [][]*Filter{req.Filter, req.Stats, req.StatsGrouped, req.WaitCondition} {
+		redaction.redactFilter(filter)
+	}
+
+	return nil
 }
 
 // SetSortColumns set the requestcolumn for the sortfields.
@@ -960,12 +1067,18 @@ func (req *Request) SetSortColumns() (err error) {
 		return
 	}
 	table := Objects.Tables[req.Table]
+	acl := req.ACL()
 
 	// build array of requested columns as ResultColumn objects list
 	for j := range req.Sort {
 		col := table.GetColumn(req.Sort[j].Name)
+		if col != nil && acl.DenyColumn(col) {
+			return fmt.Errorf("bad request: sort column %s not allowed", req.Sort[j].Name)
+		}
 		if col == nil {
 			err = fmt.Errorf("unknown sort column %s", req.Sort[j].Name)
+		} else if redacted := req.Redaction().redactColumn(col); redacted != nil {
+			col = redacted
 		}
 		req.Sort[j].Column = col
 	}
@@ -71,7 +71,7 @@ func NewResponse(ctx context.Context, req *Request, client *ClientConnection) (r
 	case len(res.SelectedPeers) == 0:
 		// no backends selected, return empty result
 		res.Result = make(ResultSet, 0)
-	case table.PassthroughOnly:
+	case table.PassthroughOnly && !res.canUseLogCache():
 		// passthrough requests, ex.: log table
 		res.BuildPassThroughResult(ctx)
 		res.PostProcessing()
@@ -90,7 +90,15 @@ func NewResponse(ctx context.Context, req *Request, client *ClientConnection) (r
 		stores := make(map[*Peer]*DataStore)
 		for i := range res.SelectedPeers {
 			peer := res.SelectedPeers[i]
-			store, err2 := peer.GetDataStore(table.Name)
+			var store *DataStore
+			var err2 error
+			if table.PassthroughOnly {
+				// passthrough tables are only queried locally if they are cached, ex.: log table
+				minTime, _ := logFilterMinTime(req.Filter)
+				store, err2 = peer.getLogCacheStore(minTime)
+			} else {
+				store, err2 = peer.GetDataStore(table.Name)
+			}
 			if err2 != nil {
 				res.Lock.Lock()
 				res.Failed[peer.ID] = err2.Error()
@@ -243,9 +251,11 @@ func (res *Response) Swap(i, j int) {
 }
 
 // ExpandRequestedBackends fills the requests backends map.
+// Backends not allowed by the ACL are skipped.
 func (req *Request) ExpandRequestedBackends() (err error) {
 	req.BackendsMap = make(map[string]string)
 	req.BackendErrors = make(map[string]string)
+	acl := req.ACL()
 
 	// no backends selected means all backends
 	req.lmd.PeerMapLock.RLock()
@@ -253,6 +263,9 @@ func (req *Request) ExpandRequestedBackends() (err error) {
 	if len(req.Backends) == 0 {
 		for id := range req.lmd.PeerMap {
 			p := req.lmd.PeerMap[id]
+			if !acl.AllowBackend(p) {
+				continue
+			}
 			req.BackendsMap[p.ID] = p.ID
 		}
 
@@ -260,12 +273,17 @@ func (req *Request) ExpandRequestedBackends() (err error) {
 	}
 
 	for _, peerKey := range req.Backends {
-		_, Ok := req.lmd.PeerMap[peerKey]
+		p, Ok := req.lmd.PeerMap[peerKey]
 		if !Ok {
 			req.BackendErrors[peerKey] = fmt.Sprintf("bad request: backend %s does not exist", peerKey)
 
 			continue
 		}
+		if !acl.AllowBackend(p) {
+			req.BackendErrors[peerKey] = fmt.Sprintf("bad request: backend %s not allowed", peerKey)
+
+			continue
+		}
 		req.BackendsMap[peerKey] = peerKey
 	}
 
@@ -523,7 +541,12 @@ func (res *Response) WrappedJSON(buf io.Writer) error {
 	}
 
 	json.WriteRaw(fmt.Sprintf("\n,\"rows_scanned\":%d", res.RowsScanned))
-	json.WriteRaw(fmt.Sprintf("\n,\"total_count\":%d}", res.ResultTotal))
+	json.WriteRaw(fmt.Sprintf("\n,\"total_count\":%d", res.ResultTotal))
+	if res.Request.changeToken != "" {
+		json.WriteRaw("\n,\"change_token\":")
+		json.WriteString(res.Request.changeToken)
+	}
+	json.WriteRaw("}")
 	err := json.Flush()
 	if err != nil {
 		return fmt.Errorf("WrappedJSON: %w", err)
@@ -740,7 +763,8 @@ func (res *Response) BuildPassThroughResult(ctx context.Context) {
 	columnsIndex := make(map[*Column]int)
 	for colNum := range res.Request.RequestColumns {
 		col := res.Request.RequestColumns[colNum]
-		if col.StorageType == VirtualStore {
+		// redacted columns are fetched from the backend and redacted afterwards
+		if col.StorageType == VirtualStore && col.Redaction == nil {
 			virtualColumns = append(virtualColumns, col)
 		} else {
 			backendColumns = append(backendColumns, col.Name)
@@ -754,7 +778,7 @@ func (res *Response) BuildPassThroughResult(ctx context.Context) {
 			field.Index = j
 		} else {
 			field.Index = len(backendColumns) + len(virtualColumns)
-			if field.Column.StorageType == VirtualStore {
+			if field.Column.StorageType == VirtualStore && field.Column.Redaction == nil {
 				virtualColumns = append(virtualColumns, field.Column)
 			} else {
 				backendColumns = append(backendColumns, field.Column.Name)
@@ -887,8 +911,9 @@ func (res *Response) gatherResultRows(ctx context.Context, store *DataStore, res
 	breakOnLimit := res.Request.OutputFormat != OutputFormatWrappedJSON
 
 	done := ctx.Done()
+	data, authChecked := store.GetPreFilteredData(req.Filter, req.AuthUser)
 Rows:
-	for i, row := range store.GetPreFilteredData(req.Filter) {
+	for i, row := range data {
 		// only check every couple of rows
 		if i%RowContextCheck == 0 {
 			select {
@@ -908,7 +933,7 @@ Rows:
 			}
 		}
 
-		if !row.checkAuth(req.AuthUser) {
+		if !authChecked && !row.checkAuth(req.AuthUser) {
 			continue Rows
 		}
 
@@ -933,8 +958,9 @@ func (res *Response) gatherStatsResult(ctx context.Context, store *DataStore) *R
 	localStats := result.Stats
 
 	done := ctx.Done()
+	data, authChecked := store.GetPreFilteredData(req.Filter, req.AuthUser)
 Rows:
-	for i, row := range store.GetPreFilteredData(req.Filter) {
+	for i, row := range data {
 		// only check every couple of rows
 		if i%RowContextCheck == 0 {
 			select {
@@ -952,7 +978,7 @@ Rows:
 			}
 		}
 
-		if !row.checkAuth(req.AuthUser) {
+		if !authChecked && !row.checkAuth(req.AuthUser) {
 			continue Rows
 		}
 
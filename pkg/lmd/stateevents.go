@@ -0,0 +1,388 @@
+package lmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// StateEventBufferSize sets the number of recent events kept to resume event streams.
+	StateEventBufferSize = 10000
+
+	// StateEventSubscriberBufferSize sets the number of events buffered per subscriber before it gets dropped.
+	StateEventSubscriberBufferSize = 1000
+
+	// StateEventHeartbeatInterval sets the interval for keepalive comments on idle event streams.
+	StateEventHeartbeatInterval = 15 * time.Second
+)
+
+// stateEventColumns contains the columns which trigger a state event when changed.
+var stateEventColumns = [...]string{"state", "state_type", "acknowledged", "scheduled_downtime_depth"}
+
+// StateEvent describes a changed state of a single host or service.
+type StateEvent struct {
+	Previous               map[string]int64 `json:"previous"` // previous values of all changed columns
+	PeerKey                string           `json:"peer_key"`
+	PeerName               string           `json:"peer_name"`
+	Table                  string           `json:"table"`
+	HostName               string           `json:"host_name"`
+	Description            string           `json:"description,omitempty"`
+	ID                     uint64           `json:"id"`
+	Time                   float64          `json:"time"`
+	State                  int64            `json:"state"`
+	StateType              int64            `json:"state_type"`
+	Acknowledged           int64            `json:"acknowledged"`
+	ScheduledDowntimeDepth int64            `json:"scheduled_downtime_depth"`
+	row                    *DataRow         // copy of the host or service at the time of the event, used to match filters
+	contacts               []string         // contacts authorized for the host or service at the time of the event
+	contactGroups          []string         // contact groups authorized for the host or service at the time of the event
+}
+
+// StateEventBroker keeps recent state events in a ring buffer and distributes new events to all subscribers.
+type StateEventBroker struct {
+	broker *eventBroker[*StateEvent, struct{}]
+	buffer []*StateEvent // ring buffer, the event with id n is stored at (n-1) % len(buffer)
+	lastID uint64        // id of the latest event
+}
+
+// StateEventSubscriber is a single consumer of state events.
+type StateEventSubscriber = eventSubscriber[*StateEvent, struct{}]
+
+// stateEventFilter contains the parsed filter, AuthUser and backends of an event stream for each table.
+type stateEventFilter struct {
+	requests map[TableName]*Request
+}
+
+// NewStateEventBroker creates a new state event broker keeping up to size events.
+func NewStateEventBroker(size int) *StateEventBroker {
+	return &StateEventBroker{
+		broker: newEventBroker[*StateEvent, struct{}](),
+		buffer: make([]*StateEvent, size),
+	}
+}
+
+// Publish assigns ids to the events, stores them in the ring buffer and sends them to all subscribers.
+// Subscribers which cannot keep up will be dropped.
+func (b *StateEventBroker) Publish(events []*StateEvent) {
+	b.broker.lock.Lock()
+	defer b.broker.lock.Unlock()
+	for _, event := range events {
+		b.lastID++
+		event.ID = b.lastID
+		b.buffer[(event.ID-1)%uint64(len(b.buffer))] = event
+		b.broker.send(event, nil)
+	}
+}
+
+// Subscribe adds a new subscriber. If resume is set, all buffered events after lastEventID are returned as well.
+// The missed flag is set if those events are not available anymore.
+func (b *StateEventBroker) Subscribe(lastEventID uint64, resume bool) (sub *StateEventSubscriber, replay []*StateEvent, missed bool) {
+	b.broker.lock.Lock()
+	defer b.broker.lock.Unlock()
+	sub = b.broker.add(struct{}{}, StateEventSubscriberBufferSize)
+
+	if !resume {
+		return sub, nil, false
+	}
+
+	oldestID := uint64(1)
+	if b.lastID > uint64(len(b.buffer)) {
+		oldestID = b.lastID - uint64(len(b.buffer)) + 1
+	}
+	if lastEventID > b.lastID || lastEventID+1 < oldestID {
+		// unknown id, ex. from before a restart, or events already removed from the buffer
+		lastEventID = oldestID - 1
+		missed = true
+	}
+	for id := lastEventID + 1; id <= b.lastID; id++ {
+		replay = append(replay, b.buffer[(id-1)%uint64(len(b.buffer))])
+	}
+
+	return sub, replay, missed
+}
+
+// Unsubscribe removes the subscriber.
+func (b *StateEventBroker) Unsubscribe(sub *StateEventSubscriber) {
+	b.broker.unsubscribe(sub)
+}
+
+// getStateEventColumns returns the columns used for state events or nil if this store does not create events.
+func (d *DataStore) getStateEventColumns() (columns []*Column) {
+	if d.Peer == nil || d.Peer.lmd == nil || d.Peer.lmd.stateEvents == nil {
+		return nil
+	}
+	if d.Table.Name != TableHosts && d.Table.Name != TableServices {
+		return nil
+	}
+	columns = make([]*Column, 0, len(stateEventColumns))
+	for _, name := range stateEventColumns {
+		col := d.Table.GetColumn(name)
+		if col == nil {
+			return nil
+		}
+		columns = append(columns, col)
+	}
+
+	return columns
+}
+
+// getStateEventValues returns the current values of the state event columns.
+func (d *DataRow) getStateEventValues(columns []*Column) (values [len(stateEventColumns)]int64) {
+	for i, col := range columns {
+		values[i] = d.GetInt64(col)
+	}
+
+	return values
+}
+
+// newStateEvent returns a state event if any of the state event columns changed or nil otherwise.
+func (d *DataRow) newStateEvent(columns []*Column, previous [len(stateEventColumns)]int64) *StateEvent {
+	current := d.getStateEventValues(columns)
+	if current == previous {
+		return nil
+	}
+
+	store := d.DataStore
+	event := &StateEvent{
+		Previous:               make(map[string]int64),
+		PeerKey:                store.PeerKey,
+		PeerName:               store.Peer.Name,
+		Table:                  store.Table.Name.String(),
+		Time:                   d.LastUpdate,
+		State:                  current[0],
+		StateType:              current[1],
+		Acknowledged:           current[2],
+		ScheduledDowntimeDepth: current[3],
+	}
+	for i, name := range stateEventColumns {
+		if current[i] != previous[i] {
+			event.Previous[name] = previous[i]
+		}
+	}
+	if store.Table.Name == TableServices {
+		event.HostName = d.GetStringByName("host_name")
+		event.Description = d.GetStringByName("description")
+	} else {
+		event.HostName = d.GetStringByName("name")
+	}
+	event.row = d.snapshot()
+	event.contacts, event.contactGroups = d.getAuthContacts()
+
+	return event
+}
+
+// getAuthContacts returns the contacts and contact groups authorized for this host or service.
+// Contacts of the host are authorized for its services as well, unless ServiceAuthorization is strict.
+func (d *DataRow) getAuthContacts() (contacts, groups []string) {
+	contacts = d.GetStringListByName("contacts")
+	groups = d.GetStringListByName("contact_groups")
+	store := d.DataStore
+	if store.Table.Name != TableServices || store.Peer.lmd.Config.ServiceAuthorization != AuthLoose || store.DataSet == nil {
+		return contacts, groups
+	}
+	hosts := store.DataSet.tables[TableHosts]
+	if hosts == nil {
+		return contacts, groups
+	}
+	host, ok := hosts.Index[d.GetStringByName("host_name")]
+	if !ok {
+		return contacts, groups
+	}
+
+	return slices.Concat(contacts, host.GetStringListByName("contacts")), slices.Concat(groups, host.GetStringListByName("contact_groups"))
+}
+
+// isAuthorized returns true if the user was authorized for the host or service at the time of the event.
+func (event *StateEvent) isAuthorized(data *DataStoreSet, authUser string) bool {
+	if authUser == "" {
+		return true
+	}
+	if slices.Contains(event.contacts, authUser) {
+		return true
+	}
+	userGroups := data.getContactGroups(authUser)
+
+	return slices.ContainsFunc(event.contactGroups, func(group string) bool { return userGroups[group] })
+}
+
+// newStateEventFilter parses the filter, AuthUser and backends of the event stream request.
+// Filter use livestatus syntax, ex.: filter=Filter: state != 0.
+func (c *HTTPServerController) newStateEventFilter(request *http.Request) (filter *stateEventFilter, err error) {
+	params := request.URL.Query()
+	tables := []TableName{TableHosts, TableServices}
+	if val := params.Get("tables"); val != "" {
+		tables = nil
+		for _, name := range strings.Split(val, ",") {
+			table, err2 := NewTableName(name)
+			if err2 != nil {
+				return nil, fmt.Errorf("bad request: %s", err2.Error())
+			}
+			if table != TableHosts && table != TableServices {
+				return nil, fmt.Errorf("bad request: events are only available for hosts and services")
+			}
+			tables = append(tables, table)
+		}
+	}
+
+	header := strings.Builder{}
+	for _, val := range params["filter"] {
+		header.WriteString(strings.TrimSpace(val))
+		header.WriteString("\n")
+	}
+	if val := params.Get("authuser"); val != "" {
+		if strings.ContainsAny(val, "\r\n") {
+			return nil, fmt.Errorf("bad request: invalid authuser")
+		}
+		header.WriteString("AuthUser: " + val + "\n")
+	}
+
+	filter = &stateEventFilter{requests: make(map[TableName]*Request)}
+	for _, table := range tables {
+		query := "GET " + table.String() + "\n" + header.String() + "\n"
+		req, _, err := NewRequest(request.Context(), c.lmd, bufio.NewReader(strings.NewReader(query)), c.lmd.defaultReqestParseOption)
+		if err != nil {
+			return nil, err
+		}
+		if val := params.Get("backends"); val != "" {
+			req.Backends = strings.Split(val, ",")
+		}
+		if err = req.ExpandRequestedBackends(); err != nil {
+			return nil, err
+		}
+		for _, peerKey := range req.Backends {
+			if msg, ok := req.BackendErrors[peerKey]; ok {
+				return nil, errors.New(msg)
+			}
+		}
+		filter.requests[table] = req
+	}
+
+	return filter, nil
+}
+
+// matches returns true if the event should be sent to the client.
+// Filter and AuthUser are matched against the values recorded with the event, so replayed events
+// are sent as they would have been at that time. Events of removed backends are not sent.
+func (f *stateEventFilter) matches(event *StateEvent) bool {
+	table, err := NewTableName(event.Table)
+	if err != nil {
+		return false
+	}
+	req, ok := f.requests[table]
+	if !ok || event.row == nil {
+		return false
+	}
+	if len(req.Backends) > 0 && !slices.Contains(req.Backends, event.PeerKey) {
+		return false
+	}
+
+	req.lmd.PeerMapLock.RLock()
+	peer := req.lmd.PeerMap[event.PeerKey]
+	req.lmd.PeerMapLock.RUnlock()
+	if peer == nil || !req.ACL().AllowBackend(peer) {
+		return false
+	}
+	data, err := peer.GetDataStoreSet()
+	if err != nil {
+		return false
+	}
+
+	// referenced columns, ex.: host_name of services, still use the current rows
+	data.lock.RLock()
+	defer data.lock.RUnlock()
+	if !event.isAuthorized(data, req.AuthUser) {
+		return false
+	}
+	for _, fil := range req.Filter {
+		if !event.row.MatchFilter(fil, false) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// events sends host and service state changes as server-sent events till the client disconnects.
+// Clients may resume streams by the Last-Event-ID header or the last_event_id parameter.
+func (c *HTTPServerController) events(wrt http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	filter, err := c.newStateEventFilter(request)
+	if err != nil {
+		httpErrorOutput(err, wrt, http.StatusBadRequest)
+
+		return
+	}
+
+	lastEventID := request.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = request.URL.Query().Get("last_event_id")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		lastID, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			httpErrorOutput(fmt.Errorf("bad request: invalid last event id %s", lastEventID), wrt, http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	sub, replay, missed := c.lmd.stateEvents.Subscribe(lastID, lastEventID != "")
+	defer c.lmd.stateEvents.Unsubscribe(sub)
+	log.Debugf("event stream subscriber connected from %s", request.RemoteAddr)
+
+	stream := &eventStream[*StateEvent]{
+		name:      "event stream",
+		heartbeat: StateEventHeartbeatInterval,
+		keepalive: func() error {
+			_, err := fmt.Fprintf(wrt, ": keepalive\n\n")
+
+			return err
+		},
+		write: func(event *StateEvent) error {
+			return writeStateEvent(wrt, filter, event)
+		},
+	}
+	wrt.Header().Set("Content-Type", "text/event-stream")
+	wrt.Header().Set("Cache-Control", "no-cache")
+	ctrl := stream.start(wrt)
+
+	// tell the client that some events are lost and it has to fetch the current state
+	if missed {
+		_, err = fmt.Fprintf(wrt, "event: reset\ndata: {}\n\n")
+		if err != nil {
+			return
+		}
+	}
+	for _, event := range replay {
+		if err = stream.write(event); err != nil {
+			return
+		}
+	}
+	stream.run(request, ctrl, sub.events, sub.dropped)
+}
+
+// writeStateEvent writes the event in server-sent events format unless it does not match the filter.
+func writeStateEvent(wrt http.ResponseWriter, filter *stateEventFilter, event *StateEvent) error {
+	if !filter.matches(event) {
+		return nil
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("json error: %s", err.Error())
+	}
+	_, err = fmt.Fprintf(wrt, "id: %d\nevent: state\ndata: %s\n\n", event.ID, data)
+	if err != nil {
+		return fmt.Errorf("write error: %s", err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package lmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateEventBroker(t *testing.T) {
+	broker := NewStateEventBroker(3)
+	broker.Publish([]*StateEvent{{}, {}})
+
+	sub, replay, missed := broker.Subscribe(0, false)
+	assert.Empty(t, replay)
+	assert.False(t, missed)
+	broker.Unsubscribe(sub)
+
+	_, replay, missed = broker.Subscribe(1, true)
+	require.Len(t, replay, 1)
+	assert.Equal(t, uint64(2), replay[0].ID)
+	assert.False(t, missed)
+
+	broker.Publish([]*StateEvent{{}, {}, {}})
+	_, replay, missed = broker.Subscribe(1, true)
+	require.Len(t, replay, 3)
+	assert.Equal(t, uint64(3), replay[0].ID)
+	assert.Truef(t, missed, "event 2 is not buffered anymore")
+
+	_, replay, missed = broker.Subscribe(10, true)
+	assert.Len(t, replay, 3)
+	assert.Truef(t, missed, "unknown event id")
+
+	_, replay, missed = broker.Subscribe(5, true)
+	assert.Empty(t, replay)
+	assert.False(t, missed)
+}
+
+func TestStateEventHTTP(t *testing.T) {
+	peer, cleanup, _ := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	server := NewTestHTTPServer(t, peer.lmd)
+
+	// events are only sent for known backends
+	peer.lmd.PeerMapLock.Lock()
+	peer.lmd.PeerMap[peer.ID] = peer
+	peer.lmd.PeerMapLock.Unlock()
+
+	store := peer.data.Get(TableHosts)
+	row := store.Index["testhost_1"]
+	require.NotNil(t, row)
+
+	// send delta update for testhost_1 with changed state, rows are only updated if last_check changed
+	setState := func(state int) {
+		res := ResultSet{{row.GetStringByName("name")}}
+		for _, col := range store.DynamicColumnCache {
+			val := row.GetValueByColumn(col)
+			switch col.Name {
+			case "state":
+				val = state
+			case "last_check":
+				val = row.GetInt64(col) + 1
+			}
+			res[0] = append(res[0], val)
+		}
+		err := peer.data.insertDeltaDataResult(context.TODO(), 1, res, &ResultMetaData{Request: &Request{}}, store)
+		require.NoError(t, err)
+	}
+
+	connect := func(query, lastEventID string) (*http.Response, *bufio.Scanner) {
+		req, err := http.NewRequestWithContext(context.TODO(), http.MethodGet, server.URL+"/events?"+query, http.NoBody)
+		require.NoError(t, err)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+
+		return res, bufio.NewScanner(res.Body)
+	}
+	receive := func(scanner *bufio.Scanner) (id string, event *StateEvent) {
+		event = &StateEvent{}
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), event))
+			case line == "":
+				return id, event
+			}
+		}
+
+		return id, event
+	}
+
+	res, scanner := connect("tables=hosts&filter=Filter:+name+%3D+testhost_1", "")
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	previous := row.GetInt64ByName("state")
+	setState(2)
+	id, event := receive(scanner)
+	assert.Equal(t, peer.ID, event.PeerKey)
+	assert.Equal(t, "hosts", event.Table)
+	assert.Equal(t, "testhost_1", event.HostName)
+	assert.Equal(t, int64(2), event.State)
+	assert.Equal(t, map[string]int64{"state": previous}, event.Previous)
+
+	// unchanged states do not create events
+	setState(2)
+	setState(0)
+	_, event = receive(scanner)
+	assert.Equal(t, int64(0), event.State)
+	assert.Equal(t, map[string]int64{"state": 2}, event.Previous)
+
+	// resume stream after first event
+	res2, scanner2 := connect("tables=hosts", id)
+	defer res2.Body.Close()
+	_, event = receive(scanner2)
+	assert.Equal(t, int64(0), event.State)
+
+	// replayed events are matched against the state at the time of the event
+	firstID, err := strconv.ParseUint(id, 10, 64)
+	require.NoError(t, err)
+	res5, scanner5 := connect("tables=hosts&filter=Filter:+state+%3D+2", strconv.FormatUint(firstID-1, 10))
+	defer res5.Body.Close()
+	id5, event := receive(scanner5)
+	assert.Equal(t, id, id5)
+	assert.Equal(t, int64(2), event.State)
+
+	res3, _ := connect("tables=contacts", "")
+	defer res3.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res3.StatusCode)
+
+	res4, _ := connect("", "abc")
+	defer res4.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res4.StatusCode)
+
+	err = cleanup()
+	require.NoError(t, err)
+}
@@ -204,6 +204,38 @@ func (t *Table) GetEmptyColumn() *Column {
 	}
 }
 
+// GetDeniedColumn returns an empty placeholder column for a column denied by an ACL.
+// It keeps the requested name, so the column header stays intact while the value is always empty.
+func (t *Table) GetDeniedColumn(name string) *Column {
+	col := t.GetEmptyColumn()
+	col.Name = name
+	col.Description = "placeholder for columns denied by acl"
+
+	return col
+}
+
+// GetRedactedColumn returns a virtual copy of the original column which returns redacted values only.
+func (t *Table) GetRedactedColumn(redaction *ColumnRedaction) *Column {
+	col := redaction.Column
+	dataType := col.DataType
+	if dataType == StringLargeCol {
+		dataType = StringCol
+	}
+
+	return &Column{
+		Name:        col.Name,
+		Description: col.Description,
+		Table:       t,
+		Index:       -1,
+		DataType:    dataType,
+		StorageType: VirtualStore,
+		FetchType:   None,
+		Optional:    col.Optional,
+		VirtualMap:  VirtualColumnMap["redacted"],
+		Redaction:   redaction,
+	}
+}
+
 // AddColumn adds a new column.
 func (t *Table) AddColumn(name string, update FetchType, datatype DataType, description string) {
 	NewColumn(t, name, LocalStore, update, datatype, NoFlags, nil, description)
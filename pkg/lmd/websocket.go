@@ -0,0 +1,382 @@
+package lmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// WebSocketPingInterval sets the interval for ping messages to detect broken connections.
+	WebSocketPingInterval = 15 * time.Second
+
+	// WebSocketPongTimeout sets the time after which a connection without any message is considered broken.
+	WebSocketPongTimeout = 3 * WebSocketPingInterval
+
+	// WebSocketWriteTimeout sets the timeout for sending a single message.
+	WebSocketWriteTimeout = 10 * time.Second
+
+	// WebSocketSubscriptionInterval sets the interval to check subscriptions for updated backends.
+	WebSocketSubscriptionInterval = 500 * time.Millisecond
+
+	// WebSocketMaxSubscriptions sets the maximum number of subscriptions per connection.
+	WebSocketMaxSubscriptions = 100
+
+	// WebSocketMaxMessageSize sets the maximum size of a single incoming message.
+	WebSocketMaxMessageSize = 1024 * 1024
+)
+
+// WebSocketMessage is a json request sent by websocket clients.
+// Plain text messages are handled as single livestatus query instead.
+type WebSocketMessage struct {
+	ID          string `json:"id"`          // identifies the answers to this message
+	Query       string `json:"query"`       // livestatus query
+	Subscribe   bool   `json:"subscribe"`   // send the result again whenever the backends have been updated
+	Unsubscribe bool   `json:"unsubscribe"` // remove subscription with this id
+}
+
+// WebSocketResponse is the json answer to a WebSocketMessage.
+type WebSocketResponse struct {
+	ID         string          `json:"id,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Code       int             `json:"code"`
+	LastUpdate float64         `json:"last_update,omitempty"`
+}
+
+// WebSocketConnection handles a single websocket client connection.
+type WebSocketConnection struct {
+	lmd           *Daemon
+	conn          *websocket.Conn
+	subscriptions map[string]*webSocketSubscription
+	remoteAddr    string
+	listen        string
+}
+
+// webSocketSubscription is a query which is resent whenever its backends have been updated.
+type webSocketSubscription struct {
+	id         string
+	query      string
+	lastUpdate float64
+}
+
+// websocket upgrades the http request and answers livestatus queries until the client disconnects.
+func (c *HTTPServerController) websocket(wrt http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	upgrader := websocket.Upgrader{}
+	if len(c.lmd.Config.WebSocketOrigins) > 0 {
+		upgrader.CheckOrigin = func(request *http.Request) bool {
+			origin, err := url.Parse(request.Header.Get("Origin"))
+			if err != nil {
+				return false
+			}
+
+			return matchAnyPattern(c.lmd.Config.WebSocketOrigins, origin.Host)
+		}
+	}
+	conn, err := upgrader.Upgrade(wrt, request, nil)
+	if err != nil {
+		// upgrader has sent the error response already
+		log.Debugf("websocket upgrade from %s failed: %s", request.RemoteAddr, err.Error())
+
+		return
+	}
+	defer conn.Close()
+
+	listen, _ := request.Context().Value(CtxListener).(string)
+	wsc := &WebSocketConnection{
+		lmd:           c.lmd,
+		conn:          conn,
+		subscriptions: make(map[string]*webSocketSubscription),
+		remoteAddr:    request.RemoteAddr,
+		listen:        listen,
+	}
+	log.Debugf("websocket client connected from %s", wsc.remoteAddr)
+	wsc.Handle(request.Context())
+	log.Debugf("websocket client %s disconnected", wsc.remoteAddr)
+}
+
+// Handle reads messages and sends the answers until the connection is closed.
+// Like connections using KeepAlive, idle connections are closed after the ListenTimeout
+// unless there are active subscriptions.
+func (wsc *WebSocketConnection) Handle(ctx context.Context) {
+	ctx = context.WithValue(ctx, CtxClient, wsc.remoteAddr)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	messages := make(chan []byte)
+	go func() {
+		// make sure we log panics properly
+		defer wsc.lmd.logPanicExit()
+		defer cancel()
+
+		wsc.readMessages(ctx, messages)
+	}()
+
+	idleTimeout := time.Duration(wsc.lmd.Config.ListenTimeout) * time.Second
+	idle := time.NewTimer(idleTimeout)
+	defer idle.Stop()
+	ping := time.NewTicker(WebSocketPingInterval)
+	defer ping.Stop()
+	check := time.NewTicker(WebSocketSubscriptionInterval)
+	defer check.Stop()
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-idle.C:
+			if len(wsc.subscriptions) == 0 {
+				logWith(ctx).Debugf("closing idle websocket connection (timeout: %s)", idleTimeout)
+				wsc.close(websocket.CloseNormalClosure, "idle timeout")
+
+				return
+			}
+			idle.Reset(idleTimeout)
+		case <-ping.C:
+			err = wsc.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(WebSocketWriteTimeout))
+		case <-check.C:
+			err = wsc.checkSubscriptions(ctx)
+		case msg := <-messages:
+			idle.Reset(idleTimeout)
+			err = wsc.handleMessage(ctx, msg)
+		}
+		if err != nil {
+			logWith(ctx).Debugf("websocket write failed: %s", err.Error())
+
+			return
+		}
+	}
+}
+
+// readMessages passes all incoming messages to the given channel.
+func (wsc *WebSocketConnection) readMessages(ctx context.Context, messages chan<- []byte) {
+	wsc.conn.SetReadLimit(WebSocketMaxMessageSize)
+	LogErrors(wsc.conn.SetReadDeadline(time.Now().Add(WebSocketPongTimeout)))
+	wsc.conn.SetPongHandler(func(string) error {
+		return wsc.conn.SetReadDeadline(time.Now().Add(WebSocketPongTimeout))
+	})
+	for {
+		_, msg, err := wsc.conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logWith(ctx).Debugf("websocket read failed: %s", err.Error())
+			}
+
+			return
+		}
+		LogErrors(wsc.conn.SetReadDeadline(time.Now().Add(WebSocketPongTimeout)))
+		select {
+		case messages <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleMessage answers a single message, json messages get a json answer, plain queries a plain livestatus answer.
+func (wsc *WebSocketConnection) handleMessage(ctx context.Context, msg []byte) error {
+	if !bytes.HasPrefix(bytes.TrimSpace(msg), []byte("{")) {
+		return wsc.write(websocket.TextMessage, wsc.plainResponse(ctx, string(msg)))
+	}
+
+	message := &WebSocketMessage{}
+	if err := json.Unmarshal(msg, message); err != nil {
+		return wsc.writeJSON(&WebSocketResponse{Code: ReturnCodeBadRequest, Error: "bad request: " + err.Error()})
+	}
+
+	switch {
+	case message.Unsubscribe:
+		if _, ok := wsc.subscriptions[message.ID]; !ok {
+			return wsc.writeJSON(&WebSocketResponse{ID: message.ID, Code: ReturnCodeBadRequest, Error: "bad request: unknown subscription " + message.ID})
+		}
+		delete(wsc.subscriptions, message.ID)
+
+		return wsc.writeJSON(&WebSocketResponse{ID: message.ID, Code: ReturnCodeOK})
+	case message.Subscribe:
+		if message.ID == "" {
+			return wsc.writeJSON(&WebSocketResponse{Code: ReturnCodeBadRequest, Error: "bad request: subscriptions require an id"})
+		}
+		if _, ok := wsc.subscriptions[message.ID]; !ok && len(wsc.subscriptions) >= WebSocketMaxSubscriptions {
+			return wsc.writeJSON(&WebSocketResponse{ID: message.ID, Code: ReturnCodeBadRequest, Error: fmt.Sprintf("bad request: maximum number of %d subscriptions reached", WebSocketMaxSubscriptions)})
+		}
+		res := wsc.jsonResponse(ctx, message.ID, message.Query)
+		if res.Code == ReturnCodeOK {
+			wsc.subscriptions[message.ID] = &webSocketSubscription{id: message.ID, query: message.Query, lastUpdate: res.LastUpdate}
+		}
+
+		return wsc.writeJSON(res)
+	default:
+		return wsc.writeJSON(wsc.jsonResponse(ctx, message.ID, message.Query))
+	}
+}
+
+// checkSubscriptions resends the result of all subscriptions whose backends have been updated.
+func (wsc *WebSocketConnection) checkSubscriptions(ctx context.Context) error {
+	for _, sub := range wsc.subscriptions {
+		req, code, err := wsc.parseRequest(ctx, sub.query)
+		if err != nil {
+			// queries may become invalid later, ex.: if the backend has been removed, so only this subscription is dropped
+			logWith(ctx).Debugf("removing websocket subscription %s: %s", sub.id, err.Error())
+			delete(wsc.subscriptions, sub.id)
+			if err = wsc.writeJSON(&WebSocketResponse{ID: sub.id, Code: code, Error: err.Error()}); err != nil {
+				return err
+			}
+
+			continue
+		}
+		if wsc.lastUpdate(req) == sub.lastUpdate {
+			continue
+		}
+		res := wsc.jsonResponse(ctx, sub.id, sub.query)
+		sub.lastUpdate = res.LastUpdate
+		if err := wsc.writeJSON(res); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// plainResponse runs the query and returns the answer as it would be sent over a livestatus socket.
+func (wsc *WebSocketConnection) plainResponse(ctx context.Context, query string) []byte {
+	buf := &bytes.Buffer{}
+	req, code, err := wsc.parseRequest(ctx, query)
+	if err == nil {
+		var res *Response
+		res, code, err = wsc.runRequest(ctx, req)
+		if err == nil {
+			_, err = res.send(buf)
+			if err == nil {
+				return buf.Bytes()
+			}
+			code = ReturnCodeInternalError
+		}
+	}
+	if req == nil {
+		req = &Request{}
+	}
+	buf.Reset()
+	LogErrors((&Response{Code: code, Request: req, Error: err}).send(buf))
+
+	return buf.Bytes()
+}
+
+// jsonResponse runs the query and returns the json answer.
+func (wsc *WebSocketConnection) jsonResponse(ctx context.Context, id, query string) *WebSocketResponse {
+	res := &WebSocketResponse{ID: id, Code: ReturnCodeOK}
+	req, code, err := wsc.parseRequest(ctx, query)
+	if err == nil && (req.OutputFormat == OutputFormatPython || req.OutputFormat == OutputFormatPython3) {
+		code, err = ReturnCodeBadRequest, errors.New("bad request: websocket json messages require json output format")
+	}
+	if err != nil {
+		res.Code = code
+		res.Error = err.Error()
+
+		return res
+	}
+
+	res.LastUpdate = wsc.lastUpdate(req)
+	response, code, err := wsc.runRequest(ctx, req)
+	if err != nil {
+		res.Code = code
+		res.Error = err.Error()
+
+		return res
+	}
+	buf, err := response.Buffer()
+	if err != nil {
+		res.Code = ReturnCodeInternalError
+		res.Error = err.Error()
+
+		return res
+	}
+	res.Result = json.RawMessage(bytes.TrimSpace(buf.Bytes()))
+
+	return res
+}
+
+// parseRequest parses a single livestatus query, commands are not supported.
+func (wsc *WebSocketConnection) parseRequest(ctx context.Context, query string) (*Request, int, error) {
+	if !strings.HasSuffix(query, "\n") {
+		query += "\n"
+	}
+	req, _, err := NewRequest(ctx, wsc.lmd, bufio.NewReader(strings.NewReader(query)), wsc.lmd.defaultReqestParseOption)
+	if err != nil {
+		return nil, ReturnCodeBadRequest, err
+	}
+	if req == nil {
+		return nil, ReturnCodeBadRequest, errors.New("bad request: empty request")
+	}
+	if req.Command != "" {
+		return nil, ReturnCodeBadRequest, errors.New("bad request: commands are not supported on websocket connections")
+	}
+	err = req.ExpandRequestedBackends()
+	if err != nil {
+		return nil, ReturnCodeBadRequest, err
+	}
+
+	return req, ReturnCodeOK, nil
+}
+
+// runRequest checks the request limits and builds the response.
+func (wsc *WebSocketConnection) runRequest(ctx context.Context, req *Request) (*Response, int, error) {
+	release, err := wsc.lmd.admitRequest(wsc.remoteAddr, req.AuthUser, wsc.listen)
+	if err != nil {
+		logWith(ctx).Warnf("rejected websocket request from %s: %s", wsc.remoteAddr, err.Error())
+
+		return nil, ReturnCodeTooManyRequests, err
+	}
+	defer release()
+
+	res, err := req.BuildResponse(ctx)
+	if err != nil {
+		return nil, ReturnCodeBadRequest, err
+	}
+
+	return res, ReturnCodeOK, nil
+}
+
+// lastUpdate returns the latest update timestamp of all backends used by this request.
+func (wsc *WebSocketConnection) lastUpdate(req *Request) (lastUpdate float64) {
+	wsc.lmd.PeerMapLock.RLock()
+	defer wsc.lmd.PeerMapLock.RUnlock()
+	for peerKey := range req.BackendsMap {
+		peer, ok := wsc.lmd.PeerMap[peerKey]
+		if !ok {
+			continue
+		}
+		lastUpdate = max(lastUpdate, interface2float64(peer.statusGetLocked(LastUpdate)))
+	}
+
+	return lastUpdate
+}
+
+// write sends a single message.
+func (wsc *WebSocketConnection) write(messageType int, data []byte) error {
+	LogErrors(wsc.conn.SetWriteDeadline(time.Now().Add(WebSocketWriteTimeout)))
+
+	return wsc.conn.WriteMessage(messageType, data)
+}
+
+// writeJSON sends a single json message.
+func (wsc *WebSocketConnection) writeJSON(data interface{}) error {
+	LogErrors(wsc.conn.SetWriteDeadline(time.Now().Add(WebSocketWriteTimeout)))
+
+	return wsc.conn.WriteJSON(data)
+}
+
+// close sends a close message with given code and reason.
+func (wsc *WebSocketConnection) close(code int, reason string) {
+	LogErrors(wsc.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(WebSocketWriteTimeout)))
+}
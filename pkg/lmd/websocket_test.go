@@ -0,0 +1,126 @@
+package lmd
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSocket(t *testing.T) {
+	// members of the example group may query hosts, everyone else is unrestricted
+	extraConfig := `
+Listen = ["test.sock"]
+
+[[ACL]]
+name = "status"
+users = ["groupuser"]
+tables = ["status"]
+
+[[ACL]]
+name = "group"
+groups = ["example"]
+tables = ["hosts"]
+`
+	peer, cleanup, mocklmd := StartTestPeerExtra(1, 2, 2, extraConfig)
+	PauseTestPeers(peer)
+
+	server := NewTestHTTPServer(t, mocklmd)
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/websocket", nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	defer conn.Close()
+
+	send := func(msg string) {
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(msg)))
+	}
+	receive := func() *WebSocketResponse {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		res := &WebSocketResponse{}
+		require.NoError(t, conn.ReadJSON(res))
+
+		return res
+	}
+
+	// plain livestatus query
+	send("GET hosts\nColumns: name\nOutputFormat: json\n")
+	_, msg, err := conn.ReadMessage()
+	require.NoError(t, err)
+	var rows [][]interface{}
+	require.NoError(t, json.Unmarshal(msg, &rows))
+	assert.Len(t, rows, 2)
+
+	// json query on the same connection
+	send(`{"id":"q1","query":"GET hosts\nColumns: name\nFilter: name = testhost_1\n"}`)
+	res := receive()
+	assert.Equal(t, "q1", res.ID)
+	assert.Equal(t, ReturnCodeOK, res.Code)
+	require.NoError(t, json.Unmarshal(res.Result, &rows))
+	assert.Equal(t, [][]interface{}{{"testhost_1"}}, rows)
+
+	send(`{"id":"c1","query":"COMMAND [0] test_ok"}`)
+	res = receive()
+	assert.Equal(t, ReturnCodeBadRequest, res.Code)
+	assert.Contains(t, res.Error, "commands are not supported")
+
+	// subscriptions are resent after the backend has been updated
+	send(`{"id":"s1","query":"GET status\nColumns: peer_key\n","subscribe":true}`)
+	res = receive()
+	assert.Equal(t, "s1", res.ID)
+	assert.Equal(t, ReturnCodeOK, res.Code)
+	lastUpdate := res.LastUpdate
+
+	mocklmd.PeerMapLock.RLock()
+	for _, p := range mocklmd.PeerMap {
+		p.statusSetLocked(LastUpdate, lastUpdate+10)
+	}
+	mocklmd.PeerMapLock.RUnlock()
+
+	res = receive()
+	assert.Equal(t, "s1", res.ID)
+	assert.InDelta(t, lastUpdate+10, res.LastUpdate, 0.001)
+
+	send(`{"id":"s1","unsubscribe":true}`)
+	res = receive()
+	assert.Equal(t, ReturnCodeOK, res.Code)
+
+	send(`{"id":"s1","unsubscribe":true}`)
+	res = receive()
+	assert.Equal(t, ReturnCodeBadRequest, res.Code)
+
+	// subscriptions which became invalid are removed, the connection stays open
+	send(`{"id":"s2","query":"GET hosts\nColumns: name\nAuthUser: groupuser\n","subscribe":true}`)
+	res = receive()
+	assert.Equal(t, ReturnCodeOK, res.Code)
+
+	// removing the contact group revokes the hosts table from the group acl
+	mocklmd.PeerMapLock.RLock()
+	for _, p := range mocklmd.PeerMap {
+		ds := p.data
+		store := ds.Get(TableContactgroups)
+		ds.lock.Lock()
+		for _, row := range slices.Clone(store.Data) {
+			store.RemoveItem(row)
+		}
+		ds.lock.Unlock()
+	}
+	mocklmd.PeerMapLock.RUnlock()
+
+	res = receive()
+	assert.Equal(t, "s2", res.ID)
+	assert.Equal(t, ReturnCodeBadRequest, res.Code)
+	assert.Contains(t, res.Error, "table hosts not allowed")
+
+	send(`{"id":"s2","unsubscribe":true}`)
+	res = receive()
+	assert.Equal(t, ReturnCodeBadRequest, res.Code)
+
+	err = cleanup()
+	require.NoError(t, err)
+}